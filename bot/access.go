@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// chatAccessTTL is how long a membership check or chat title is trusted.
+// Users who leave a chat may still search it for this long.
+const chatAccessTTL = 10 * time.Minute
+
+// chatAccess remembers which chats users belong to and what the chats are
+// called, so searches from outside a chat don't ask Telegram on every
+// keystroke
+type chatAccess struct {
+	members map[memberKey]cachedAccess
+	titles  map[int64]cachedAccess
+	ttl     time.Duration
+	mutex   sync.Mutex
+}
+
+type memberKey struct {
+	chatID int64
+	userID int64
+}
+
+type cachedAccess struct {
+	member  bool
+	title   string
+	expires time.Time
+}
+
+func newChatAccess(ttl time.Duration) *chatAccess {
+	return &chatAccess{
+		members: make(map[memberKey]cachedAccess),
+		titles:  make(map[int64]cachedAccess),
+		ttl:     ttl,
+	}
+}
+
+// member returns a cached membership check
+func (a *chatAccess) member(chatID, userID int64) (member, ok bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.members[memberKey{chatID, userID}]
+	if !ok || time.Now().After(entry.expires) {
+		return false, false
+	}
+	return entry.member, true
+}
+
+func (a *chatAccess) setMember(chatID, userID int64, member bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.members[memberKey{chatID, userID}] = cachedAccess{member: member, expires: time.Now().Add(a.ttl)}
+}
+
+// title returns a cached chat title
+func (a *chatAccess) title(chatID int64) (string, bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	entry, ok := a.titles[chatID]
+	if !ok || time.Now().After(entry.expires) {
+		return "", false
+	}
+	return entry.title, true
+}
+
+func (a *chatAccess) setTitle(chatID int64, title string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.titles[chatID] = cachedAccess{title: title, expires: time.Now().Add(a.ttl)}
+}
+
+// removeExpired drops checks past their expiry
+func (a *chatAccess) removeExpired() {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range a.members {
+		if now.After(entry.expires) {
+			delete(a.members, key)
+		}
+	}
+	for chatID, entry := range a.titles {
+		if now.After(entry.expires) {
+			delete(a.titles, chatID)
+		}
+	}
+}
+
+// isChatMember reports whether a user currently belongs to a chat. Everyone
+// belongs to their private chat with the bot.
+func (b *Bot) isChatMember(chatID, userID int64) bool {
+	if chatID == userID {
+		return true
+	}
+	if member, ok := b.access.member(chatID, userID); ok {
+		return member
+	}
+
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: chatID,
+			UserID: userID,
+		},
+	})
+	if err != nil {
+		// Not cached, the check may succeed next time
+		log.Printf("Error checking membership of user %d in chat %d: %v", userID, chatID, err)
+		return false
+	}
+
+	// Restricted users may or may not still be in the chat
+	belongs := !member.HasLeft() && !member.WasKicked() && (member.Status != "restricted" || member.IsMember)
+	b.access.setMember(chatID, userID, belongs)
+	return belongs
+}
+
+// memberChats returns the chats a user may search from outside them: those
+// they have been seen posting in, still belong to, and that didn't opt out,
+// each with its title
+func (b *Bot) memberChats(ctx context.Context, userID int64) ([]database.MemberChat, error) {
+	chats, err := b.db.GetMemberChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var member []database.MemberChat
+	for _, chat := range chats {
+		if !b.isChatMember(chat.ChatID, userID) {
+			continue
+		}
+		if chat.Title == "" {
+			chat.Title = b.chatTitle(chat.ChatID)
+		}
+		member = append(member, chat)
+	}
+	return member, nil
+}
+
+// chatTitle asks Telegram for the name of a chat whose title wasn't stored,
+// such as private chats
+func (b *Bot) chatTitle(chatID int64) string {
+	if title, ok := b.access.title(chatID); ok {
+		return title
+	}
+
+	chat, err := b.api.GetChat(tgbotapi.ChatInfoConfig{ChatConfig: tgbotapi.ChatConfig{ChatID: chatID}})
+	if err != nil {
+		log.Printf("Error getting title of chat %d: %v", chatID, err)
+		return fmt.Sprintf("Chat %d", chatID)
+	}
+
+	title := chat.Title
+	if chat.IsPrivate() {
+		title = "Private chat"
+	}
+	b.access.setTitle(chatID, title)
+	return title
+}
@@ -0,0 +1,41 @@
+package bot
+
+import (
+	"log"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// isChatAdmin reports whether the sender of a message may run admin
+// commands in its chat. Everyone is the admin of their private chat.
+func (b *Bot) isChatAdmin(message *tgbotapi.Message) bool {
+	if message.Chat.IsPrivate() {
+		return true
+	}
+	if message.From == nil {
+		return false
+	}
+
+	member, err := b.api.GetChatMember(tgbotapi.GetChatMemberConfig{
+		ChatConfigWithUser: tgbotapi.ChatConfigWithUser{
+			ChatID: message.Chat.ID,
+			UserID: message.From.ID,
+		},
+	})
+	if err != nil {
+		log.Printf("Error checking admin status of user %d in chat %d: %v", message.From.ID, message.Chat.ID, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+// requireAdmin replies with a notice and returns false if the sender is not
+// a chat admin
+func (b *Bot) requireAdmin(message *tgbotapi.Message) bool {
+	if b.isChatAdmin(message) {
+		return true
+	}
+	b.sendReply(message, "🔒 Only chat admins can use this command.")
+	return false
+}
@@ -1,12 +1,15 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
 	"semantic-search-bot/config"
 	"semantic-search-bot/database"
 	"semantic-search-bot/embedding"
 	"semantic-search-bot/search"
+	"sync"
 	"time"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
@@ -16,13 +19,42 @@ type Bot struct {
 	api       *tgbotapi.BotAPI
 	db        *database.DB
 	config    *config.Config
-	embedding *embedding.Client
+	embedding embedding.Embedder
+	cache     *embedding.CachedEmbedder
+	breaker   *embedding.CircuitBreaker
 	search    *search.Engine
 	perf      *PerformanceMonitor
+	results   *resultCache
+	inline    *inlineCache
+	access    *chatAccess
+	threads   *threadTracker
+	queue     *embeddingQueue
+
+	// ctx is canceled when the shutdown deadline passes, aborting database
+	// queries and embedding requests that are still running
+	ctx      context.Context
+	cancel   context.CancelFunc
+	stopping chan struct{} // closed by Stop to end the update loop and background jobs
+	stopped  chan struct{} // closed once Stop has drained in-flight work
+	stopOnce sync.Once
+
+	tasks   sync.WaitGroup // update handlers and background jobs
+	closing bool           // set by Stop, no new tasks are spawned
+	mutex   sync.Mutex
 }
 
+const (
+	// shutdownTimeout is how long Stop waits for in-flight work to finish
+	// before canceling it
+	shutdownTimeout = 15 * time.Second
+	// shutdownGrace is how long Stop then waits for canceled work to return
+	shutdownGrace = 5 * time.Second
+)
+
 func NewBot(cfg *config.Config, db *database.DB) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(cfg.TelegramToken)
+	// Wrap the HTTP client to recover forum topic IDs from raw updates
+	threads := newThreadTracker(&http.Client{})
+	api, err := tgbotapi.NewBotAPIWithClient(cfg.TelegramToken, tgbotapi.APIEndpoint, threads)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot API: %w", err)
 	}
@@ -31,36 +63,120 @@ func NewBot(cfg *config.Config, db *database.DB) (*Bot, error) {
 	log.Printf("Authorized on account %s", api.Self.UserName)
 
 	// Initialize embedding client
-	embeddingClient := embedding.NewClient(cfg.EmbeddingAPIURL, cfg.EmbeddingModel)
+	provider, err := embedding.New(cfg.EmbeddingProvider, cfg.EmbeddingAPIURL, cfg.EmbeddingModel, cfg.EmbeddingAPIKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding client: %w", err)
+	}
+
+	// Fail fast while the embedding service is down
+	breaker := embedding.NewCircuitBreaker(provider, embedding.BreakerSettings{
+		FailureThreshold:  cfg.BreakerFailures,
+		OpenTimeout:       time.Duration(cfg.BreakerCooldown) * time.Second,
+		HalfOpenSuccesses: cfg.BreakerSuccesses,
+	})
+
+	// Answer repeated texts from memory or the database instead of the API,
+	// even while the breaker is open
+	embeddingClient := embedding.NewCachedEmbedder(breaker, db, cfg.EmbeddingCacheSize)
+	db.OnEmbeddingCacheDeleted(embeddingClient.Forget)
 
 	// Initialize search engine
 	searchEngine := search.NewEngine(db, embeddingClient, cfg.MaxResults)
+	if cfg.ContextWindows {
+		searchEngine.EnableConversationWindows()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopping := make(chan struct{})
+
+	// Label vectors stored before models were tracked with the configured model
+	if err := db.AdoptEmbeddingModel(ctx, cfg.EmbeddingModel); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to adopt embedding model: %w", err)
+	}
+
+	// Load stored embeddings into the per-chat vector indexes
+	indexStart := time.Now()
+	if err := searchEngine.BuildIndexes(ctx); err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to build search indexes: %w", err)
+	}
+	log.Printf("Search indexes built in %v", time.Since(indexStart))
 
 	// Initialize performance monitor
 	perfMonitor := NewPerformanceMonitor()
-	perfMonitor.StartMonitoring(5 * time.Minute) // Log stats every 5 minutes
 
-	// Test embedding connection (non-blocking)
-	go func() {
-		if err := embeddingClient.TestConnection(); err != nil {
-			log.Printf("⚠️  Embedding service connection failed: %v", err)
-			log.Printf("💡 Make sure Ollama is running: ollama serve")
-			log.Printf("💡 And model is available: ollama pull %s", cfg.EmbeddingModel)
-		} else {
-			log.Printf("✅ Embedding service connected successfully")
-		}
-	}()
+	// Embed stored messages in batches with a bounded worker pool
+	queue := newEmbeddingQueue(db, embeddingClient, searchEngine, perfMonitor, cfg.EmbeddingWorkers, cfg.EmbeddingBatchSize)
+	queue.Start(ctx, stopping)
 
-	return &Bot{
+	// Keep ranked results around for page navigation buttons
+	results := newResultCache(resultCacheTTL)
+
+	b := &Bot{
 		api:       api,
 		db:        db,
 		config:    cfg,
 		embedding: embeddingClient,
+		cache:     embeddingClient,
+		breaker:   breaker,
 		search:    searchEngine,
 		perf:      perfMonitor,
-	}, nil
+		results:   results,
+		inline:    newInlineCache(inlineCacheTTL),
+		access:    newChatAccess(chatAccessTTL),
+		threads:   threads,
+		queue:     queue,
+		ctx:       ctx,
+		cancel:    cancel,
+		stopping:  stopping,
+		stopped:   make(chan struct{}),
+	}
+
+	// Log performance stats and evict expired result pages, inline answers
+	// and membership checks every 5 minutes
+	b.every(5*time.Minute, func(ctx context.Context) {
+		perfMonitor.LogPerformanceStats()
+		results.removeExpired()
+		b.inline.removeExpired()
+		b.access.removeExpired()
+	})
+
+	// Test embedding connection (non-blocking)
+	b.spawn(func() {
+		if err := embedding.TestConnection(ctx, provider); err != nil {
+			log.Printf("⚠️  Embedding service connection failed: %v", err)
+			if cfg.EmbeddingProvider == embedding.ProviderOpenAI {
+				log.Printf("💡 Make sure the embedding server is running at %s", cfg.EmbeddingAPIURL)
+				log.Printf("💡 And serves the model: %s", cfg.EmbeddingModel)
+			} else {
+				log.Printf("💡 Make sure Ollama is running: ollama serve")
+				log.Printf("💡 And model is available: ollama pull %s", cfg.EmbeddingModel)
+			}
+		} else {
+			log.Printf("✅ Embedding service connected successfully")
+		}
+	})
+
+	// Enforce message retention windows in the background
+	b.StartRetentionSweeper(retentionSweepInterval)
+
+	// Backfill messages that were stored without an embedding
+	b.StartEmbeddingReconciler(embeddingReconcileInterval)
+
+	// Re-embed chats whose vectors come from a previously configured model
+	b.StartModelMigrator(modelMigrationInterval)
+
+	// Group messages into conversation windows embedded as a unit
+	if cfg.ContextWindows {
+		b.StartConversationIndexer(conversationIndexInterval)
+	}
+
+	return b, nil
 }
 
+// Start handles updates until Stop is called and returns once Stop has
+// drained in-flight work, so the database can be closed afterwards
 func (b *Bot) Start() error {
 	log.Println("Starting bot...")
 
@@ -69,14 +185,92 @@ func (b *Bot) Start() error {
 
 	updates := b.api.GetUpdatesChan(u)
 
-	for update := range updates {
-		go b.handleUpdate(update)
+	for {
+		select {
+		case update, ok := <-updates:
+			if !ok {
+				<-b.stopped
+				return nil
+			}
+			b.spawn(func() { b.handleUpdate(b.ctx, update) })
+		case <-b.stopping:
+			<-b.stopped
+			return nil
+		}
 	}
-
-	return nil
 }
 
+// Stop stops receiving updates and waits up to shutdownTimeout for update
+// handlers, background jobs and the embedding queue to finish. Work still
+// running then is canceled through the bot's context. Telegram API calls
+// can't be canceled, so Stop gives up waiting after shutdownGrace.
 func (b *Bot) Stop() {
-	log.Println("Stopping bot...")
-	b.api.StopReceivingUpdates()
+	b.stopOnce.Do(func() {
+		log.Println("Stopping bot...")
+
+		b.mutex.Lock()
+		b.closing = true
+		b.mutex.Unlock()
+
+		close(b.stopping)
+		b.api.StopReceivingUpdates()
+
+		drained := make(chan struct{})
+		go func() {
+			b.tasks.Wait()
+			b.queue.Wait()
+			close(drained)
+		}()
+
+		select {
+		case <-drained:
+			log.Println("In-flight work finished")
+		case <-time.After(shutdownTimeout):
+			log.Printf("⚠️  In-flight work still running after %v, canceling it", shutdownTimeout)
+			b.cancel()
+			select {
+			case <-drained:
+			case <-time.After(shutdownGrace):
+				log.Println("⚠️  Some work did not stop in time")
+			}
+		}
+
+		b.cancel()
+		close(b.stopped)
+	})
+}
+
+// spawn runs task in a goroutine that Stop waits for. Once Stop was called
+// new tasks are dropped.
+func (b *Bot) spawn(task func()) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closing {
+		return
+	}
+
+	b.tasks.Add(1)
+	go func() {
+		defer b.tasks.Done()
+		task()
+	}()
+}
+
+// every runs job now and then on every interval until the bot stops
+func (b *Bot) every(interval time.Duration, job func(ctx context.Context)) {
+	b.spawn(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job(b.ctx)
+
+			select {
+			case <-ticker.C:
+			case <-b.stopping:
+				return
+			}
+		}
+	})
 }
@@ -0,0 +1,94 @@
+package bot
+
+import (
+	"semantic-search-bot/database"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// messageContent returns the text to index for a message and its content
+// type. Media are indexed by their caption, documents and audio also by
+// their filename or title, and polls by their question and options.
+func messageContent(message *tgbotapi.Message) (string, string) {
+	switch {
+	case message.Text != "":
+		return message.Text, database.ContentText
+	case message.Photo != nil:
+		return message.Caption, database.ContentPhoto
+	case message.Video != nil:
+		return message.Caption, database.ContentVideo
+	case message.Animation != nil:
+		return message.Caption, database.ContentAnimation
+	case message.Voice != nil:
+		return message.Caption, database.ContentVoice
+	case message.Audio != nil:
+		title := message.Audio.FileName
+		if message.Audio.Title != "" {
+			title = strings.TrimSpace(message.Audio.Performer + " " + message.Audio.Title)
+		}
+		return joinContent(title, message.Caption), database.ContentAudio
+	case message.Document != nil:
+		return joinContent(message.Document.FileName, message.Caption), database.ContentDocument
+	case message.Poll != nil:
+		options := make([]string, len(message.Poll.Options))
+		for i, option := range message.Poll.Options {
+			options[i] = option.Text
+		}
+		return joinContent(message.Poll.Question, strings.Join(options, " / ")), database.ContentPoll
+	}
+	return "", database.ContentText
+}
+
+// joinContent joins the non-empty parts of a message's content
+func joinContent(parts ...string) string {
+	var content []string
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			content = append(content, part)
+		}
+	}
+	return strings.Join(content, "\n")
+}
+
+// forwardOrigin describes where a forwarded message came from: the channel
+// or group (with the author's signature, if any), the user, or the name of
+// a user who hides their account. Empty if the message wasn't forwarded.
+func forwardOrigin(message *tgbotapi.Message) string {
+	switch {
+	case message.ForwardFromChat != nil:
+		origin := message.ForwardFromChat.Title
+		if origin == "" && message.ForwardFromChat.UserName != "" {
+			origin = "@" + message.ForwardFromChat.UserName
+		}
+		if message.ForwardSignature != "" {
+			origin += " (" + message.ForwardSignature + ")"
+		}
+		return origin
+	case message.ForwardFrom != nil:
+		if message.ForwardFrom.UserName != "" {
+			return "@" + message.ForwardFrom.UserName
+		}
+		return strings.TrimSpace(message.ForwardFrom.FirstName + " " + message.ForwardFrom.LastName)
+	}
+	return message.ForwardSenderName
+}
+
+// contentIcon marks non-text results with the kind of content they are
+func contentIcon(contentType string) string {
+	switch contentType {
+	case database.ContentPhoto:
+		return "🖼 "
+	case database.ContentVideo, database.ContentAnimation:
+		return "🎬 "
+	case database.ContentAudio:
+		return "🎵 "
+	case database.ContentVoice:
+		return "🎤 "
+	case database.ContentDocument:
+		return "📄 "
+	case database.ContentPoll:
+		return "📊 "
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"context"
+	"semantic-search-bot/database"
+	"semantic-search-bot/search"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestStoreMediaMessages(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	from := &tgbotapi.User{ID: 1, UserName: "alice"}
+	date := int(time.Now().Unix())
+	messages := []*tgbotapi.Message{
+		{MessageID: 1, From: from, Chat: chat, Date: date, Photo: []tgbotapi.PhotoSize{{FileID: "p"}}, Caption: "Sunset over the harbour"},
+		{MessageID: 2, From: from, Chat: chat, Date: date, Document: &tgbotapi.Document{FileName: "q3-budget-report.pdf"}, Caption: "numbers for review"},
+		{MessageID: 3, From: from, Chat: chat, Date: date, Poll: &tgbotapi.Poll{
+			Question: "Which day for the offsite?",
+			Options:  []tgbotapi.PollOption{{Text: "Tuesday"}, {Text: "Friday"}},
+		}},
+		{MessageID: 4, From: from, Chat: chat, Date: date, Text: "New release is out",
+			ForwardFromChat: &tgbotapi.Chat{ID: -200, Type: "channel", Title: "Release Notes"}, ForwardSignature: "bob"},
+		{MessageID: 5, From: from, Chat: chat, Date: date, Photo: []tgbotapi.PhotoSize{{FileID: "q"}}}, // nothing to index
+	}
+	for _, message := range messages {
+		b.handleMessage(ctx, message)
+	}
+
+	stored, err := b.db.GetMessages(ctx, chat.ID)
+	if err != nil {
+		t.Fatalf("GetMessages failed: %v", err)
+	}
+	byTelegramID := make(map[int]database.Message)
+	for _, msg := range stored {
+		byTelegramID[msg.TelegramMessageID] = msg
+	}
+	if len(stored) != 4 {
+		t.Fatalf("Expected 4 stored messages, got %d", len(stored))
+	}
+
+	tests := []struct {
+		id          int
+		text        string
+		contentType string
+	}{
+		{1, "Sunset over the harbour", database.ContentPhoto},
+		{2, "q3-budget-report.pdf numbers for review", database.ContentDocument},
+		{3, "Which day for the offsite? Tuesday / Friday", database.ContentPoll},
+		{4, "New release is out", database.ContentText},
+	}
+	for _, tt := range tests {
+		msg := byTelegramID[tt.id]
+		if msg.Text != tt.text || msg.ContentType != tt.contentType {
+			t.Errorf("Message %d: expected %s %q, got %s %q", tt.id, tt.contentType, tt.text, msg.ContentType, msg.Text)
+		}
+	}
+	if origin := byTelegramID[4].ForwardOrigin; origin != "Release Notes (bob)" {
+		t.Errorf("Expected the forward origin, got %q", origin)
+	}
+
+	drainQueue(t, b)
+
+	query, _ := search.ParseQuery("has:doc budget report", time.Now())
+	results, err := b.search.Search(ctx, query.Text, chat.ID, search.SearchOptions{Filter: query.Filter})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Message.TelegramMessageID != 2 {
+		t.Fatalf("Expected only the document, got %+v", results)
+	}
+
+	formatted := b.formatSearchResults("budget report", search.ModeSemantic, results, len(results), time.Millisecond, "")
+	if !strings.Contains(formatted, "📄 q3-budget-report.pdf") {
+		t.Errorf("Expected the document marked as a file, got:\n%s", formatted)
+	}
+
+	results, _ = b.search.Search(ctx, "release", chat.ID, search.SearchOptions{Mode: search.ModeKeyword})
+	formatted = b.formatSearchResults("release", search.ModeKeyword, results, len(results), time.Millisecond, "")
+	if !strings.Contains(formatted, "Forwarded from Release Notes (bob)") {
+		t.Errorf("Expected the forward origin in the results, got:\n%s", formatted)
+	}
+}
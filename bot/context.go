@@ -0,0 +1,156 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	contextCallbackPrefix = "ctx"
+
+	// contextRadius is how many messages the context view shows on each side
+	// of a message
+	contextRadius = 3
+)
+
+// handleContextCommand shows the messages around a stored message. The
+// message is the one replied to, or given by its ID or t.me link.
+func (b *Bot) handleContextCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	telegramID := 0
+	if args = strings.TrimSpace(args); args != "" {
+		// t.me links end with the message ID
+		args = strings.TrimSuffix(args, "/")
+		id, err := strconv.Atoi(args[strings.LastIndex(args, "/")+1:])
+		if err != nil || id <= 0 {
+			b.sendReply(message, "❌ I couldn't read that message ID.\n\n💡 *Try:* reply to a message with `/context`, or `/context 1234`")
+			return
+		}
+		telegramID = id
+	} else if parent := message.ReplyToMessage; parent != nil && parent.MessageID != b.threads.threadID(message.Chat.ID, message.MessageID) {
+		// Replies to a forum topic's first message are implicit
+		telegramID = parent.MessageID
+	}
+
+	if telegramID == 0 {
+		b.sendReply(message, "🧵 *Conversation context*\n\nReply to a message with `/context`, or pass its ID or link: `/context 1234`")
+		return
+	}
+
+	stored, err := b.db.GetMessageByTelegramID(ctx, message.Chat.ID, telegramID)
+	if err != nil {
+		log.Printf("Error looking up message %d for context: %v", telegramID, err)
+		b.sendReply(message, "❌ I couldn't load that message right now. Please try again.")
+		return
+	}
+	if stored == nil {
+		b.sendReply(message, "🤷 I don't have that message stored.")
+		return
+	}
+
+	view, err := b.contextView(ctx, *stored, message.Chat.UserName)
+	if err != nil {
+		log.Printf("Error loading context of message %d: %v", stored.ID, err)
+		b.sendReply(message, "❌ I couldn't load the conversation right now. Please try again.")
+		return
+	}
+	b.sendReplyWithKeyboard(message, view, nil)
+}
+
+// handleContextCallback shows the context of a search result below the
+// result list
+func (b *Bot) handleContextCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(query.Data, contextCallbackPrefix+":"), 10, 64)
+	if err != nil || query.Message == nil {
+		b.answerCallback(query, "")
+		return
+	}
+
+	messages, err := b.db.GetMessagesByIDs(ctx, []int64{id})
+	if err != nil || len(messages) == 0 || !b.viewableFrom(query, messages[0]) {
+		b.answerCallback(query, "🤷 That message is no longer stored.")
+		return
+	}
+
+	// Links need the username of the message's chat, unknown when results
+	// were sent privately
+	chatUsername := ""
+	if messages[0].ChatID == query.Message.Chat.ID {
+		chatUsername = query.Message.Chat.UserName
+	}
+	view, err := b.contextView(ctx, messages[0], chatUsername)
+	if err != nil {
+		log.Printf("Error loading context of message %d: %v", id, err)
+		b.answerCallback(query, "❌ I couldn't load the conversation right now.")
+		return
+	}
+
+	reply := tgbotapi.NewMessage(query.Message.Chat.ID, view)
+	reply.ParseMode = "Markdown"
+	reply.DisableWebPagePreview = true
+	reply.ReplyToMessageID = query.Message.MessageID
+	if _, err := b.api.Send(reply); err != nil {
+		log.Printf("Error sending context of message %d: %v", id, err)
+	}
+	b.answerCallback(query, "")
+}
+
+// contextView renders the messages before and after msg in its thread,
+// along with the message it replied to when that is further back
+func (b *Bot) contextView(ctx context.Context, msg database.Message, chatUsername string) (string, error) {
+	before, err := b.db.GetMessagesBefore(ctx, msg.ChatID, msg.ThreadID, msg.Timestamp, msg.ID, contextRadius)
+	if err != nil {
+		return "", err
+	}
+	after, err := b.db.GetMessagesAfter(ctx, msg.ChatID, msg.ThreadID, msg.Timestamp, msg.ID, contextRadius)
+	if err != nil {
+		return "", err
+	}
+
+	var parent *database.Message
+	if msg.ReplyToMessageID != 0 {
+		parent, err = b.db.GetMessageByTelegramID(ctx, msg.ChatID, msg.ReplyToMessageID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var view strings.Builder
+	view.WriteString("🧵 *Conversation context*\n\n")
+
+	if parent != nil && !containsMessage(before, parent.ID) {
+		view.WriteString(fmt.Sprintf("↩️ *In reply to* %s • %s\n%s\n\n",
+			getDisplayName(parent.Username), parent.Timestamp.Format("Jan 2 at 15:04"), truncateText(parent.Text, 200)))
+	}
+
+	for i := len(before) - 1; i >= 0; i-- {
+		view.WriteString(contextLine("▫️", before[i]))
+	}
+	view.WriteString(contextLine("👉", msg))
+	for _, later := range after {
+		view.WriteString(contextLine("▫️", later))
+	}
+
+	if link := messageLink(msg.ChatID, chatUsername, msg); link != "" {
+		view.WriteString(fmt.Sprintf("\n[🔗 Jump to message](%s)", link))
+	}
+	return view.String(), nil
+}
+
+func contextLine(marker string, msg database.Message) string {
+	return fmt.Sprintf("%s %s • %s: %s\n", marker, getDisplayName(msg.Username), msg.Timestamp.Format("15:04"), truncateText(msg.Text, 200))
+}
+
+func containsMessage(messages []database.Message, id int64) bool {
+	for _, msg := range messages {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
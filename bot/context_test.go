@@ -0,0 +1,92 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"semantic-search-bot/search"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestContextView(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup", UserName: "teamchat"}
+	start := time.Now().Add(-time.Hour)
+	for i := 1; i <= 9; i++ {
+		message := &tgbotapi.Message{
+			MessageID: i,
+			From:      &tgbotapi.User{ID: 1, UserName: "alice"},
+			Chat:      chat,
+			Date:      int(start.Add(time.Duration(i) * time.Minute).Unix()),
+			Text:      fmt.Sprintf("message number %d", i),
+		}
+		if i == 6 {
+			message.ReplyToMessage = &tgbotapi.Message{MessageID: 1}
+		}
+		b.handleMessage(ctx, message)
+	}
+
+	stored, err := b.db.GetMessageByTelegramID(ctx, chat.ID, 6)
+	if err != nil || stored == nil {
+		t.Fatalf("GetMessageByTelegramID failed: %v", err)
+	}
+	if stored.ReplyToMessageID != 1 {
+		t.Fatalf("Expected the reply to message 1 to be stored, got %d", stored.ReplyToMessageID)
+	}
+
+	view, err := b.contextView(ctx, *stored, chat.UserName)
+	if err != nil {
+		t.Fatalf("contextView failed: %v", err)
+	}
+
+	if !strings.Contains(view, "↩️ *In reply to* alice") || !strings.Contains(view, "message number 1\n") {
+		t.Errorf("Expected the reply parent, got:\n%s", view)
+	}
+	for i := 3; i <= 9; i++ {
+		if !strings.Contains(view, fmt.Sprintf("message number %d\n", i)) {
+			t.Errorf("Expected message %d around message 6, got:\n%s", i, view)
+		}
+	}
+	if strings.Contains(view, "message number 2") {
+		t.Errorf("Expected only %d messages before, got:\n%s", contextRadius, view)
+	}
+	if !strings.Contains(view, "👉 alice") || !strings.Contains(view, "https://t.me/teamchat/6") {
+		t.Errorf("Expected message 6 marked and linked, got:\n%s", view)
+	}
+}
+
+func TestResultsKeyboardContextButtons(t *testing.T) {
+	b := newTestBot(t)
+
+	results := make([]search.SearchResult, 2)
+	for i := range results {
+		results[i].Message.ID = int64(i + 10)
+		results[i].Message.TelegramMessageID = i + 1
+		results[i].Rank = i + 1
+	}
+
+	keyboard := b.resultsKeyboard("abc", resultPage{offset: 0, size: 2}, results, 2, -100123, "teamchat", -100123)
+	if keyboard == nil || len(keyboard.InlineKeyboard) != 1 {
+		t.Fatalf("Expected a single row of context buttons, got %+v", keyboard)
+	}
+	if data := *keyboard.InlineKeyboard[0][1].CallbackData; data != "ctx:11" {
+		t.Errorf("Expected the second button to show the context of message 11, got %q", data)
+	}
+
+	// Chats without links get jump buttons above
+	keyboard = b.resultsKeyboard("abc", resultPage{offset: 0, size: 2}, results, 2, -4567, "", -4567)
+	if len(keyboard.InlineKeyboard) != 2 || !strings.HasPrefix(*keyboard.InlineKeyboard[0][0].CallbackData, jumpCallbackPrefix) {
+		t.Errorf("Expected jump and context rows, got %+v", keyboard.InlineKeyboard)
+	}
+
+	// Results sent privately can't jump into the group
+	keyboard = b.resultsKeyboard("abc", resultPage{offset: 0, size: 2}, results, 2, -4567, "", 42)
+	if len(keyboard.InlineKeyboard) != 1 || strings.HasPrefix(*keyboard.InlineKeyboard[0][0].CallbackData, jumpCallbackPrefix) {
+		t.Errorf("Expected only context buttons in a private chat, got %+v", keyboard.InlineKeyboard)
+	}
+}
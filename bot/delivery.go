@@ -0,0 +1,192 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"semantic-search-bot/database"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// searchDelivery is where the replies to a /search go: the chat it was sent
+// in, or the requester's private chat so groups only see a short notice
+type searchDelivery struct {
+	message     *tgbotapi.Message
+	private     bool
+	placeholder int // notice left in the group, removed once the reply is sent privately
+}
+
+// chatID returns the chat the replies are posted in. A user's private chat
+// has the same ID as the user.
+func (d searchDelivery) chatID() int64 {
+	if d.private {
+		return d.message.From.ID
+	}
+	return d.message.Chat.ID
+}
+
+// privateResults reports whether the replies to a search sent in a group go
+// to the requester's private chat, as asked with --private or set for the
+// chat with /privateresults
+func (b *Bot) privateResults(ctx context.Context, message *tgbotapi.Message, flags searchFlags) bool {
+	if message.Chat.IsPrivate() || message.From == nil {
+		return false
+	}
+	if flags.private {
+		return true
+	}
+
+	enabled, err := b.db.GetPrivateResults(ctx, message.Chat.ID)
+	if err != nil {
+		log.Printf("Error reading private results setting: %v", err)
+		return false
+	}
+	return enabled
+}
+
+// startSearch posts the "searching" notice. Private searches leave a notice
+// without the query, so the group doesn't learn what was searched for.
+func (b *Bot) startSearch(message *tgbotapi.Message, query, notice string, private bool) searchDelivery {
+	delivery := searchDelivery{message: message, private: private}
+	if !private {
+		b.sendReply(message, fmt.Sprintf("🔍 *Searching for:* \"%s\"\n⏳ *Let me find the most relevant conversations...*%s", query, notice))
+		return delivery
+	}
+
+	reply := tgbotapi.NewMessage(message.Chat.ID, "🔍 *Searching...*\n📬 I'll send the results to you in a private chat.")
+	reply.ParseMode = "Markdown"
+	reply.ReplyToMessageID = message.MessageID
+	sent, err := b.api.Send(reply)
+	if err != nil {
+		log.Printf("Error sending message: %v", err)
+		return delivery
+	}
+	delivery.placeholder = sent.MessageID
+	return delivery
+}
+
+// replyToSearch sends a search reply where the search asked for. When the
+// requester hasn't started a chat with the bot the group notice turns into a
+// link to do so, on other failures into an error; otherwise it is deleted
+// once the reply arrives.
+func (b *Bot) replyToSearch(delivery searchDelivery, text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	if !delivery.private {
+		b.sendReplyWithKeyboard(delivery.message, text, keyboard)
+		return
+	}
+
+	msg := tgbotapi.NewMessage(delivery.chatID(), text)
+	msg.ParseMode = "Markdown"
+	msg.DisableWebPagePreview = true
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Error sending search results to user %d: %v", delivery.chatID(), err)
+		notice := "❌ I couldn't send you the results privately right now. Please try again."
+		// Telegram answers 403 when the user never started the bot or blocked it
+		var apiErr *tgbotapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusForbidden {
+			notice = fmt.Sprintf("📭 I can't message you privately yet. Please [start a chat with me](https://t.me/%s?start=search) and search again.",
+				b.api.Self.UserName)
+		}
+		b.updateSearchNotice(delivery, notice)
+		return
+	}
+
+	if delivery.placeholder != 0 {
+		if _, err := b.api.Request(tgbotapi.NewDeleteMessage(delivery.message.Chat.ID, delivery.placeholder)); err != nil {
+			log.Printf("Error deleting search notice: %v", err)
+		}
+	}
+}
+
+// updateSearchNotice replaces the group notice of a private search with text,
+// replying instead when there is no notice or it can't be edited
+func (b *Bot) updateSearchNotice(delivery searchDelivery, text string) {
+	if delivery.placeholder == 0 {
+		b.sendReply(delivery.message, text)
+		return
+	}
+
+	edit := tgbotapi.NewEditMessageText(delivery.message.Chat.ID, delivery.placeholder, text)
+	edit.ParseMode = "Markdown"
+	edit.DisableWebPagePreview = true
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Error editing search notice: %v", err)
+		b.sendReply(delivery.message, text)
+	}
+}
+
+// viewableFrom reports whether the stored message may be shown in the chat
+// a button was pressed in: its own chat, or the private chat of a member who
+// was sent results from it
+func (b *Bot) viewableFrom(query *tgbotapi.CallbackQuery, msg database.Message) bool {
+	chat := query.Message.Chat
+	if msg.ChatID == chat.ID {
+		return true
+	}
+	return chat.IsPrivate() && query.From != nil && b.isChatMember(msg.ChatID, query.From.ID)
+}
+
+// handlePrivateResultsCommand shows or, for admins, changes whether search
+// results in the chat are sent to the requester privately
+func (b *Bot) handlePrivateResultsCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if message.Chat.IsPrivate() {
+		b.sendReply(message, "💬 Search results are already private here. Use /privateresults in a group.")
+		return
+	}
+
+	if strings.TrimSpace(args) == "" {
+		enabled, err := b.db.GetPrivateResults(ctx, message.Chat.ID)
+		if err != nil {
+			log.Printf("Error reading private results setting: %v", err)
+			b.sendReply(message, "❌ I couldn't read the setting right now. Please try again.")
+			return
+		}
+
+		b.sendReply(message, fmt.Sprintf(`📬 *Search results:* %s
+
+*Admins can change it:*
+• `+"`/privateresults on`"+` - send every /search result list to the person who searched
+• `+"`/privateresults off`"+` - post results here
+
+Anyone can get their own results privately with `+"`/search --private <query>`"+`.`, describePrivateResults(enabled)))
+		return
+	}
+
+	if !b.requireAdmin(message) {
+		return
+	}
+
+	var enabled bool
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		b.sendReply(message, "❌ Expected on or off\n\n💡 *Try:* `/privateresults on`")
+		return
+	}
+
+	if err := b.db.SetPrivateResults(ctx, message.Chat.ID, enabled); err != nil {
+		log.Printf("Error saving private results setting: %v", err)
+		b.sendReply(message, "❌ I couldn't save the setting right now. Please try again.")
+		return
+	}
+
+	b.sendReply(message, fmt.Sprintf("✅ *Search results:* %s", describePrivateResults(enabled)))
+}
+
+func describePrivateResults(enabled bool) string {
+	if enabled {
+		return "sent privately"
+	}
+	return "posted in this chat"
+}
@@ -0,0 +1,191 @@
+package bot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"semantic-search-bot/database"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestPrivateResults(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	alice := &tgbotapi.User{ID: 1, UserName: "alice"}
+	group := &tgbotapi.Chat{ID: -1001, Type: "supergroup"}
+	message := &tgbotapi.Message{MessageID: 5, From: alice, Chat: group}
+
+	flags, query, err := parseSearchFlags("--private deploy plan")
+	if err != nil || !flags.private || query != "deploy plan" {
+		t.Fatalf("Expected --private to be parsed, got %+v %q (%v)", flags, query, err)
+	}
+
+	if b.privateResults(ctx, message, searchFlags{}) {
+		t.Error("Expected results in the group by default")
+	}
+	if !b.privateResults(ctx, message, flags) {
+		t.Error("Expected --private to send results privately")
+	}
+
+	if err := b.db.SetPrivateResults(ctx, group.ID, true); err != nil {
+		t.Fatalf("SetPrivateResults failed: %v", err)
+	}
+	if !b.privateResults(ctx, message, searchFlags{}) {
+		t.Error("Expected the chat setting to send results privately")
+	}
+
+	// Searches in a private chat are already private
+	direct := &tgbotapi.Message{MessageID: 6, From: alice, Chat: &tgbotapi.Chat{ID: alice.ID, Type: "private"}}
+	if b.privateResults(ctx, direct, flags) {
+		t.Error("Expected no private delivery from a private chat")
+	}
+
+	delivery := searchDelivery{message: message, private: true}
+	if delivery.chatID() != alice.ID {
+		t.Errorf("Expected delivery to the requester, got %d", delivery.chatID())
+	}
+	if delivery = (searchDelivery{message: message}); delivery.chatID() != group.ID {
+		t.Errorf("Expected delivery to the group, got %d", delivery.chatID())
+	}
+}
+
+func TestViewableFrom(t *testing.T) {
+	b := newTestBot(t)
+
+	alice := &tgbotapi.User{ID: 1, UserName: "alice"}
+	bob := &tgbotapi.User{ID: 2, UserName: "bob"}
+	msg := database.Message{ChatID: -1001}
+	b.access.setMember(-1001, alice.ID, true)
+	b.access.setMember(-1001, bob.ID, false)
+
+	pressed := func(from *tgbotapi.User, chat *tgbotapi.Chat) *tgbotapi.CallbackQuery {
+		return &tgbotapi.CallbackQuery{From: from, Message: &tgbotapi.Message{Chat: chat}}
+	}
+
+	if !b.viewableFrom(pressed(bob, &tgbotapi.Chat{ID: -1001, Type: "supergroup"}), msg) {
+		t.Error("Expected messages to be viewable in their own chat")
+	}
+	if !b.viewableFrom(pressed(alice, &tgbotapi.Chat{ID: alice.ID, Type: "private"}), msg) {
+		t.Error("Expected a member to view the message privately")
+	}
+	if b.viewableFrom(pressed(bob, &tgbotapi.Chat{ID: bob.ID, Type: "private"}), msg) {
+		t.Error("Expected a non-member not to view the message")
+	}
+	if b.viewableFrom(pressed(alice, &tgbotapi.Chat{ID: -1002, Type: "supergroup"}), msg) {
+		t.Error("Expected the message not to be viewable in another group")
+	}
+}
+
+// fakeTelegram answers Bot API calls, failing sendMessage to chats listed in
+// failures with the given JSON response, and records every call made
+type fakeTelegram struct {
+	failures map[string]string
+	calls    []telegramCall
+}
+
+type telegramCall struct {
+	method string
+	params url.Values
+}
+
+func (f *fakeTelegram) Do(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	params, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	method := path.Base(req.URL.Path)
+	f.calls = append(f.calls, telegramCall{method: method, params: params})
+
+	response := `{"ok":true,"result":{"message_id":100,"date":0,"chat":{"id":1,"type":"private"}}}`
+	switch method {
+	case "getMe":
+		response = `{"ok":true,"result":{"id":42,"is_bot":true,"first_name":"Search","username":"searchbot"}}`
+	case "deleteMessage":
+		response = `{"ok":true,"result":true}`
+	case "sendMessage":
+		if failure, ok := f.failures[params.Get("chat_id")]; ok {
+			response = failure
+		}
+	}
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Body:       io.NopCloser(strings.NewReader(response)),
+		Header:     make(http.Header),
+	}, nil
+}
+
+func (f *fakeTelegram) last(method string) (telegramCall, bool) {
+	for i := len(f.calls) - 1; i >= 0; i-- {
+		if f.calls[i].method == method {
+			return f.calls[i], true
+		}
+	}
+	return telegramCall{}, false
+}
+
+func TestReplyToSearchPrivately(t *testing.T) {
+	group := &tgbotapi.Chat{ID: -1001, Type: "supergroup"}
+	tests := []struct {
+		name    string
+		failure string
+		notice  string // expected edit of the group notice, empty if deleted
+	}{
+		{name: "delivered"},
+		{
+			name:    "bot not started",
+			failure: `{"ok":false,"error_code":403,"description":"Forbidden: bot can't initiate conversation with a user"}`,
+			notice:  "https://t.me/searchbot?start=search",
+		},
+		{
+			name:    "other failure",
+			failure: `{"ok":false,"error_code":400,"description":"Bad Request: can't parse entities"}`,
+			notice:  "couldn't send you the results privately",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBot(t)
+			fake := &fakeTelegram{failures: map[string]string{}}
+			if tt.failure != "" {
+				fake.failures["1"] = tt.failure
+			}
+			api, err := tgbotapi.NewBotAPIWithClient("123:token", tgbotapi.APIEndpoint, fake)
+			if err != nil {
+				t.Fatalf("NewBotAPIWithClient failed: %v", err)
+			}
+			b.api = api
+
+			message := &tgbotapi.Message{MessageID: 5, From: &tgbotapi.User{ID: 1}, Chat: group}
+			b.replyToSearch(searchDelivery{message: message, private: true, placeholder: 7}, "results", nil)
+
+			edit, edited := fake.last("editMessageText")
+			_, deleted := fake.last("deleteMessage")
+			if tt.notice == "" {
+				if !deleted || edited {
+					t.Fatalf("Expected the group notice to be deleted, got calls %+v", fake.calls)
+				}
+				return
+			}
+			if deleted || !edited {
+				t.Fatalf("Expected the group notice to be edited, got calls %+v", fake.calls)
+			}
+			if edit.params.Get("chat_id") != "-1001" || edit.params.Get("message_id") != "7" {
+				t.Errorf("Expected the group notice to be edited, got %v", edit.params)
+			}
+			if text := edit.params.Get("text"); !strings.Contains(text, tt.notice) {
+				t.Errorf("Expected notice to contain %q, got %q", tt.notice, text)
+			}
+		})
+	}
+}
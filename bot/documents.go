@@ -0,0 +1,108 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"semantic-search-bot/database"
+	"semantic-search-bot/document"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// ingestDocument downloads a PDF, text or source file attached to a stored
+// message and indexes its text along with the message. Files over the
+// configured size, or of other types, are only searchable by name and
+// caption.
+func (b *Bot) ingestDocument(ctx context.Context, messageID int64, doc *tgbotapi.Document) {
+	limit := int64(b.config.DocumentMaxSize) << 20
+	if limit == 0 || !document.Supported(doc.FileName, doc.MimeType) {
+		return
+	}
+	if int64(doc.FileSize) > limit {
+		log.Printf("Skipping text of %s: %d bytes exceeds the %d MB limit", doc.FileName, doc.FileSize, b.config.DocumentMaxSize)
+		return
+	}
+
+	data, err := b.downloadFile(ctx, doc.FileID, limit)
+	if err != nil {
+		log.Printf("Error downloading %s: %v", doc.FileName, err)
+		return
+	}
+	b.saveDocument(ctx, messageID, doc, data)
+}
+
+// saveDocument extracts the text of a downloaded file and queues it to be
+// embedded with its message
+func (b *Bot) saveDocument(ctx context.Context, messageID int64, doc *tgbotapi.Document, data []byte) {
+	pages, err := document.Extract(doc.FileName, doc.MimeType, data)
+	if errors.Is(err, document.ErrUnsupported) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error extracting text from %s: %v", doc.FileName, err)
+		return
+	}
+	if len(pages) == 0 {
+		return
+	}
+
+	stored := make([]database.DocumentPage, len(pages))
+	for i, page := range pages {
+		stored[i] = database.DocumentPage{Page: page.Number, Text: page.Text}
+	}
+	if err := b.db.SaveDocumentPages(ctx, messageID, stored, time.Now()); err != nil {
+		log.Printf("Error saving text of %s: %v", doc.FileName, err)
+		return
+	}
+	b.queue.Notify()
+
+	log.Printf("📄 Extracted %d pages of text from %s", len(pages), doc.FileName)
+}
+
+// downloadFile fetches a file through the Bot API, reading at most limit
+// bytes. File URLs contain the bot token, so they are kept out of errors.
+func (b *Bot) downloadFile(ctx context.Context, fileID string, limit int64) ([]byte, error) {
+	fileURL, err := b.api.GetFileDirectURL(fileID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", withoutURL(err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", withoutURL(err))
+	}
+	resp, err := b.api.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", withoutURL(err))
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("file exceeds %d bytes", limit)
+	}
+	return data, nil
+}
+
+// withoutURL drops the request URL from an HTTP client error, since Bot API
+// URLs contain the bot token
+func withoutURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return fmt.Errorf("%s: %w", urlErr.Op, urlErr.Err)
+	}
+	return err
+}
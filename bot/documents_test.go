@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"semantic-search-bot/database"
+	"semantic-search-bot/search"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestDocumentTextSearch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	doc := &tgbotapi.Document{FileID: "f", FileName: "deploy-notes.md", MimeType: "text/markdown"}
+	b.handleMessage(ctx, &tgbotapi.Message{
+		MessageID: 1, From: &tgbotapi.User{ID: 1, UserName: "alice"}, Chat: chat, Date: int(time.Now().Unix()),
+		Document: doc, Caption: "notes from the release",
+	})
+	b.handleMessage(ctx, &tgbotapi.Message{
+		MessageID: 2, From: &tgbotapi.User{ID: 2, UserName: "bob"}, Chat: chat, Date: int(time.Now().Unix()),
+		Text: "Anyone up for pizza on Friday?",
+	})
+
+	stored, _ := b.db.GetMessageByTelegramID(ctx, chat.ID, 1)
+	if stored == nil {
+		t.Fatal("Expected the document message to be stored")
+	}
+
+	var lines []string
+	for i := 0; i < 60; i++ {
+		lines = append(lines, fmt.Sprintf("- Step %d: check the dashboard and note the queue depth for shard %d.", i, i))
+	}
+	lines[40] = "- Step 40: rotate the kafka broker certificate through vault before restarting."
+	b.saveDocument(ctx, stored.ID, doc, []byte("# Deploy notes\n\n"+strings.Join(lines, "\n")))
+	drainQueue(t, b)
+
+	results, err := b.search.Search(ctx, "rotate kafka broker certificate vault", chat.ID, search.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 || results[0].Message.TelegramMessageID != 1 {
+		t.Fatalf("Expected the document first, got %+v", results)
+	}
+	if results[0].PassageSource != database.ChunkFromDocument || !strings.Contains(results[0].Passage, lines[40][2:]) {
+		t.Errorf("Expected the passage from the file, got %q (%s)", results[0].Passage, results[0].PassageSource)
+	}
+
+	formatted := b.formatSearchResults("kafka certificate", search.ModeSemantic, results, len(results), time.Millisecond, "")
+	if !strings.Contains(formatted, "📄 deploy-notes.md notes from the release") || !strings.Contains(formatted, "📖 ") {
+		t.Errorf("Expected the file and its matching passage, got:\n%s", formatted)
+	}
+
+	results[0].PassagePage = 3
+	formatted = b.formatSearchResults("kafka certificate", search.ModeSemantic, results, len(results), time.Millisecond, "")
+	if !strings.Contains(formatted, "📖 _Page 3:_") {
+		t.Errorf("Expected the page of the passage, got:\n%s", formatted)
+	}
+
+	// Editing the caption keeps the file text searchable
+	b.handleEditedMessage(ctx, &tgbotapi.Message{
+		MessageID: 1, From: &tgbotapi.User{ID: 1, UserName: "alice"}, Chat: chat, Date: int(time.Now().Unix()),
+		Document: doc, Caption: "final notes from the release",
+	})
+	drainQueue(t, b)
+	results, _ = b.search.Search(ctx, "rotate kafka broker certificate vault", chat.ID, search.SearchOptions{})
+	if len(results) == 0 || results[0].PassageSource != database.ChunkFromDocument {
+		t.Errorf("Expected the file text after editing the caption, got %+v", results)
+	}
+}
+
+func TestWithoutURLHidesToken(t *testing.T) {
+	// Nothing listens on port 1, so the request fails with the URL in the error
+	_, err := http.Get("http://127.0.0.1:1/file/bot123456:SECRET/documents/file_1.pdf")
+	if err == nil || !strings.Contains(err.Error(), "SECRET") {
+		t.Fatalf("Expected a client error naming the URL, got %v", err)
+	}
+
+	wrapped := fmt.Errorf("failed to download file: %w", withoutURL(err))
+	if strings.Contains(wrapped.Error(), "SECRET") || strings.Contains(wrapped.Error(), "/file/bot") {
+		t.Errorf("Expected the URL to be removed, got %q", wrapped)
+	}
+	if !strings.Contains(wrapped.Error(), "Get") {
+		t.Errorf("Expected the failed operation to stay, got %q", wrapped)
+	}
+
+	other := errors.New("file exceeds 10 bytes")
+	if withoutURL(other) != other {
+		t.Error("Expected other errors to be returned unchanged")
+	}
+}
@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleEditedMessage updates the stored copy of an edited message in place,
+// keeping the previous version in the edit history
+func (b *Bot) handleEditedMessage(ctx context.Context, message *tgbotapi.Message) {
+	content, _ := messageContent(message)
+	if content == "" || message.IsCommand() {
+		return
+	}
+
+	existing, err := b.db.GetMessageByTelegramID(ctx, message.Chat.ID, message.MessageID)
+	if err != nil {
+		log.Printf("Error looking up edited message %d: %v", message.MessageID, err)
+		return
+	}
+
+	// Messages that were never stored (e.g. too short before the edit) are
+	// treated as new
+	if existing == nil {
+		b.storeMessage(ctx, message)
+		return
+	}
+
+	cleanText := b.cleanText(content)
+	if cleanText == existing.Text || len(strings.TrimSpace(cleanText)) < 3 {
+		return
+	}
+
+	editedAt := time.Now()
+	if message.EditDate != 0 {
+		editedAt = time.Unix(int64(message.EditDate), 0)
+	}
+
+	if err := b.db.UpdateMessageText(ctx, existing.ID, cleanText, nil, "", editedAt); err != nil {
+		log.Printf("Error updating edited message %d: %v", existing.ID, err)
+		return
+	}
+
+	// Drop the outdated vector until the embedding queue has the new one
+	b.search.RemoveMessage(existing.ChatID, existing.ID)
+	b.queue.Notify()
+
+	log.Printf("✏️ Updated edited message %d from %s", existing.ID, existing.Username)
+}
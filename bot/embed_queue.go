@@ -0,0 +1,296 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"semantic-search-bot/database"
+	"semantic-search-bot/embedding"
+	"semantic-search-bot/search"
+	"sync"
+	"time"
+)
+
+const (
+	// embeddingPollInterval is how often the queue looks for retries that
+	// became due while it was idle
+	embeddingPollInterval = 5 * time.Second
+	// embeddingLease is how long a claimed job is hidden from other claims
+	embeddingLease = 5 * time.Minute
+	// maxEmbeddingAttempts is how often a job is tried before its message
+	// is left without an embedding
+	maxEmbeddingAttempts = 8
+
+	// maxEmbeddingRequestTexts caps the texts sent in one embedding request
+	maxEmbeddingRequestTexts = 128
+
+	embeddingRetryBase = 5 * time.Second
+	embeddingRetryMax  = 10 * time.Minute
+)
+
+// embeddingQueue embeds stored messages from the pending_embeddings table.
+// A single dispatcher claims due jobs in batches and hands them to a fixed
+// pool of workers; while every worker is busy new jobs wait in the database,
+// so bursts grow the batches instead of the number of requests.
+type embeddingQueue struct {
+	db        *database.DB
+	client    embedding.Embedder
+	search    *search.Engine
+	perf      *PerformanceMonitor
+	workers   int
+	batchSize int
+
+	batches chan []database.EmbeddingJob
+	wake    chan struct{}
+	wg      sync.WaitGroup // dispatcher and workers
+}
+
+func newEmbeddingQueue(db *database.DB, client embedding.Embedder, engine *search.Engine, perf *PerformanceMonitor, workers, batchSize int) *embeddingQueue {
+	return &embeddingQueue{
+		db:        db,
+		client:    client,
+		search:    engine,
+		perf:      perf,
+		workers:   max(workers, 1),
+		batchSize: max(batchSize, 1),
+		batches:   make(chan []database.EmbeddingJob),
+		wake:      make(chan struct{}, 1),
+	}
+}
+
+// Start launches the dispatcher and the worker pool. Once stop is closed
+// the dispatcher claims no more jobs and the workers finish their current
+// batch; canceling ctx aborts those batches too.
+func (q *embeddingQueue) Start(ctx context.Context, stop <-chan struct{}) {
+	q.wg.Add(q.workers + 1)
+	for i := 0; i < q.workers; i++ {
+		go func() {
+			defer q.wg.Done()
+			for jobs := range q.batches {
+				q.process(ctx, jobs)
+			}
+		}()
+	}
+	go func() {
+		defer q.wg.Done()
+		q.dispatch(ctx, stop)
+		close(q.batches)
+	}()
+}
+
+// Wait blocks until the dispatcher and the workers have stopped
+func (q *embeddingQueue) Wait() {
+	q.wg.Wait()
+}
+
+// Notify tells the dispatcher that new jobs were queued
+func (q *embeddingQueue) Notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *embeddingQueue) dispatch(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(embeddingPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		jobs, err := q.db.ClaimEmbeddingJobs(ctx, q.batchSize, time.Now(), embeddingLease)
+		if err != nil {
+			log.Printf("Error claiming embedding jobs: %v", err)
+		}
+
+		if len(jobs) > 0 {
+			// Blocks until a worker is free
+			select {
+			case q.batches <- jobs:
+			case <-stop:
+				q.release(ctx, jobs)
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// process embeds a batch and stores the results. Long messages are
+// embedded in chunks, the mean of which stands for the whole message; the
+// text of attached files is chunked as well but only searched by passage.
+func (q *embeddingQueue) process(ctx context.Context, jobs []database.EmbeddingJob) {
+	var texts []string
+	chunks := make([][]string, len(jobs))
+	documents := make([][]database.MessageChunk, len(jobs))
+	for i, job := range jobs {
+		chunks[i] = embedding.SplitChunks(job.Text)
+		if chunks[i] == nil {
+			texts = append(texts, job.Text)
+		} else {
+			texts = append(texts, chunks[i]...)
+		}
+		documents[i] = documentChunks(job.Document)
+		for _, chunk := range documents[i] {
+			texts = append(texts, chunk.Text)
+		}
+	}
+
+	startTime := time.Now()
+	embeddings, err := q.embed(ctx, texts)
+	duration := time.Since(startTime)
+
+	if ctx.Err() != nil {
+		// Shutting down, the jobs are picked up again after a restart
+		q.release(ctx, jobs)
+		return
+	}
+
+	var open *embedding.CircuitOpenError
+	if errors.As(err, &open) {
+		// The service is known to be down, wait for it without using up attempts
+		retryAt := open.RetryAt
+		if earliest := time.Now().Add(embeddingRetryBase); retryAt.Before(earliest) {
+			retryAt = earliest
+		}
+		for _, job := range jobs {
+			if err := q.db.DeferEmbeddingJob(ctx, job.MessageID, retryAt); err != nil {
+				log.Printf("Error deferring embedding job %d: %v", job.MessageID, err)
+			}
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to generate embeddings for %d messages: %v", len(jobs), err)
+		for _, job := range jobs {
+			q.retry(ctx, job, err)
+		}
+		return
+	}
+
+	// Record the per-message cost so the average stays comparable
+	q.perf.RecordEmbeddingTime(duration / time.Duration(len(jobs)))
+
+	next := 0
+	for i, job := range jobs {
+		vector := embeddings[next]
+		var messageChunks []database.MessageChunk
+		if chunks[i] == nil {
+			next++
+		} else {
+			vectors := embeddings[next : next+len(chunks[i])]
+			next += len(chunks[i])
+			vector = embedding.MeanVector(vectors)
+			for j, text := range chunks[i] {
+				messageChunks = append(messageChunks, database.MessageChunk{Text: text, Embedding: vectors[j]})
+			}
+		}
+		for _, chunk := range documents[i] {
+			chunk.Embedding = embeddings[next]
+			next++
+			messageChunks = append(messageChunks, chunk)
+		}
+
+		stored, err := q.db.CompleteEmbeddingJob(ctx, job, vector, messageChunks, q.client.ModelName(), time.Now())
+		if err != nil {
+			log.Printf("Error saving embedding for message %d: %v", job.MessageID, err)
+			continue
+		}
+		if !stored {
+			continue // Edited meanwhile, or staged for a model migration
+		}
+
+		// Make the message searchable right away
+		msg := database.Message{ID: job.MessageID, ChatID: job.ChatID, Embedding: vector, EmbeddingModel: q.client.ModelName()}
+		if err := q.search.IndexMessage(msg); err != nil {
+			log.Printf("Error indexing message %d: %v", job.MessageID, err)
+		}
+		q.search.IndexChunks(messageChunks)
+	}
+
+	log.Printf("✅ Embedded %d messages (%d dims, %v)", len(jobs), len(embeddings[0]), duration)
+}
+
+// embed embeds texts in requests of at most maxEmbeddingRequestTexts, so a
+// batch holding a long document doesn't turn into one huge request
+func (q *embeddingQueue) embed(ctx context.Context, texts []string) ([][]float64, error) {
+	embeddings := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += maxEmbeddingRequestTexts {
+		end := min(start+maxEmbeddingRequestTexts, len(texts))
+		batch, err := q.client.GetEmbeddings(ctx, texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		embeddings = append(embeddings, batch...)
+	}
+	return embeddings, nil
+}
+
+// documentChunks splits the pages of an attached file into chunks, keeping
+// short pages whole
+func documentChunks(pages []database.DocumentPage) []database.MessageChunk {
+	var chunks []database.MessageChunk
+	for _, page := range pages {
+		texts := embedding.SplitChunks(page.Text)
+		if texts == nil {
+			texts = []string{page.Text}
+		}
+		for _, text := range texts {
+			chunks = append(chunks, database.MessageChunk{Source: database.ChunkFromDocument, Page: page.Page, Text: text})
+		}
+	}
+	return chunks
+}
+
+// release returns claimed jobs to the queue right away instead of letting
+// their lease run out
+func (q *embeddingQueue) release(ctx context.Context, jobs []database.EmbeddingJob) {
+	// The jobs must be released even when ctx was canceled
+	ctx = context.WithoutCancel(ctx)
+	for _, job := range jobs {
+		if err := q.db.DeferEmbeddingJob(ctx, job.MessageID, time.Now()); err != nil {
+			log.Printf("Error releasing embedding job %d: %v", job.MessageID, err)
+		}
+	}
+}
+
+// retry schedules another attempt with exponential backoff, or gives up
+// after maxEmbeddingAttempts
+func (q *embeddingQueue) retry(ctx context.Context, job database.EmbeddingJob, cause error) {
+	attempts := job.Attempts + 1
+	if attempts >= maxEmbeddingAttempts {
+		log.Printf("⚠️  Giving up on embedding message %d after %d attempts: %v", job.MessageID, attempts, cause)
+		if err := q.db.DropEmbeddingJob(ctx, job.MessageID); err != nil {
+			log.Printf("Error dropping embedding job %d: %v", job.MessageID, err)
+		}
+		return
+	}
+
+	if err := q.db.RetryEmbeddingJob(ctx, job.MessageID, time.Now().Add(retryDelay(attempts)), cause.Error()); err != nil {
+		log.Printf("Error rescheduling embedding job %d: %v", job.MessageID, err)
+	}
+}
+
+// retryDelay returns the backoff before the next attempt after the given
+// number of failed attempts
+func retryDelay(attempts int) time.Duration {
+	delay := embeddingRetryBase
+	for i := 1; i < attempts && delay < embeddingRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > embeddingRetryMax {
+		delay = embeddingRetryMax
+	}
+	return delay
+}
@@ -0,0 +1,111 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"semantic-search-bot/search"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// parseForgetArgs turns /forget arguments into a deletion filter. It accepts
+// the search date and author operators, and a bare @user as a shorthand for
+// from:@user.
+func parseForgetArgs(args string, now time.Time) (database.MessageFilter, error) {
+	tokens := strings.Fields(args)
+	for i, token := range tokens {
+		if strings.HasPrefix(token, "@") {
+			tokens[i] = "from:" + token
+		}
+	}
+
+	parsed, err := search.ParseQuery(strings.Join(tokens, " "), now)
+	if err != nil {
+		return database.MessageFilter{}, err
+	}
+
+	if text := strings.TrimSpace(parsed.Text); text != "" {
+		return database.MessageFilter{}, fmt.Errorf("unexpected %q, use @user, after:, before: or on:", text)
+	}
+	if parsed.Filter.HasLink {
+		return database.MessageFilter{}, fmt.Errorf("has: filters are not supported by /forget")
+	}
+	if parsed.Filter.IsEmpty() {
+		return database.MessageFilter{}, fmt.Errorf("tell me which messages to forget")
+	}
+
+	return parsed.Filter, nil
+}
+
+// handleForgetCommand lets admins purge stored messages by author, by date
+// range, or by replying to a single message
+func (b *Bot) handleForgetCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if !b.requireAdmin(message) {
+		return
+	}
+
+	if strings.TrimSpace(args) == "" && message.ReplyToMessage != nil {
+		b.forgetRepliedMessage(ctx, message)
+		return
+	}
+
+	if strings.TrimSpace(args) == "" {
+		b.sendReply(message, `🗑️ *Forget Stored Messages*
+
+*Admins can delete what I've stored:*
+• `+"`/forget @alice`"+` - every message by or forwarded from a user
+• `+"`/forget before:2026-01-01`"+` - messages before a date
+• `+"`/forget after:2026-01-01 before:2026-02-01`"+` - a date range
+• `+"`/forget @alice on:yesterday`"+` - combine both
+• Reply to a message with `+"`/forget`"+` - just that message
+
+⚠️ Deleted messages can't be recovered.`)
+		return
+	}
+
+	filter, err := parseForgetArgs(args, time.Now())
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/forget @alice before:30d`", err.Error()))
+		return
+	}
+
+	ids, err := b.db.DeleteMessages(ctx, message.Chat.ID, filter)
+	if err != nil {
+		log.Printf("Error forgetting messages: %v", err)
+		b.sendReply(message, "❌ I couldn't delete those messages right now. Please try again.")
+		return
+	}
+
+	b.forgetIndexed(message.Chat.ID, ids)
+	b.sendReply(message, fmt.Sprintf("🗑️ *Forgot %d message%s.*", len(ids), pluralize(len(ids))))
+	log.Printf("🗑️ Forgot %d messages in chat %d (%s)", len(ids), message.Chat.ID, args)
+}
+
+// forgetRepliedMessage deletes the stored copy of the message being replied to
+func (b *Bot) forgetRepliedMessage(ctx context.Context, message *tgbotapi.Message) {
+	target := message.ReplyToMessage
+
+	stored, err := b.db.GetMessageByTelegramID(ctx, message.Chat.ID, target.MessageID)
+	if err != nil {
+		log.Printf("Error looking up message %d to forget: %v", target.MessageID, err)
+		b.sendReply(message, "❌ I couldn't delete that message right now. Please try again.")
+		return
+	}
+	if stored == nil {
+		b.sendReply(message, "🤷 I haven't stored that message.")
+		return
+	}
+
+	if err := b.db.DeleteMessagesByIDs(ctx, []int64{stored.ID}); err != nil {
+		log.Printf("Error forgetting message %d: %v", stored.ID, err)
+		b.sendReply(message, "❌ I couldn't delete that message right now. Please try again.")
+		return
+	}
+
+	b.forgetIndexed(message.Chat.ID, []int64{stored.ID})
+	b.sendReply(message, "🗑️ *Forgot that message.*")
+}
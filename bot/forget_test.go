@@ -0,0 +1,35 @@
+package bot
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseForgetArgs(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+
+	filter, err := parseForgetArgs("@alice from:@bob before:2026-03-01", now)
+	if err != nil {
+		t.Fatalf("parseForgetArgs failed: %v", err)
+	}
+	if len(filter.Usernames) != 2 || filter.Usernames[0] != "alice" || filter.Usernames[1] != "bob" {
+		t.Errorf("Expected alice and bob, got %v", filter.Usernames)
+	}
+	if !filter.Before.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("Expected before 2026-03-01, got %v", filter.Before)
+	}
+
+	filter, err = parseForgetArgs("after:2026-01-01 before:2026-02-01", now)
+	if err != nil {
+		t.Fatalf("parseForgetArgs failed: %v", err)
+	}
+	if filter.After.IsZero() || filter.Before.IsZero() || len(filter.Usernames) != 0 {
+		t.Errorf("Expected a date range only, got %+v", filter)
+	}
+
+	for _, bad := range []string{"", "everything", "@alice please", "has:link", "before:someday"} {
+		if _, err := parseForgetArgs(bad, now); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
@@ -1,47 +1,99 @@
 package bot
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"semantic-search-bot/database"
+	"semantic-search-bot/embedding"
 	"semantic-search-bot/search"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
-func (b *Bot) handleUpdate(update tgbotapi.Update) {
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
 	// Handle regular messages
 	if update.Message != nil {
-		b.handleMessage(update.Message)
+		b.handleMessage(ctx, update.Message)
 		return
 	}
 
-	// Handle edited messages (optional - treat as new messages)
+	// Handle edited messages by updating the stored copy
 	if update.EditedMessage != nil {
-		b.handleMessage(update.EditedMessage)
+		b.handleEditedMessage(ctx, update.EditedMessage)
+		return
+	}
+
+	// Handle inline keyboard buttons
+	if update.CallbackQuery != nil {
+		b.handleCallbackQuery(ctx, update.CallbackQuery)
+		return
+	}
+
+	// Handle "@bot query" typed in any chat
+	if update.InlineQuery != nil {
+		b.handleInlineQuery(ctx, update.InlineQuery)
 		return
 	}
 }
 
-func (b *Bot) handleMessage(message *tgbotapi.Message) {
-	// Skip empty messages
-	if message.Text == "" {
+func (b *Bot) handleCallbackQuery(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	switch {
+	case strings.HasPrefix(query.Data, pageCallbackPrefix+":"):
+		b.handlePageCallback(query)
+	case strings.HasPrefix(query.Data, jumpCallbackPrefix+":"):
+		b.handleJumpCallback(ctx, query)
+	case strings.HasPrefix(query.Data, contextCallbackPrefix+":"):
+		b.handleContextCallback(ctx, query)
+	case strings.HasPrefix(query.Data, forgetMeCallbackPrefix+":"):
+		b.handleForgetMeCallback(ctx, query)
+	default:
+		b.answerCallback(query, "")
+	}
+}
+
+func (b *Bot) handlePageCallback(query *tgbotapi.CallbackQuery) {
+	cacheID, page, err := parsePageCallback(query.Data)
+	if err != nil || query.Message == nil {
+		b.answerCallback(query, "")
 		return
 	}
 
+	entry, ok := b.results.get(cacheID)
+	if !ok || entry.deliveredTo != query.Message.Chat.ID {
+		b.answerCallback(query, "⌛ These results have expired. Please run /search again.")
+		return
+	}
+
+	pageResults := page.slice(entry.results)
+	text := b.formatSearchResults(entry.query, entry.mode, pageResults, len(entry.results), entry.duration, entry.chatUsername)
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	edit.DisableWebPagePreview = true
+	edit.ReplyMarkup = b.resultsKeyboard(cacheID, page, pageResults, len(entry.results), entry.chatID, entry.chatUsername, entry.deliveredTo)
+
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Error editing search results: %v", err)
+	}
+	b.answerCallback(query, "")
+}
+
+func (b *Bot) handleMessage(ctx context.Context, message *tgbotapi.Message) {
 	// Handle commands
 	if message.IsCommand() {
-		b.handleCommand(message)
+		b.handleCommand(ctx, message)
 		return
 	}
 
-	// Store regular messages
-	b.storeMessage(message)
+	// Store regular messages, media with captions, documents and polls.
+	// Messages without any text are skipped there.
+	b.storeMessage(ctx, message)
 }
 
-func (b *Bot) handleCommand(message *tgbotapi.Message) {
+func (b *Bot) handleCommand(ctx context.Context, message *tgbotapi.Message) {
 	command := message.Command()
 	args := message.CommandArguments()
 
@@ -51,13 +103,31 @@ func (b *Bot) handleCommand(message *tgbotapi.Message) {
 	case "help":
 		b.handleHelpCommand(message)
 	case "stats":
-		b.handleStatsCommand(message)
+		b.handleStatsCommand(ctx, message)
 	case "test":
-		b.handleTestCommand(message)
+		b.handleTestCommand(ctx, message)
 	case "perf":
-		b.handlePerfCommand(message)
+		b.handlePerfCommand(ctx, message)
 	case "search":
-		b.handleSearchCommand(message, args)
+		b.handleSearchCommand(ctx, message, args)
+	case "searchall":
+		b.handleSearchAllCommand(ctx, message, args)
+	case "crosschat":
+		b.handleCrossChatCommand(ctx, message, args)
+	case "privateresults":
+		b.handlePrivateResultsCommand(ctx, message, args)
+	case "context":
+		b.handleContextCommand(ctx, message, args)
+	case "forget":
+		b.handleForgetCommand(ctx, message, args)
+	case "retention":
+		b.handleRetentionCommand(ctx, message, args)
+	case "reindex":
+		b.handleReindexCommand(ctx, message, args)
+	case "mydata":
+		b.handleMyDataCommand(ctx, message)
+	case "forgetme":
+		b.handleForgetMeCommand(ctx, message)
 	default:
 		b.sendReply(message, fmt.Sprintf("Unknown command: /%s", command))
 	}
@@ -122,17 +192,30 @@ I'm an AI that understands the *meaning* behind your words, not just exact match
 
 🛠️ *Available Commands:*
 • ` + "`/search <your question>`" + ` - Find relevant conversations
+• ` + "`/search --mode=hybrid <query>`" + ` - Also match exact words like ticket numbers
+• ` + "`/search from:@alice after:7d <query>`" + ` - Filter by author, date or has:link
+• ` + "`/context`" + ` - Reply to a message to see the conversation around it
+• ` + "`/searchall <query>`" + ` - In a private chat: search all your chats at once
+• ` + "`@bot <query>`" + ` - Search all your chats from any chat
+• ` + "`/crosschat off`" + ` - Admins: keep this chat out of searches from other chats
+• ` + "`/search --private <query>`" + ` - Get the results in a private chat
+• ` + "`/privateresults on`" + ` - Admins: send everyone's results privately
 • ` + "`/stats`" + ` - See my learning progress  
 • ` + "`/test`" + ` - Check if my AI brain is working
 • ` + "`/perf`" + ` - View performance metrics
+• ` + "`/retention`" + ` - See how long messages are kept
+• ` + "`/forget @alice`" + ` - Admins: delete stored messages by user, date or reply
+• ` + "`/reindex`" + ` - Admins: embed messages that are still missing an embedding
+• ` + "`/mydata`" + ` - Get a copy of everything I've stored about you
+• ` + "`/forgetme`" + ` - Delete all your stored messages
 
 *Happy searching!* 🚀`
 
 	b.sendReply(message, helpText)
 }
 
-func (b *Bot) handleStatsCommand(message *tgbotapi.Message) {
-	count, err := b.db.GetStats(message.Chat.ID)
+func (b *Bot) handleStatsCommand(ctx context.Context, message *tgbotapi.Message) {
+	count, err := b.db.GetStats(ctx, message.Chat.ID)
 	if err != nil {
 		log.Printf("Error getting stats: %v", err)
 		b.sendReply(message, "❌ Oops! I couldn't retrieve the statistics right now. Please try again.")
@@ -140,7 +223,7 @@ func (b *Bot) handleStatsCommand(message *tgbotapi.Message) {
 	}
 
 	// Count messages with embeddings
-	countWithEmbeddings, err := b.db.GetStatsWithEmbeddings(message.Chat.ID)
+	countWithEmbeddings, err := b.db.GetStatsWithEmbeddings(ctx, message.Chat.ID)
 	if err != nil {
 		log.Printf("Error getting embedding stats: %v", err)
 		countWithEmbeddings = 0
@@ -188,7 +271,7 @@ func (b *Bot) handleStatsCommand(message *tgbotapi.Message) {
 		statusEmoji,
 		statusText,
 		getSearchQualityTips(countWithEmbeddings),
-		b.config.EmbeddingModel,
+		b.describeEmbeddingModel(ctx, message.Chat.ID, count),
 		message.Chat.ID)
 
 	b.sendReply(message, statsText)
@@ -208,32 +291,27 @@ func getSearchQualityTips(embeddingCount int) string {
 	}
 }
 
-func (b *Bot) handleTestCommand(message *tgbotapi.Message) {
+func (b *Bot) handleTestCommand(ctx context.Context, message *tgbotapi.Message) {
 	b.sendReply(message, "🧪 *Testing My AI Brain...*")
 
-	// Test embedding generation
+	// Test embedding generation, bypassing the cache and the circuit breaker
+	// so the service is reached
 	testText := "Testing AI connection for semantic understanding"
 	startTime := time.Now()
-	embedding, err := b.embedding.GetEmbedding(testText)
+	vector, err := b.breaker.Unwrap().GetEmbedding(ctx, testText)
 	testDuration := time.Since(startTime)
+	health := formatEmbeddingHealth(b.breaker.Health())
 
 	if err != nil {
 		errorMsg := fmt.Sprintf(`❌ *AI Connection Failed*
 
 *Problem:* %s
+*Health:* %s
 
-🔧 *How to Fix:*
-1️⃣ Make sure Ollama is running: `+"`ollama serve`"+`
-2️⃣ Install the AI model: `+"`ollama pull %s`"+`
-3️⃣ Check the service: `+"`curl %s/api/tags`"+`
-
-💡 *Need Help?*
-• Restart Ollama service and try again
-• Verify model installation with `+"`ollama list`"+`
-• Check if port 11434 is available
+%s
 
 Once fixed, I'll be ready to understand your conversations!`,
-			err.Error(), b.config.EmbeddingModel, b.config.EmbeddingAPIURL)
+			err.Error(), health, b.embeddingFixSteps())
 
 		b.sendReply(message, errorMsg)
 		return
@@ -263,22 +341,62 @@ Once fixed, I'll be ready to understand your conversations!`,
 • AI dimensions: %d vectors
 • Model: %s
 • Service: %s
+• Health: %s
 
 🎯 *What this means:*
 I can understand the meaning behind your messages and find relevant conversations when you search!
 
 *Ready to help you explore your chat history!* 🔍`,
 		testDuration, performanceEmoji, performanceText,
-		len(embedding),
+		len(vector),
 		b.config.EmbeddingModel,
-		b.config.EmbeddingAPIURL)
+		b.config.EmbeddingAPIURL,
+		health)
 
 	b.sendReply(message, successMsg)
 }
 
-func (b *Bot) handlePerfCommand(message *tgbotapi.Message) {
+// embeddingFixSteps explains how to get the configured embedding provider
+// working, for /test
+func (b *Bot) embeddingFixSteps() string {
+	switch b.config.EmbeddingProvider {
+	case embedding.ProviderHashing:
+		return `🔧 *How to Fix:*
+The offline embedder doesn't need any service. Check the bot logs for details.`
+	case embedding.ProviderOpenAI:
+		return fmt.Sprintf(`🔧 *How to Fix:*
+1️⃣ Make sure the embedding server is running at %s
+2️⃣ Check that it serves the model: %s
+3️⃣ Check the service: `+"`curl %s/v1/models`"+`
+
+💡 *Need Help?*
+• Set `+"`EMBEDDING_API_KEY`"+` if the server requires one
+• Restart the embedding server and try again`,
+			b.config.EmbeddingAPIURL, b.config.EmbeddingModel, b.config.EmbeddingAPIURL)
+	}
+
+	return fmt.Sprintf(`🔧 *How to Fix:*
+1️⃣ Make sure Ollama is running: `+"`ollama serve`"+`
+2️⃣ Install the AI model: `+"`ollama pull %s`"+`
+3️⃣ Check the service: `+"`curl %s/api/tags`"+`
+
+💡 *Need Help?*
+• Restart Ollama service and try again
+• Verify model installation with `+"`ollama list`"+`
+• Check if port 11434 is available`,
+		b.config.EmbeddingModel, b.config.EmbeddingAPIURL)
+}
+
+func (b *Bot) handlePerfCommand(ctx context.Context, message *tgbotapi.Message) {
 	searchAvg, embeddingAvg, memUsage := b.perf.GetStats()
 
+	pendingText := "unknown"
+	if pending, err := b.db.PendingEmbeddingCount(ctx); err == nil {
+		pendingText = fmt.Sprintf("%d message%s waiting", pending, pluralize(pending))
+	}
+
+	cacheStats := b.cache.Stats()
+
 	perfMsg := fmt.Sprintf(`⚡ *Performance Dashboard*
 
 🔍 *Search Performance:*
@@ -288,9 +406,17 @@ func (b *Bot) handlePerfCommand(message *tgbotapi.Message) {
 
 🧠 *AI Processing:*
 • Embedding speed: %v  
-• Processing: Background (non-blocking)
+• Processing: Background queue (%d workers, batches of %d)
+• Queue: %s
+• Service health: %s
 • Status: %s
 
+🗃️ *Embedding Cache:*
+• Hit rate: %s
+• Hits: %d in memory, %d from the database
+• Misses: %d sent to the embedding service
+• Entries in memory: %d
+
 💾 *System Health:*
 • Memory usage: %s
 • Optimization: %s
@@ -304,7 +430,14 @@ func (b *Bot) handlePerfCommand(message *tgbotapi.Message) {
 		formatDuration(searchAvg),
 		getPerformanceStatus(searchAvg),
 		formatDuration(embeddingAvg),
+		b.queue.workers, b.queue.batchSize,
+		pendingText,
+		formatEmbeddingHealth(b.breaker.Health()),
 		getEmbeddingStatus(embeddingAvg),
+		formatHitRate(cacheStats),
+		cacheStats.MemoryHits, cacheStats.StoreHits,
+		cacheStats.Misses,
+		cacheStats.Entries,
 		memUsage,
 		getMemoryStatus(memUsage))
 
@@ -321,6 +454,29 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%.1fs", d.Seconds())
 }
 
+// formatEmbeddingHealth describes the circuit breaker state of the
+// embedding service
+func formatEmbeddingHealth(health embedding.BreakerHealth) string {
+	switch health.State {
+	case embedding.BreakerOpen:
+		return fmt.Sprintf("🔴 Unavailable, searching by keywords until %s (%d failures: %s)",
+			health.RetryAt.Format("15:04:05"), health.Failures, health.LastError)
+	case embedding.BreakerHalfOpen:
+		return "🟡 Recovering, probing the service"
+	}
+	if health.Failures > 0 {
+		return fmt.Sprintf("🟡 Available, %d recent failure%s", health.Failures, pluralize(health.Failures))
+	}
+	return "🟢 Available"
+}
+
+func formatHitRate(stats embedding.CacheStats) string {
+	if stats.MemoryHits+stats.StoreHits+stats.Misses == 0 {
+		return "No data yet"
+	}
+	return fmt.Sprintf("%.0f%%", stats.HitRate()*100)
+}
+
 func getEmbeddingStatus(embeddingAvg time.Duration) string {
 	if embeddingAvg == 0 {
 		return "🟡 Waiting for messages"
@@ -342,8 +498,20 @@ func getMemoryStatus(memUsage string) string {
 	}
 }
 
-func (b *Bot) handleSearchCommand(message *tgbotapi.Message, query string) {
-	if strings.TrimSpace(query) == "" {
+func (b *Bot) handleSearchCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	flags, query, err := parseSearchFlags(args)
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/search --mode=hybrid INC-1234`", err.Error()))
+		return
+	}
+
+	parsed, err := search.ParseQuery(query, time.Now())
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/search from:@alice after:7d deploy`", err.Error()))
+		return
+	}
+
+	if strings.TrimSpace(parsed.Text) == "" && parsed.Filter.IsEmpty() {
 		b.sendReply(message, `🔍 *Semantic Search Help*
 
 *How to search:* `+"`/search <your question or keywords>`"+`
@@ -365,20 +533,42 @@ func (b *Bot) handleSearchCommand(message *tgbotapi.Message, query string) {
 • `+"`/search weekend plans`"+`
 • `+"`/search restaurant recommendation`"+`
 
+🔤 *Search Modes:*
+• `+"`/search --mode=hybrid INC-1234`"+` - meaning plus exact keywords
+• `+"`/search --mode=keyword db01.prod`"+` - exact keywords only
+• `+"`/search --history deploy plan`"+` - also match earlier versions of edited messages
+• `+"`/search --private deploy plan`"+` - send the results to you privately
+
+🎛️ *Filters:*
+• `+"`from:@alice`"+` - messages by or forwarded from a user
+• `+"`after:2026-01-01`"+` / `+"`before:2026-02-01`"+` / `+"`on:yesterday`"+`
+• `+"`after:7d`"+` - the last 7 days (also `+"`2w`"+`)
+• `+"`has:link`"+` - messages with a URL
+• `+"`has:photo`"+` / `+"`has:doc`"+` / `+"`has:poll`"+` - photos, files or polls
+Example: `+"`/search from:@alice after:7d deploy`"+`
+
 ✨ *Remember:* I understand meaning, not just exact words! Try natural language like you're asking a friend.
 
 *Ready to explore your chat history?* Just add your question after /search!`)
 		return
 	}
 
+	// Skip the embedding service while it is known to be down
+	notice := b.keywordFallback(&flags)
+
 	// Show searching indicator with friendly message
-	b.sendReply(message, fmt.Sprintf("🔍 *Searching for:* \"%s\"\n⏳ *Let me find the most relevant conversations...*", query))
+	delivery := b.startSearch(message, query, notice, b.privateResults(ctx, message, flags))
 
 	// Start performance timing
 	startTime := time.Now()
 
 	// Perform search
-	results, err := b.search.Search(query, message.Chat.ID)
+	results, err := b.search.Search(ctx, parsed.Text, message.Chat.ID, search.SearchOptions{
+		Mode:         flags.mode,
+		Filter:       parsed.Filter,
+		Limit:        maxCachedResults,
+		IncludeEdits: flags.history,
+	})
 
 	// Record search performance
 	searchDuration := time.Since(startTime)
@@ -386,7 +576,7 @@ func (b *Bot) handleSearchCommand(message *tgbotapi.Message, query string) {
 
 	if err != nil {
 		log.Printf("Search error: %v", err)
-		b.sendReply(message, fmt.Sprintf(`❌ *Search Error*
+		b.replyToSearch(delivery, fmt.Sprintf(`❌ *Search Error*
 
 Something went wrong while searching: %s
 
@@ -395,13 +585,13 @@ Something went wrong while searching: %s
 • Using /test to verify my AI connection  
 • Rephrasing your search query
 
-*I'm ready to help once the issue is resolved!*`, err.Error()))
+*I'm ready to help once the issue is resolved!*`, err.Error()), nil)
 		return
 	}
 
 	// Handle no results with helpful suggestions
 	if len(results) == 0 {
-		totalMessages, withEmbeddings, _ := b.search.SearchStats(message.Chat.ID)
+		totalMessages, withEmbeddings, _ := b.search.SearchStats(ctx, message.Chat.ID)
 
 		var suggestionText string
 		if withEmbeddings < 10 {
@@ -430,19 +620,35 @@ Something went wrong while searching: %s
 *Keep chatting - I get smarter with every message!* 🧠`,
 			query, totalMessages, withEmbeddings, suggestionText)
 
-		b.sendReply(message, noResultsMsg)
+		b.replyToSearch(delivery, noResultsMsg, nil)
 		return
 	}
 
-	// Format and send results with encouraging message
-	resultMsg := b.formatSearchResults(query, results, searchDuration)
-	b.sendReply(message, resultMsg)
-
-	log.Printf("Search completed: query='%s', results=%d, duration=%v, chat=%d",
-		query, len(results), searchDuration, message.Chat.ID)
+	// Keep the full ranking so the page buttons can navigate it
+	cacheID := b.results.put(&cachedSearch{
+		query:        query,
+		mode:         flags.mode,
+		results:      results,
+		duration:     searchDuration,
+		chatID:       message.Chat.ID,
+		chatUsername: message.Chat.UserName,
+		deliveredTo:  delivery.chatID(),
+	})
+
+	// Format and send the first page with navigation buttons
+	page := firstPage(b.config.MaxResults)
+	pageResults := page.slice(results)
+	resultMsg := b.formatSearchResults(query, flags.mode, pageResults, len(results), searchDuration, message.Chat.UserName)
+	b.replyToSearch(delivery, resultMsg,
+		b.resultsKeyboard(cacheID, page, pageResults, len(results), message.Chat.ID, message.Chat.UserName, delivery.chatID()))
+
+	log.Printf("Search completed: query='%s', mode=%s, results=%d, duration=%v, chat=%d, private=%t",
+		query, flags.mode, len(results), searchDuration, message.Chat.ID, delivery.private)
 }
 
-func (b *Bot) formatSearchResults(query string, results []search.SearchResult, searchDuration time.Duration) string {
+// formatSearchResults renders one page of results out of total ranked
+// results, linking each one to the original message when the chat allows it
+func (b *Bot) formatSearchResults(query string, mode search.Mode, results []search.SearchResult, total int, searchDuration time.Duration, chatUsername string) string {
 	var msg strings.Builder
 
 	// Header with performance indicator
@@ -451,8 +657,16 @@ func (b *Bot) formatSearchResults(query string, results []search.SearchResult, s
 		performanceEmoji = "🐌"
 	}
 
-	msg.WriteString(fmt.Sprintf("🎯 *Found %d relevant conversation%s*\n", len(results), pluralize(len(results))))
-	msg.WriteString(fmt.Sprintf("📝 *Search:* \"%s\" | %s *Speed:* %v\n\n", query, performanceEmoji, formatDuration(searchDuration)))
+	msg.WriteString(fmt.Sprintf("🎯 *Found %d relevant conversation%s*", total, pluralize(total)))
+	if len(results) > 0 && len(results) < total {
+		msg.WriteString(fmt.Sprintf(" • showing %d–%d", results[0].Rank, results[len(results)-1].Rank))
+	}
+	msg.WriteString("\n")
+	msg.WriteString(fmt.Sprintf("📝 *Search:* \"%s\" | %s *Speed:* %v", query, performanceEmoji, formatDuration(searchDuration)))
+	if mode != search.ModeSemantic {
+		msg.WriteString(fmt.Sprintf(" | 🔤 *Mode:* %s", mode))
+	}
+	msg.WriteString("\n\n")
 
 	for _, result := range results {
 		// Format timestamp in a more readable way
@@ -483,19 +697,99 @@ func (b *Bot) formatSearchResults(query string, results []search.SearchResult, s
 			similarityEmoji = "📝"
 		}
 
-		msg.WriteString(fmt.Sprintf("*%d.* %s *%.0f%% match*\n",
-			result.Rank, similarityEmoji, similarityPercent))
-		msg.WriteString(fmt.Sprintf("👤 **%s** • 📅 %s\n",
+		if result.Similarity == 0 && !result.KeywordMatch {
+			msg.WriteString(fmt.Sprintf("*%d.* 📌 *filter match*\n", result.Rank))
+		} else if result.Similarity == 0 {
+			msg.WriteString(fmt.Sprintf("*%d.* 🔤 *keyword match*\n", result.Rank))
+		} else if result.KeywordMatch {
+			msg.WriteString(fmt.Sprintf("*%d.* %s *%.0f%% match* • 🔤 keywords\n",
+				result.Rank, similarityEmoji, similarityPercent))
+		} else {
+			msg.WriteString(fmt.Sprintf("*%d.* %s *%.0f%% match*\n",
+				result.Rank, similarityEmoji, similarityPercent))
+		}
+		msg.WriteString(fmt.Sprintf("👤 **%s** • 📅 %s",
 			getDisplayName(result.Message.Username), timeStr))
-		msg.WriteString(fmt.Sprintf("💬 %s\n\n", text))
+		if link := messageLink(result.Message.ChatID, chatUsername, result.Message); link != "" {
+			msg.WriteString(fmt.Sprintf(" • [🔗 Jump](%s)", link))
+		}
+		msg.WriteString("\n")
+		if result.Message.ForwardOrigin != "" {
+			msg.WriteString(fmt.Sprintf("↪️ _Forwarded from %s_\n", result.Message.ForwardOrigin))
+		}
+		if len(result.Snippet) > 0 {
+			msg.WriteString(formatSnippet(result))
+		} else if result.PassageSource == database.ChunkFromDocument {
+			msg.WriteString(fmt.Sprintf("💬 %s%s\n", contentIcon(result.Message.ContentType), text))
+			msg.WriteString(formatDocumentPassage(result))
+		} else if result.Passage != "" {
+			msg.WriteString(fmt.Sprintf("💬 %s%s\n", contentIcon(result.Message.ContentType), formatPassage(result)))
+		} else {
+			msg.WriteString(fmt.Sprintf("💬 %s%s\n", contentIcon(result.Message.ContentType), text))
+		}
+		if result.PriorVersion != "" {
+			msg.WriteString(fmt.Sprintf("✏️ _Matched an earlier version:_ %s\n", truncateText(result.PriorVersion, 100)))
+		}
+		msg.WriteString("\n")
 	}
 
 	// Footer with helpful tips
-	msg.WriteString("💡 *Tips:* Results ranked by relevance • Try different keywords for more results")
+	if len(results) < total {
+		msg.WriteString("💡 *Tips:* Results ranked by relevance • Use the buttons below to see more")
+	} else {
+		msg.WriteString("💡 *Tips:* Results ranked by relevance • Try different keywords for more results")
+	}
 
 	return msg.String()
 }
 
+// formatSnippet renders the conversation window of a result, one line per
+// message, pointing at the line that matched best
+func formatSnippet(result search.SearchResult) string {
+	var snippet strings.Builder
+	for _, line := range result.Snippet {
+		marker := "▫️"
+		if line.ID == result.Message.ID {
+			marker = "👉"
+		}
+		snippet.WriteString(fmt.Sprintf("%s %s: %s\n", marker, getDisplayName(line.Username), truncateText(line.Text, 120)))
+	}
+	return snippet.String()
+}
+
+// formatPassage shows the chunk of a long message that matched, marking
+// where it is cut from the rest of the message. Chunks are longer than the
+// excerpt of a whole message, so more of them is shown.
+func formatPassage(result search.SearchResult) string {
+	passage := truncateText(result.Passage, 300)
+	if !strings.HasPrefix(strings.Join(strings.Fields(result.Message.Text), " "), result.Passage) {
+		passage = "..." + passage
+	}
+	return passage
+}
+
+// formatDocumentPassage shows the part of an attached file that matched,
+// with its page when the file has pages
+func formatDocumentPassage(result search.SearchResult) string {
+	passage := truncateText(strings.Join(strings.Fields(result.Passage), " "), 300)
+	if result.PassagePage > 0 {
+		return fmt.Sprintf("📖 _Page %d:_ %s\n", result.PassagePage, passage)
+	}
+	return fmt.Sprintf("📖 %s\n", passage)
+}
+
+// truncateText shortens text to at most limit bytes on a rune boundary
+func truncateText(text string, limit int) string {
+	if len(text) <= limit {
+		return text
+	}
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(text[cut]) {
+		cut--
+	}
+	return text[:cut] + "..."
+}
+
 func getDisplayName(username string) string {
 	if username == "" {
 		return "Anonymous"
@@ -517,9 +811,11 @@ func min(a, b int) int {
 	return b
 }
 
-func (b *Bot) storeMessage(message *tgbotapi.Message) {
+func (b *Bot) storeMessage(ctx context.Context, message *tgbotapi.Message) {
+	content, contentType := messageContent(message)
+
 	// Clean the message text (basic preprocessing)
-	cleanText := b.cleanText(message.Text)
+	cleanText := b.cleanText(content)
 
 	// Skip very short messages
 	if len(strings.TrimSpace(cleanText)) < 3 {
@@ -528,43 +824,38 @@ func (b *Bot) storeMessage(message *tgbotapi.Message) {
 
 	// Create message object
 	msg := database.Message{
-		ChatID:    message.Chat.ID,
-		UserID:    message.From.ID,
-		Username:  message.From.UserName,
-		Text:      cleanText,
-		Timestamp: time.Unix(int64(message.Date), 0),
+		ChatID:            message.Chat.ID,
+		TelegramMessageID: message.MessageID,
+		ThreadID:          b.threads.threadID(message.Chat.ID, message.MessageID),
+		UserID:            message.From.ID,
+		Username:          message.From.UserName,
+		Text:              cleanText,
+		ContentType:       contentType,
+		ForwardOrigin:     forwardOrigin(message),
+		Timestamp:         time.Unix(int64(message.Date), 0),
 	}
 
-	// Generate embedding asynchronously
-	go func() {
-		startTime := time.Now()
-
-		embedding, err := b.embedding.GetEmbedding(cleanText)
-
-		// Record embedding performance
-		embeddingDuration := time.Since(startTime)
-		b.perf.RecordEmbeddingTime(embeddingDuration)
+	// Messages in forum topics reply to the topic's first message implicitly
+	if parent := message.ReplyToMessage; parent != nil && parent.MessageID != msg.ThreadID {
+		msg.ReplyToMessageID = parent.MessageID
+	}
 
-		if err != nil {
-			log.Printf("Failed to generate embedding for message: %v", err)
-			// Save message without embedding
-			if err := b.db.SaveMessage(msg); err != nil {
-				log.Printf("Error saving message without embedding: %v", err)
-			}
-			return
-		}
+	// Save right away and let the embedding queue pick it up
+	id, err := b.db.SaveMessageForEmbedding(ctx, msg, time.Now())
+	if err != nil {
+		log.Printf("Error saving message: %v", err)
+		return
+	}
+	b.queue.Notify()
 
-		// Add embedding to message
-		msg.Embedding = embedding
+	// Remember the chat for searches made from elsewhere
+	if err := b.db.RecordChatMember(ctx, msg.ChatID, msg.UserID, message.Chat.Title, time.Now()); err != nil {
+		log.Printf("Error recording chat member: %v", err)
+	}
 
-		// Save message with embedding
-		if err := b.db.SaveMessage(msg); err != nil {
-			log.Printf("Error saving message with embedding: %v", err)
-		} else {
-			log.Printf("✅ Saved message with embedding (%d dims, %v) from %s",
-				len(embedding), embeddingDuration, msg.Username)
-		}
-	}()
+	if message.Document != nil {
+		b.ingestDocument(ctx, id, message.Document)
+	}
 }
 
 func (b *Bot) cleanText(text string) string {
@@ -588,6 +879,28 @@ func (b *Bot) sendReply(message *tgbotapi.Message, text string) {
 	}
 }
 
+// sendReplyWithKeyboard replies with an inline keyboard attached, if any
+func (b *Bot) sendReplyWithKeyboard(message *tgbotapi.Message, text string, keyboard *tgbotapi.InlineKeyboardMarkup) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = "Markdown"
+	msg.ReplyToMessageID = message.MessageID
+	msg.DisableWebPagePreview = true
+	if keyboard != nil {
+		msg.ReplyMarkup = keyboard
+	}
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Error sending message: %v", err)
+	}
+}
+
+// answerCallback acknowledges a button press, optionally showing a notice
+func (b *Bot) answerCallback(query *tgbotapi.CallbackQuery, text string) {
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Error answering callback: %v", err)
+	}
+}
+
 func getPerformanceStatus(searchAvg time.Duration) string {
 	if searchAvg == 0 {
 		return "🟡 No searches yet"
@@ -0,0 +1,207 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/search"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// inlineMaxResults caps the results offered for an inline query
+	inlineMaxResults = 10
+	// inlineCacheTTL is how long the answer to an inline query is reused.
+	// Telegram sends a query on every keystroke and users often go back to
+	// an earlier prefix.
+	inlineCacheTTL = time.Minute
+	// inlineClientCacheTime is how long Telegram may reuse an answer, in
+	// seconds
+	inlineClientCacheTime = 30
+)
+
+// inlineCache keeps the answers to users' inline queries
+type inlineCache struct {
+	entries map[inlineKey]*cachedInline
+	ttl     time.Duration
+	mutex   sync.Mutex
+}
+
+type inlineKey struct {
+	userID int64
+	query  string
+}
+
+type cachedInline struct {
+	articles []tgbotapi.InlineQueryResultArticle
+	chatIDs  []int64 // chats the answer was drawn from
+	expires  time.Time
+}
+
+func newInlineCache(ttl time.Duration) *inlineCache {
+	return &inlineCache{
+		entries: make(map[inlineKey]*cachedInline),
+		ttl:     ttl,
+	}
+}
+
+// get returns a non-expired answer
+func (c *inlineCache) get(userID int64, query string) ([]tgbotapi.InlineQueryResultArticle, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	key := inlineKey{userID, query}
+	entry, exists := c.entries[key]
+	if !exists || time.Now().After(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.articles, true
+}
+
+func (c *inlineCache) put(userID int64, query string, articles []tgbotapi.InlineQueryResultArticle, chatIDs []int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries[inlineKey{userID, query}] = &cachedInline{
+		articles: articles,
+		chatIDs:  chatIDs,
+		expires:  time.Now().Add(c.ttl),
+	}
+}
+
+// removeExpired drops answers past their expiry
+func (c *inlineCache) removeExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// removeChat drops every answer drawn from a chat, e.g. after its messages
+// were purged
+func (c *inlineCache) removeChat(chatID int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key, entry := range c.entries {
+		if slices.Contains(entry.chatIDs, chatID) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// handleInlineQuery answers "@bot query" typed in any chat with matching
+// messages from the chats the user belongs to
+func (b *Bot) handleInlineQuery(ctx context.Context, query *tgbotapi.InlineQuery) {
+	articles, err := b.inlineResults(ctx, query.From.ID, query.Query)
+	if err != nil {
+		log.Printf("Inline search error for user %d: %v", query.From.ID, err)
+	}
+
+	results := make([]interface{}, len(articles))
+	for i, article := range articles {
+		results[i] = article
+	}
+
+	answer := tgbotapi.InlineConfig{
+		InlineQueryID: query.ID,
+		Results:       results,
+		CacheTime:     inlineClientCacheTime,
+		IsPersonal:    true, // every user sees different chats
+	}
+	if _, err := b.api.Request(answer); err != nil {
+		log.Printf("Error answering inline query: %v", err)
+	}
+}
+
+// inlineResults searches every chat the user may search from outside it,
+// returning the best matches across them as articles
+func (b *Bot) inlineResults(ctx context.Context, userID int64, text string) ([]tgbotapi.InlineQueryResultArticle, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return nil, nil
+	}
+	if articles, ok := b.inline.get(userID, text); ok {
+		return articles, nil
+	}
+
+	parsed, err := search.ParseQuery(text, time.Now())
+	if err != nil || (strings.TrimSpace(parsed.Text) == "" && parsed.Filter.IsEmpty()) {
+		return nil, nil // still typing an operator
+	}
+
+	chats, err := b.memberChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	var results []search.SearchResult
+	chatIDs := make([]int64, len(chats))
+	titles := make(map[int64]string, len(chats))
+	for i, chat := range chats {
+		chatIDs[i], titles[chat.ChatID] = chat.ChatID, chat.Title
+		found, err := b.search.Search(ctx, parsed.Text, chat.ChatID, search.SearchOptions{Filter: parsed.Filter, Limit: inlineMaxResults})
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, found...)
+	}
+	b.perf.RecordSearchTime(time.Since(startTime))
+
+	// Similarities are comparable across chats, filter-only matches come
+	// newest first
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Similarity != results[j].Similarity {
+			return results[i].Similarity > results[j].Similarity
+		}
+		return results[i].Message.Timestamp.After(results[j].Message.Timestamp)
+	})
+	if len(results) > inlineMaxResults {
+		results = results[:inlineMaxResults]
+	}
+
+	articles := make([]tgbotapi.InlineQueryResultArticle, len(results))
+	for i, result := range results {
+		articles[i] = inlineArticle(result, titles[result.Message.ChatID])
+	}
+	b.inline.put(userID, text, articles, chatIDs)
+	return articles, nil
+}
+
+// inlineArticle turns a result from the chat with the given title into an
+// article that posts the message, with where it came from, into the chat
+// the query was typed in. The text is sent without formatting since it is
+// user content.
+func inlineArticle(result search.SearchResult, title string) tgbotapi.InlineQueryResultArticle {
+	msg := result.Message
+	timeStr := msg.Timestamp.Format("Jan 2 at 15:04")
+
+	var body strings.Builder
+	body.WriteString(fmt.Sprintf("💬 %s%s\n\n", contentIcon(msg.ContentType), truncateText(msg.Text, 3500)))
+	body.WriteString(fmt.Sprintf("👤 %s • 📅 %s • %s", getDisplayName(msg.Username), timeStr, title))
+	link := messageLink(msg.ChatID, "", msg)
+	if link != "" {
+		body.WriteString("\n🔗 " + link)
+	}
+
+	article := tgbotapi.NewInlineQueryResultArticle(fmt.Sprintf("%d", msg.ID), contentIcon(msg.ContentType)+truncateText(msg.Text, 100), body.String())
+	article.Description = fmt.Sprintf("%s • %s • %s", title, getDisplayName(msg.Username), timeStr)
+	if link != "" {
+		article.URL = link
+		article.HideURL = true
+	}
+	return article
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestInlineResults(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	alice := &tgbotapi.User{ID: 1, UserName: "alice"}
+	bob := &tgbotapi.User{ID: 2, UserName: "bob"}
+	ops := &tgbotapi.Chat{ID: -1001, Type: "supergroup"}
+	infra := &tgbotapi.Chat{ID: -1002, Type: "supergroup"}
+	secret := &tgbotapi.Chat{ID: -1003, Type: "supergroup"}
+	left := &tgbotapi.Chat{ID: -1004, Type: "supergroup"}
+
+	date := int(time.Now().Unix())
+	messages := []*tgbotapi.Message{
+		{MessageID: 1, From: alice, Chat: ops, Date: date, Text: "Deploy rollback steps are in the wiki"},
+		{MessageID: 1, From: alice, Chat: infra, Date: date, Text: "The deploy rollback failed on db01"},
+		{MessageID: 1, From: bob, Chat: secret, Date: date, Text: "Secret deploy rollback plan"},
+		{MessageID: 1, From: alice, Chat: left, Date: date, Text: "Old deploy rollback notes"},
+		{MessageID: 2, From: bob, Chat: ops, Date: date, Text: "Lunch at noon?"},
+	}
+	for _, message := range messages {
+		b.handleMessage(ctx, message)
+	}
+	drainQueue(t, b)
+
+	// Membership as Telegram reported it
+	b.access.setMember(ops.ID, alice.ID, true)
+	b.access.setMember(infra.ID, alice.ID, true)
+	b.access.setMember(left.ID, alice.ID, false)
+	b.access.setTitle(ops.ID, "Ops")
+	b.access.setTitle(infra.ID, "Infra")
+
+	articles, err := b.inlineResults(ctx, alice.ID, "deploy rollback")
+	if err != nil {
+		t.Fatalf("inlineResults failed: %v", err)
+	}
+	if len(articles) != 2 {
+		t.Fatalf("Expected matches from the two chats alice belongs to, got %+v", articles)
+	}
+	titles := make(map[string]bool)
+	for _, article := range articles {
+		if strings.Contains(article.Title, "Secret") || strings.Contains(article.Title, "Old") {
+			t.Errorf("Expected no results from chats alice isn't in, got %q", article.Title)
+		}
+		titles[strings.SplitN(article.Description, " • ", 2)[0]] = true
+	}
+	if !titles["Ops"] || !titles["Infra"] {
+		t.Errorf("Expected each result to name its chat, got %+v", articles)
+	}
+	content := articles[0].InputMessageContent.(tgbotapi.InputTextMessageContent)
+	if !strings.Contains(content.Text, "deploy rollback") || !strings.Contains(content.Text, "https://t.me/c/") {
+		t.Errorf("Expected the message and a link back to it, got %q", content.Text)
+	}
+
+	// Answers are reused while the user keeps typing
+	b.access.setMember(infra.ID, alice.ID, false)
+	if cached, _ := b.inlineResults(ctx, alice.ID, "deploy rollback"); len(cached) != 2 {
+		t.Errorf("Expected the cached answer, got %d articles", len(cached))
+	}
+	b.forgetIndexed(infra.ID, nil)
+	if fresh, _ := b.inlineResults(ctx, alice.ID, "deploy rollback"); len(fresh) != 1 {
+		t.Errorf("Expected purging a chat to drop its cached answers, got %d articles", len(fresh))
+	}
+
+	// Users who never posted have no chats to search
+	if articles, _ := b.inlineResults(ctx, 99, "deploy rollback"); len(articles) != 0 {
+		t.Errorf("Expected no results for an unknown user, got %+v", articles)
+	}
+	if articles, err := b.inlineResults(ctx, alice.ID, "from:"); err != nil || len(articles) != 0 {
+		t.Errorf("Expected no results while an operator is typed, got %+v (%v)", articles, err)
+	}
+}
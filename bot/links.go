@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"semantic-search-bot/search"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const jumpCallbackPrefix = "jump"
+
+// supportsMessageLinks reports whether t.me links can point into a chat.
+// Public chats are linked by username, private supergroups and channels by
+// their internal ID (the chat ID without the -100 prefix). Basic groups and
+// private chats have no message links.
+func supportsMessageLinks(chatID int64, chatUsername string) bool {
+	return chatUsername != "" || strings.HasPrefix(strconv.FormatInt(chatID, 10), "-100")
+}
+
+// messageLink returns a t.me deep link to a stored message, or "" when the
+// chat has no message links or the Telegram message ID is unknown
+func messageLink(chatID int64, chatUsername string, msg database.Message) string {
+	if msg.TelegramMessageID == 0 || !supportsMessageLinks(chatID, chatUsername) {
+		return ""
+	}
+
+	base := "https://t.me/" + chatUsername
+	if chatUsername == "" {
+		base = "https://t.me/c/" + strings.TrimPrefix(strconv.FormatInt(chatID, 10), "-100")
+	}
+
+	if msg.ThreadID != 0 {
+		return fmt.Sprintf("%s/%d/%d", base, msg.ThreadID, msg.TelegramMessageID)
+	}
+	return fmt.Sprintf("%s/%d", base, msg.TelegramMessageID)
+}
+
+// resultsKeyboard combines the page buttons with one "🧵" button per result
+// showing the conversation around it, and for chats without message links
+// one "📍" button per result; pressing it makes the bot reply to the
+// original message so Telegram can scroll to it. deliveredTo is the chat the
+// results are posted in, which only has jump buttons if it was searched.
+func (b *Bot) resultsKeyboard(cacheID string, page resultPage, pageResults []search.SearchResult, total int, chatID int64, chatUsername string, deliveredTo int64) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+
+	if deliveredTo == chatID && !supportsMessageLinks(chatID, chatUsername) {
+		var jumpRow []tgbotapi.InlineKeyboardButton
+		for _, result := range pageResults {
+			if result.Message.TelegramMessageID != 0 {
+				data := fmt.Sprintf("%s:%d", jumpCallbackPrefix, result.Message.ID)
+				jumpRow = append(jumpRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("📍 %d", result.Rank), data))
+			}
+		}
+		if len(jumpRow) > 0 {
+			rows = append(rows, jumpRow)
+		}
+	}
+
+	var contextRow []tgbotapi.InlineKeyboardButton
+	for _, result := range pageResults {
+		data := fmt.Sprintf("%s:%d", contextCallbackPrefix, result.Message.ID)
+		contextRow = append(contextRow, tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🧵 %d", result.Rank), data))
+	}
+	if len(contextRow) > 0 {
+		rows = append(rows, contextRow)
+	}
+
+	if keyboard := pageKeyboard(cacheID, page, total, b.config.MaxResults); keyboard != nil {
+		rows = append(rows, keyboard.InlineKeyboard...)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	markup := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// handleJumpCallback replies to the original message behind a result
+func (b *Bot) handleJumpCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(query.Data, jumpCallbackPrefix+":"), 10, 64)
+	if err != nil || query.Message == nil {
+		b.answerCallback(query, "")
+		return
+	}
+
+	messages, err := b.db.GetMessagesByIDs(ctx, []int64{id})
+	if err != nil || len(messages) == 0 || messages[0].ChatID != query.Message.Chat.ID {
+		b.answerCallback(query, "🤷 That message is no longer stored.")
+		return
+	}
+
+	reply := tgbotapi.NewMessage(query.Message.Chat.ID, "📍 Here it is")
+	reply.ReplyToMessageID = messages[0].TelegramMessageID
+	if _, err := b.api.Send(reply); err != nil {
+		log.Printf("Error replying to original message %d: %v", messages[0].TelegramMessageID, err)
+		b.answerCallback(query, "🤷 The original message was deleted from the chat.")
+		return
+	}
+
+	b.answerCallback(query, "")
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"semantic-search-bot/database"
+	"testing"
+)
+
+func TestMessageLink(t *testing.T) {
+	tests := []struct {
+		name         string
+		chatID       int64
+		chatUsername string
+		msg          database.Message
+		expected     string
+	}{
+		{"private supergroup", -1001234567890, "", database.Message{TelegramMessageID: 42}, "https://t.me/c/1234567890/42"},
+		{"forum topic", -1001234567890, "", database.Message{TelegramMessageID: 42, ThreadID: 7}, "https://t.me/c/1234567890/7/42"},
+		{"public group", -1001234567890, "ourteam", database.Message{TelegramMessageID: 42}, "https://t.me/ourteam/42"},
+		{"basic group", -4567890, "", database.Message{TelegramMessageID: 42}, ""},
+		{"private chat", 123456, "", database.Message{TelegramMessageID: 42}, ""},
+		{"legacy message", -1001234567890, "", database.Message{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := messageLink(tt.chatID, tt.chatUsername, tt.msg); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestThreadTrackerRecord(t *testing.T) {
+	tracker := newThreadTracker(nil)
+	tracker.record([]byte(`{"ok":true,"result":[
+		{"update_id":1,"message":{"message_id":10,"message_thread_id":3,"is_topic_message":true,"chat":{"id":-100}}},
+		{"update_id":2,"edited_message":{"message_id":11,"message_thread_id":5,"is_topic_message":true,"chat":{"id":-100}}},
+		{"update_id":3,"message":{"message_id":12,"chat":{"id":-100}}},
+		{"update_id":4,"message":{"message_id":13,"message_thread_id":7,"chat":{"id":-200}}}
+	]}`))
+
+	if got := tracker.threadID(-100, 10); got != 3 {
+		t.Errorf("Expected thread 3, got %d", got)
+	}
+	if got := tracker.threadID(-100, 10); got != 0 {
+		t.Errorf("Expected thread ID to be consumed, got %d", got)
+	}
+	if got := tracker.threadID(-100, 11); got != 5 {
+		t.Errorf("Expected thread 5 for edited message, got %d", got)
+	}
+	if got := tracker.threadID(-100, 12); got != 0 {
+		t.Errorf("Expected no thread, got %d", got)
+	}
+	// Replies in groups without topics name the thread they reply in
+	if got := tracker.threadID(-200, 13); got != 0 {
+		t.Errorf("Expected no topic for a reply outside a forum, got %d", got)
+	}
+}
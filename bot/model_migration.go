@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"time"
+)
+
+// modelMigrationInterval is how often chats are checked for a change of
+// the configured embedding model and for finished migrations
+const modelMigrationInterval = time.Minute
+
+// StartModelMigrator re-embeds chats whose vectors come from another model
+// than the configured one. The old vectors keep serving searches until all
+// messages of a chat are re-embedded, then the chat switches over at once.
+func (b *Bot) StartModelMigrator(interval time.Duration) {
+	b.every(interval, func(ctx context.Context) {
+		b.migrateEmbeddingModels(ctx, time.Now())
+	})
+}
+
+// migrateEmbeddingModels starts, cancels or completes the migration of
+// every chat as needed
+func (b *Bot) migrateEmbeddingModels(ctx context.Context, now time.Time) {
+	states, err := b.db.GetEmbeddingModelStates(ctx)
+	if err != nil {
+		log.Printf("Error listing embedding models: %v", err)
+		return
+	}
+
+	for _, state := range states {
+		b.migrateChatModel(ctx, state, b.config.EmbeddingModel, now)
+	}
+}
+
+// migrateChatModel moves one chat towards the target model
+func (b *Bot) migrateChatModel(ctx context.Context, state database.EmbeddingModelState, target string, now time.Time) {
+	switch {
+	case state.Active == "":
+		// Nothing embedded yet, the first vector pins the target model
+
+	case state.Active == target:
+		if state.Migrating != "" {
+			// The configured model was changed back
+			if err := b.db.CancelEmbeddingMigration(ctx, state.ChatID); err != nil {
+				log.Printf("Error cancelling model migration in chat %d: %v", state.ChatID, err)
+				return
+			}
+			log.Printf("↩️ Cancelled migration of chat %d to %s", state.ChatID, state.Migrating)
+		}
+
+	case state.Migrating != target:
+		queued, err := b.db.StartEmbeddingMigration(ctx, state.ChatID, target, now)
+		if err != nil {
+			log.Printf("Error starting model migration in chat %d: %v", state.ChatID, err)
+			return
+		}
+		log.Printf("🔀 Migrating chat %d from %s to %s (%d messages queued)", state.ChatID, state.Active, target, queued)
+		b.queue.Notify()
+
+	default:
+		pending, _, err := b.db.ChatEmbeddingBacklog(ctx, state.ChatID)
+		if err != nil {
+			log.Printf("Error reading migration progress of chat %d: %v", state.ChatID, err)
+			return
+		}
+		if pending > 0 {
+			return
+		}
+
+		err = b.db.SwitchEmbeddingModel(ctx, state.ChatID, target)
+		if errors.Is(err, database.ErrMigrationIncomplete) {
+			// Jobs gave up, e.g. on a misconfigured model: keep the old
+			// vectors serving and try the rest again
+			queued, err := b.db.QueueUnstagedEmbeddings(ctx, state.ChatID, target, now)
+			if err != nil {
+				log.Printf("Error requeueing migration of chat %d: %v", state.ChatID, err)
+				return
+			}
+			log.Printf("⚠️  Chat %d stays on %s: %d messages have no %s vector yet, retrying them", state.ChatID, state.Active, queued, target)
+			b.queue.Notify()
+			return
+		}
+		if err != nil {
+			log.Printf("Error switching chat %d to %s: %v", state.ChatID, target, err)
+			return
+		}
+		if err := b.search.RebuildIndex(ctx, state.ChatID); err != nil {
+			log.Printf("Error rebuilding index of chat %d: %v", state.ChatID, err)
+		}
+		b.results.removeChat(state.ChatID)
+		b.inline.removeChat(state.ChatID)
+		log.Printf("✅ Chat %d switched from %s to %s", state.ChatID, state.Active, target)
+	}
+}
+
+// describeEmbeddingModel names the model serving a chat's searches and the
+// progress of a running migration, for /stats
+func (b *Bot) describeEmbeddingModel(ctx context.Context, chatID int64, total int) string {
+	state, err := b.db.GetEmbeddingModelState(ctx, chatID)
+	if err != nil {
+		log.Printf("Error reading embedding model: %v", err)
+		return b.config.EmbeddingModel
+	}
+	if state.Active == "" {
+		return b.config.EmbeddingModel
+	}
+	if state.Migrating == "" {
+		return state.Active
+	}
+
+	staged, err := b.db.StagedEmbeddingCount(ctx, chatID)
+	if err != nil {
+		log.Printf("Error reading migration progress: %v", err)
+	}
+	return fmt.Sprintf("%s (migrating to %s: %d/%d)", state.Active, state.Migrating, staged, total)
+}
@@ -0,0 +1,47 @@
+package bot
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestModelMigrationKeepsVectorsWhenJobsGiveUp(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	date := int(time.Now().Unix())
+	for i, text := range []string{"The deploy failed on db01", "Lunch at noon?", "Rollback steps are in the wiki"} {
+		b.handleMessage(ctx, &tgbotapi.Message{MessageID: i + 1, From: &tgbotapi.User{ID: 1, UserName: "alice"}, Chat: chat, Date: date, Text: text})
+	}
+	drainQueue(t, b)
+
+	state, _ := b.db.GetEmbeddingModelState(ctx, chat.ID)
+	now := time.Now()
+	b.migrateChatModel(ctx, state, "broken-model", now)
+
+	// Every job of the migration gives up, e.g. because the model doesn't exist
+	jobs, _ := b.db.ClaimEmbeddingJobs(ctx, 10, now.Add(time.Minute), embeddingLease)
+	if len(jobs) != 3 {
+		t.Fatalf("Expected 3 migration jobs, got %d", len(jobs))
+	}
+	for _, job := range jobs {
+		b.db.DropEmbeddingJob(ctx, job.MessageID)
+	}
+
+	state, _ = b.db.GetEmbeddingModelState(ctx, chat.ID)
+	b.migrateChatModel(ctx, state, "broken-model", now)
+
+	if state, _ := b.db.GetEmbeddingModelState(ctx, chat.ID); state.Active != "hashing" || state.Migrating != "broken-model" {
+		t.Errorf("Expected the chat to stay on its model, got %+v", state)
+	}
+	if serving, _ := b.db.GetMessagesWithEmbeddings(ctx, chat.ID, "hashing"); len(serving) != 3 {
+		t.Errorf("Expected every vector to keep serving, got %d", len(serving))
+	}
+	if pending, _, _ := b.db.ChatEmbeddingBacklog(ctx, chat.ID); pending != 3 {
+		t.Errorf("Expected the messages to be queued again, got %d", pending)
+	}
+}
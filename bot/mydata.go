@@ -0,0 +1,221 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const forgetMeCallbackPrefix = "forgetme"
+
+// Audit log actions
+const (
+	auditActionExport = "export"
+	auditActionErase  = "erase"
+)
+
+// userDataExport is the JSON document sent by /mydata
+type userDataExport struct {
+	ExportedAt time.Time              `json:"exported_at"`
+	UserID     int64                  `json:"user_id"`
+	Messages   []database.Message     `json:"messages"`
+	Edits      []database.MessageEdit `json:"edits"` // earlier versions of edited messages
+}
+
+// handleMyDataCommand sends the requester everything stored about them as a
+// JSON document in a private chat
+func (b *Bot) handleMyDataCommand(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	userID := message.From.ID
+
+	messages, err := b.db.GetMessagesByUser(ctx, userID)
+	if err != nil {
+		log.Printf("Error exporting messages of user %d: %v", userID, err)
+		b.sendReply(message, "❌ I couldn't collect your data right now. Please try again.")
+		return
+	}
+
+	edits, err := b.db.GetEditsByUser(ctx, userID)
+	if err != nil {
+		log.Printf("Error exporting edits of user %d: %v", userID, err)
+		b.sendReply(message, "❌ I couldn't collect your data right now. Please try again.")
+		return
+	}
+
+	export := userDataExport{
+		ExportedAt: time.Now().UTC(),
+		UserID:     userID,
+		Messages:   messages,
+		Edits:      edits,
+	}
+	if export.Messages == nil {
+		export.Messages = []database.Message{}
+	}
+	if export.Edits == nil {
+		export.Edits = []database.MessageEdit{}
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		log.Printf("Error encoding export of user %d: %v", userID, err)
+		b.sendReply(message, "❌ I couldn't collect your data right now. Please try again.")
+		return
+	}
+
+	// A user's private chat has the same ID as the user
+	doc := tgbotapi.NewDocument(userID, tgbotapi.FileBytes{
+		Name:  fmt.Sprintf("mydata-%d.json", userID),
+		Bytes: data,
+	})
+	doc.Caption = fmt.Sprintf("📦 Everything I've stored about you: %d message%s and %d earlier version%s.",
+		len(messages), pluralize(len(messages)), len(edits), pluralize(len(edits)))
+
+	if _, err := b.api.Send(doc); err != nil {
+		log.Printf("Error sending export to user %d: %v", userID, err)
+		b.sendReply(message, fmt.Sprintf("📭 I can't message you privately yet. Please [start a chat with me](https://t.me/%s?start=mydata) and run /mydata again.",
+			b.api.Self.UserName))
+		return
+	}
+
+	b.recordAudit(ctx, auditActionExport, userID, message.Chat.ID, fmt.Sprintf("%d messages, %d edits", len(messages), len(edits)))
+
+	if !message.Chat.IsPrivate() {
+		b.sendReply(message, "📬 I've sent your data export to our private chat.")
+	}
+}
+
+// handleForgetMeCommand asks the requester to confirm erasing all their
+// stored messages
+func (b *Bot) handleForgetMeCommand(ctx context.Context, message *tgbotapi.Message) {
+	if message.From == nil {
+		return
+	}
+	userID := message.From.ID
+
+	messages, err := b.db.GetMessagesByUser(ctx, userID)
+	if err != nil {
+		log.Printf("Error counting messages of user %d: %v", userID, err)
+		b.sendReply(message, "❌ I couldn't look up your data right now. Please try again.")
+		return
+	}
+
+	if len(messages) == 0 {
+		b.sendReply(message, "🤷 I haven't stored any of your messages.")
+		return
+	}
+
+	chats := make(map[int64]bool)
+	for _, msg := range messages {
+		chats[msg.ChatID] = true
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(tgbotapi.NewInlineKeyboardRow(
+		tgbotapi.NewInlineKeyboardButtonData(fmt.Sprintf("🗑️ Delete %d message%s", len(messages), pluralize(len(messages))),
+			forgetMeCallbackData(userID, true)),
+		tgbotapi.NewInlineKeyboardButtonData("Cancel", forgetMeCallbackData(userID, false)),
+	))
+
+	b.sendReplyWithKeyboard(message, fmt.Sprintf(`⚠️ *Forget Me*
+
+I've stored %d message%s from you across %d chat%s. Deleting them removes the text, the AI embeddings and any earlier versions from every chat.
+
+This can't be undone. Are you sure?`,
+		len(messages), pluralize(len(messages)), len(chats), pluralize(len(chats))), &keyboard)
+}
+
+func forgetMeCallbackData(userID int64, confirm bool) string {
+	answer := "no"
+	if confirm {
+		answer = "yes"
+	}
+	return fmt.Sprintf("%s:%s:%d", forgetMeCallbackPrefix, answer, userID)
+}
+
+// parseForgetMeCallback decodes data produced by forgetMeCallbackData
+func parseForgetMeCallback(data string) (int64, bool, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 3 || parts[0] != forgetMeCallbackPrefix || (parts[1] != "yes" && parts[1] != "no") {
+		return 0, false, fmt.Errorf("invalid forgetme callback %q", data)
+	}
+
+	userID, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid forgetme user %q", parts[2])
+	}
+	return userID, parts[1] == "yes", nil
+}
+
+// handleForgetMeCallback erases the user's data once they confirm
+func (b *Bot) handleForgetMeCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	userID, confirm, err := parseForgetMeCallback(query.Data)
+	if err != nil || query.Message == nil {
+		b.answerCallback(query, "")
+		return
+	}
+
+	// Only the user who asked may confirm
+	if query.From == nil || query.From.ID != userID {
+		b.answerCallback(query, "🔒 This button is for the user who asked.")
+		return
+	}
+
+	if !confirm {
+		b.editCallbackMessage(query, "👍 Okay, I'll keep your messages.")
+		b.answerCallback(query, "")
+		return
+	}
+
+	deleted, err := b.db.DeleteMessagesByUser(ctx, userID)
+	if err != nil {
+		log.Printf("Error erasing messages of user %d: %v", userID, err)
+		b.answerCallback(query, "❌ Something went wrong. Please try again.")
+		return
+	}
+
+	total := 0
+	for chatID, ids := range deleted {
+		b.forgetIndexed(chatID, ids)
+		total += len(ids)
+	}
+
+	b.recordAudit(ctx, auditActionErase, userID, query.Message.Chat.ID, fmt.Sprintf("%d messages in %d chats", total, len(deleted)))
+	b.editCallbackMessage(query, fmt.Sprintf("🗑️ *Done.* I deleted %d message%s of yours.", total, pluralize(total)))
+	b.answerCallback(query, "")
+
+	log.Printf("🗑️ Erased %d messages of user %d on request", total, userID)
+}
+
+// recordAudit stores an audit log entry for a request made by userID in
+// chatID
+func (b *Bot) recordAudit(ctx context.Context, action string, userID, chatID int64, details string) {
+	entry := database.AuditEntry{
+		Action:    action,
+		UserID:    userID,
+		ChatID:    chatID,
+		Details:   details,
+		CreatedAt: time.Now(),
+	}
+
+	if err := b.db.RecordAudit(ctx, entry); err != nil {
+		log.Printf("Error recording %s audit entry for user %d: %v", action, userID, err)
+	}
+}
+
+// editCallbackMessage replaces the text of the message a button belongs to
+// and removes its buttons
+func (b *Bot) editCallbackMessage(query *tgbotapi.CallbackQuery, text string) {
+	edit := tgbotapi.NewEditMessageText(query.Message.Chat.ID, query.Message.MessageID, text)
+	edit.ParseMode = "Markdown"
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Error editing message: %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package bot
+
+import (
+	"context"
+	"semantic-search-bot/embedding"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestForgetMeCallbackRoundTrip(t *testing.T) {
+	for _, confirm := range []bool{true, false} {
+		data := forgetMeCallbackData(123456789, confirm)
+		if len(data) > 64 {
+			t.Errorf("Callback data exceeds Telegram's 64 byte limit: %q", data)
+		}
+
+		userID, parsed, err := parseForgetMeCallback(data)
+		if err != nil {
+			t.Fatalf("parseForgetMeCallback failed: %v", err)
+		}
+		if userID != 123456789 || parsed != confirm {
+			t.Errorf("Expected 123456789 %v, got %d %v", confirm, userID, parsed)
+		}
+	}
+
+	for _, bad := range []string{"forgetme:yes", "forgetme:maybe:1", "forgetme:yes:abc", "pg:yes:1"} {
+		if _, _, err := parseForgetMeCallback(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestForgetMeDeletesCachedEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	alice := &tgbotapi.User{ID: 1, UserName: "alice"}
+	bob := &tgbotapi.User{ID: 2, UserName: "bob"}
+	chat := &tgbotapi.Chat{ID: -1001, Type: "supergroup"}
+	date := int(time.Now().Unix())
+	private := "My home address is 12 Elm Street"
+	shared := "Sounds good to me"
+	for _, message := range []*tgbotapi.Message{
+		{MessageID: 1, From: alice, Chat: chat, Date: date, Text: private},
+		{MessageID: 2, From: alice, Chat: chat, Date: date, Text: shared},
+		{MessageID: 3, From: bob, Chat: chat, Date: date, Text: shared},
+	} {
+		b.handleMessage(ctx, message)
+	}
+	drainQueue(t, b)
+
+	model := b.embedding.ModelName()
+	keys := []string{embedding.CacheKey(private), embedding.CacheKey(shared)}
+	if cached, _ := b.db.LoadCachedEmbeddings(ctx, model, keys); len(cached) != 2 {
+		t.Fatalf("Expected both texts to be cached, got %d", len(cached))
+	}
+	entries := b.cache.Stats().Entries
+
+	// What /forgetme does once confirmed
+	deleted, err := b.db.DeleteMessagesByUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("DeleteMessagesByUser failed: %v", err)
+	}
+	for chatID, ids := range deleted {
+		b.forgetIndexed(chatID, ids)
+	}
+
+	cached, err := b.db.LoadCachedEmbeddings(ctx, model, keys)
+	if err != nil {
+		t.Fatalf("LoadCachedEmbeddings failed: %v", err)
+	}
+	if _, ok := cached[embedding.CacheKey(private)]; ok {
+		t.Error("Expected the erased text to leave no cached embedding")
+	}
+	if _, ok := cached[embedding.CacheKey(shared)]; !ok {
+		t.Error("Expected a text another user still has to stay cached")
+	}
+	if got := b.cache.Stats().Entries; got != entries-1 {
+		t.Errorf("Expected the erased text to be dropped from memory, got %d entries of %d", got, entries)
+	}
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"semantic-search-bot/search"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// maxCachedResults is how many ranked results a search keeps for paging
+	maxCachedResults = 30
+	// maxPageSize caps how far "Show more" can grow a page, and the first
+	// page when MAX_RESULTS is larger
+	maxPageSize = 10
+	// resultCacheIDBytes is the randomness in a result cache ID, enough that
+	// IDs can't be guessed to page through another chat's results
+	resultCacheIDBytes = 8
+	// resultCacheTTL is how long page buttons keep working after a search
+	resultCacheTTL = 30 * time.Minute
+
+	pageCallbackPrefix = "pg"
+)
+
+// cachedSearch is a ranked result list kept around for page navigation
+type cachedSearch struct {
+	query        string
+	mode         search.Mode
+	results      []search.SearchResult
+	duration     time.Duration
+	chatID       int64
+	chatUsername string
+	deliveredTo  int64 // chat the results were posted in, the requester's private chat if sent privately
+	expires      time.Time
+}
+
+// resultCache stores search results by a short random ID that fits into
+// Telegram's 64-byte callback data
+type resultCache struct {
+	entries map[string]*cachedSearch
+	ttl     time.Duration
+	mutex   sync.Mutex
+}
+
+func newResultCache(ttl time.Duration) *resultCache {
+	return &resultCache{
+		entries: make(map[string]*cachedSearch),
+		ttl:     ttl,
+	}
+}
+
+// put stores an entry and returns its ID
+func (c *resultCache) put(entry *cachedSearch) string {
+	buf := make([]byte, resultCacheIDBytes)
+	rand.Read(buf)
+	id := hex.EncodeToString(buf)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry.expires = time.Now().Add(c.ttl)
+	c.entries[id] = entry
+	return id
+}
+
+// get returns a non-expired entry
+func (c *resultCache) get(id string) (*cachedSearch, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, exists := c.entries[id]
+	if !exists || time.Now().After(entry.expires) {
+		delete(c.entries, id)
+		return nil, false
+	}
+	return entry, true
+}
+
+// removeExpired drops entries past their expiry
+func (c *resultCache) removeExpired() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for id, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// removeChat drops every entry of a chat, e.g. after its messages were purged
+func (c *resultCache) removeChat(chatID int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for id, entry := range c.entries {
+		if entry.chatID == chatID {
+			delete(c.entries, id)
+		}
+	}
+}
+
+// resultPage is a window into a cached result list
+type resultPage struct {
+	offset int
+	size   int
+}
+
+// firstPage is the page a search shows first, of the configured size
+// within what page buttons accept
+func firstPage(size int) resultPage {
+	return resultPage{offset: 0, size: min(max(size, 1), maxPageSize)}
+}
+
+func (p resultPage) callbackData(cacheID string) string {
+	return fmt.Sprintf("%s:%s:%d:%d", pageCallbackPrefix, cacheID, p.offset, p.size)
+}
+
+// parsePageCallback decodes data produced by resultPage.callbackData
+func parsePageCallback(data string) (string, resultPage, error) {
+	parts := strings.Split(data, ":")
+	if len(parts) != 4 || parts[0] != pageCallbackPrefix {
+		return "", resultPage{}, fmt.Errorf("invalid page callback %q", data)
+	}
+
+	offset, err := strconv.Atoi(parts[2])
+	if err != nil || offset < 0 {
+		return "", resultPage{}, fmt.Errorf("invalid page offset %q", parts[2])
+	}
+
+	size, err := strconv.Atoi(parts[3])
+	if err != nil || size <= 0 || size > maxPageSize {
+		return "", resultPage{}, fmt.Errorf("invalid page size %q", parts[3])
+	}
+
+	return parts[1], resultPage{offset: offset, size: size}, nil
+}
+
+// slice returns the results visible on the page
+func (p resultPage) slice(results []search.SearchResult) []search.SearchResult {
+	if p.offset >= len(results) {
+		return nil
+	}
+	return results[p.offset:min(p.offset+p.size, len(results))]
+}
+
+// pageKeyboard builds the Prev / Show more / Next buttons for a page, or
+// nil when every result already fits on it
+func pageKeyboard(cacheID string, page resultPage, total, pageSize int) *tgbotapi.InlineKeyboardMarkup {
+	var row []tgbotapi.InlineKeyboardButton
+
+	if page.offset > 0 {
+		prev := resultPage{offset: max(page.offset-page.size, 0), size: page.size}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("⬅️ Prev", prev.callbackData(cacheID)))
+	}
+
+	end := page.offset + page.size
+	if end < total && page.size < maxPageSize {
+		more := resultPage{offset: page.offset, size: min(page.size+pageSize, maxPageSize)}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("➕ Show more", more.callbackData(cacheID)))
+	}
+
+	if end < total {
+		next := resultPage{offset: end, size: page.size}
+		row = append(row, tgbotapi.NewInlineKeyboardButtonData("Next ➡️", next.callbackData(cacheID)))
+	}
+
+	if len(row) == 0 {
+		return nil
+	}
+
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(row)
+	return &keyboard
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"semantic-search-bot/search"
+	"testing"
+	"time"
+)
+
+func makeResults(n int) []search.SearchResult {
+	results := make([]search.SearchResult, n)
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+	return results
+}
+
+func TestPageCallbackRoundTrip(t *testing.T) {
+	cacheID := newResultCache(time.Minute).put(&cachedSearch{})
+	if len(cacheID) != 2*resultCacheIDBytes {
+		t.Errorf("Expected a %d byte hex ID, got %q", resultCacheIDBytes, cacheID)
+	}
+
+	page := resultPage{offset: maxCachedResults - 1, size: maxPageSize}
+	data := page.callbackData(cacheID)
+	if len(data) > 64 {
+		t.Errorf("Callback data exceeds Telegram's 64 byte limit: %q", data)
+	}
+
+	id, parsed, err := parsePageCallback(data)
+	if err != nil {
+		t.Fatalf("parsePageCallback failed: %v", err)
+	}
+	if id != cacheID || parsed != page {
+		t.Errorf("Expected %s %+v, got %s %+v", cacheID, page, id, parsed)
+	}
+
+	for _, bad := range []string{"pg:x:1", "pg:x:-1:3", "pg:x:0:99", "other:x:0:3"} {
+		if _, _, err := parsePageCallback(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestPageSlice(t *testing.T) {
+	results := makeResults(7)
+
+	page := resultPage{offset: 6, size: 3}.slice(results)
+	if len(page) != 1 || page[0].Rank != 7 {
+		t.Errorf("Expected last page with result 7, got %+v", page)
+	}
+
+	if page := (resultPage{offset: 9, size: 3}).slice(results); len(page) != 0 {
+		t.Errorf("Expected empty page past the end, got %+v", page)
+	}
+}
+
+func TestPageKeyboard(t *testing.T) {
+	buttons := func(page resultPage, total int) []string {
+		keyboard := pageKeyboard("id", page, total, 3)
+		if keyboard == nil {
+			return nil
+		}
+		var texts []string
+		for _, button := range keyboard.InlineKeyboard[0] {
+			texts = append(texts, button.Text)
+		}
+		return texts
+	}
+
+	if got := buttons(resultPage{0, 3}, 3); got != nil {
+		t.Errorf("Expected no keyboard when everything fits, got %v", got)
+	}
+
+	if got := buttons(resultPage{0, 3}, 10); len(got) != 2 || got[0] != "➕ Show more" || got[1] != "Next ➡️" {
+		t.Errorf("Unexpected first page buttons: %v", got)
+	}
+
+	if got := buttons(resultPage{3, 3}, 10); len(got) != 3 || got[0] != "⬅️ Prev" {
+		t.Errorf("Unexpected middle page buttons: %v", got)
+	}
+
+	if got := buttons(resultPage{0, maxPageSize}, 30); len(got) != 1 || got[0] != "Next ➡️" {
+		t.Errorf("Expected Show more to disappear at max page size, got %v", got)
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	cache := newResultCache(time.Hour)
+	id := cache.put(&cachedSearch{query: "deploy", results: makeResults(5)})
+
+	entry, ok := cache.get(id)
+	if !ok || entry.query != "deploy" {
+		t.Fatalf("Expected cached entry, got %+v %v", entry, ok)
+	}
+
+	entry.expires = time.Now().Add(-time.Second)
+	if _, ok := cache.get(id); ok {
+		t.Error("Expected expired entry to be gone")
+	}
+
+	old := cache.put(&cachedSearch{query: "old"})
+	cache.entries[old].expires = time.Now().Add(-time.Second)
+	cache.removeExpired()
+	if len(cache.entries) != 0 {
+		t.Errorf("Expected expired entries to be removed, %d left", len(cache.entries))
+	}
+}
+
+func TestFirstPage(t *testing.T) {
+	for size, expected := range map[int]int{3: 3, maxPageSize: maxPageSize, 25: maxPageSize, 0: 1} {
+		page := firstPage(size)
+		if page.offset != 0 || page.size != expected {
+			t.Errorf("firstPage(%d) = %+v, expected size %d", size, page, expected)
+		}
+		// Its buttons must parse again
+		if _, _, err := parsePageCallback(page.callbackData("deadbeef")); err != nil {
+			t.Errorf("firstPage(%d) can't be paged: %v", size, err)
+		}
+	}
+}
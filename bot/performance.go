@@ -95,15 +95,3 @@ func formatBytes(bytes uint64) string {
 	}
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
-
-// Start performance monitoring goroutine
-func (pm *PerformanceMonitor) StartMonitoring(interval time.Duration) {
-	go func() {
-		ticker := time.NewTicker(interval)
-		defer ticker.Stop()
-
-		for range ticker.C {
-			pm.LogPerformanceStats()
-		}
-	}()
-}
@@ -0,0 +1,358 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"semantic-search-bot/config"
+	"semantic-search-bot/database"
+	"semantic-search-bot/embedding"
+	"semantic-search-bot/search"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// newTestBot builds a bot backed by a temporary database and the offline
+// hashing embedder. It has no Telegram API, so only code paths that don't
+// send messages can be exercised.
+func newTestBot(t *testing.T) *Bot {
+	t.Helper()
+
+	provider := embedding.NewHashingEmbedder("hashing", 0)
+	return newTestBotWith(t, provider, embedding.DefaultBreakerSettings)
+}
+
+// newTestBotWith builds a test bot around another embedding provider
+func newTestBotWith(t *testing.T, provider embedding.Embedder, settings embedding.BreakerSettings) *Bot {
+	t.Helper()
+
+	db, err := database.NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := &config.Config{
+		EmbeddingProvider:  embedding.ProviderHashing,
+		EmbeddingModel:     "hashing",
+		MaxResults:         3,
+		EmbeddingWorkers:   1,
+		EmbeddingBatchSize: 16,
+	}
+	breaker := embedding.NewCircuitBreaker(provider, settings)
+	embedder := embedding.NewCachedEmbedder(breaker, db, 100)
+	db.OnEmbeddingCacheDeleted(embedder.Forget)
+
+	engine := search.NewEngine(db, embedder, cfg.MaxResults)
+	perf := NewPerformanceMonitor()
+	return &Bot{
+		db:        db,
+		config:    cfg,
+		embedding: embedder,
+		cache:     embedder,
+		breaker:   breaker,
+		search:    engine,
+		perf:      perf,
+		results:   newResultCache(resultCacheTTL),
+		inline:    newInlineCache(inlineCacheTTL),
+		access:    newChatAccess(chatAccessTTL),
+		threads:   newThreadTracker(&http.Client{}),
+		queue:     newEmbeddingQueue(db, embedder, engine, perf, cfg.EmbeddingWorkers, cfg.EmbeddingBatchSize),
+	}
+}
+
+// drainQueue embeds every due job synchronously
+func drainQueue(t *testing.T, b *Bot) {
+	t.Helper()
+	ctx := context.Background()
+	for {
+		jobs, err := b.db.ClaimEmbeddingJobs(ctx, b.queue.batchSize, time.Now(), embeddingLease)
+		if err != nil {
+			t.Fatalf("ClaimEmbeddingJobs failed: %v", err)
+		}
+		if len(jobs) == 0 {
+			return
+		}
+		b.queue.process(ctx, jobs)
+	}
+}
+
+func TestMessagePipelineOffline(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup", UserName: "teamchat"}
+	texts := []string{
+		"The deploy to production failed last night",
+		"Let's grab pizza for lunch tomorrow",
+		"Weekend hiking trip to the mountains",
+	}
+	for i, text := range texts {
+		b.handleMessage(ctx, &tgbotapi.Message{
+			MessageID: i + 1,
+			From:      &tgbotapi.User{ID: 1, UserName: "alice"},
+			Chat:      chat,
+			Date:      int(time.Now().Unix()),
+			Text:      text,
+		})
+	}
+
+	drainQueue(t, b)
+	if count, _ := b.db.GetStatsWithEmbeddings(ctx, chat.ID); count != len(texts) {
+		t.Fatalf("Expected %d embedded messages, got %d", len(texts), count)
+	}
+
+	results, err := b.search.Search(ctx, "production deploy failed", chat.ID, search.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 || results[0].Message.Text != texts[0] {
+		t.Fatalf("Expected the deploy message first, got %+v", results)
+	}
+
+	formatted := b.formatSearchResults("production deploy failed", search.ModeSemantic, results, len(results), time.Millisecond, chat.UserName)
+	if !strings.Contains(formatted, texts[0]) || !strings.Contains(formatted, "https://t.me/teamchat/1") {
+		t.Errorf("Expected the deploy message with its link, got:\n%s", formatted)
+	}
+}
+
+// flakyEmbedder fails while down
+type flakyEmbedder struct {
+	*embedding.HashingEmbedder
+	down  bool
+	calls int
+}
+
+func (f *flakyEmbedder) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	f.calls++
+	if f.down {
+		return nil, errors.New("connection refused")
+	}
+	return f.HashingEmbedder.GetEmbeddings(ctx, texts)
+}
+
+func TestEmbeddingOutageFallsBackToKeywords(t *testing.T) {
+	ctx := context.Background()
+	provider := &flakyEmbedder{HashingEmbedder: embedding.NewHashingEmbedder("hashing", 0), down: true}
+	b := newTestBotWith(t, provider, embedding.BreakerSettings{FailureThreshold: 1, OpenTimeout: time.Hour})
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	b.handleMessage(ctx, &tgbotapi.Message{
+		MessageID: 1,
+		From:      &tgbotapi.User{ID: 1, UserName: "alice"},
+		Chat:      chat,
+		Date:      int(time.Now().Unix()),
+		Text:      "The deploy to production failed last night",
+	})
+
+	// The failed batch opens the breaker
+	drainQueue(t, b)
+	if state := b.breaker.Health().State; state != embedding.BreakerOpen {
+		t.Fatalf("Expected an open breaker, got %s", state)
+	}
+
+	// Later attempts wait for the service without calling it
+	jobs, _ := b.db.ClaimEmbeddingJobs(ctx, b.queue.batchSize, time.Now().Add(time.Minute), embeddingLease)
+	b.queue.process(ctx, jobs)
+	if provider.calls != 1 {
+		t.Errorf("Expected the open breaker to skip the service, got %d calls", provider.calls)
+	}
+	if pending, _ := b.db.PendingEmbeddingCount(ctx); pending != 1 {
+		t.Errorf("Expected the message to stay queued, got %d pending", pending)
+	}
+
+	// Searches still find keyword matches
+	results, err := b.search.Search(ctx, "deploy", chat.ID, search.SearchOptions{Mode: search.ModeSemantic})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) != 1 || !results[0].KeywordMatch {
+		t.Errorf("Expected a keyword match, got %+v", results)
+	}
+
+	// /search falls back to keywords up front, telling the user what is lost
+	flags := searchFlags{mode: search.ModeHybrid, history: true}
+	notice := b.keywordFallback(&flags)
+	if flags.mode != search.ModeKeyword || flags.history {
+		t.Errorf("Expected a keyword search without history, got %+v", flags)
+	}
+	if !strings.Contains(notice, "unavailable") || !strings.Contains(notice, "Earlier versions") {
+		t.Errorf("Expected notices for the fallback and the history, got %q", notice)
+	}
+}
+
+func TestQueueShutdownReleasesJobs(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	id, err := b.db.SaveMessageForEmbedding(ctx, database.Message{ChatID: -100, TelegramMessageID: 1, UserID: 1, Text: "deploy failed", Timestamp: time.Now()}, time.Now())
+	if err != nil {
+		t.Fatalf("SaveMessageForEmbedding failed: %v", err)
+	}
+
+	// A batch interrupted by shutdown goes back to the queue right away
+	jobs, _ := b.db.ClaimEmbeddingJobs(ctx, b.queue.batchSize, time.Now(), embeddingLease)
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	b.queue.process(canceled, jobs)
+
+	jobs, _ = b.db.ClaimEmbeddingJobs(ctx, b.queue.batchSize, time.Now(), embeddingLease)
+	if len(jobs) != 1 || jobs[0].MessageID != id || jobs[0].Attempts != 0 {
+		t.Fatalf("Expected the job to be due again without a failed attempt, got %+v", jobs)
+	}
+
+	// Once stopped, the dispatcher and workers exit
+	stop := make(chan struct{})
+	b.queue.Start(ctx, stop)
+	close(stop)
+
+	done := make(chan struct{})
+	go func() {
+		b.queue.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the queue to stop")
+	}
+}
+
+func TestConversationWindowSearch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+	b.search.EnableConversationWindows()
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup", UserName: "teamchat"}
+	start := time.Now().Add(-2 * time.Hour)
+	lines := []struct {
+		user    string
+		text    string
+		replyTo int
+	}{
+		{"alice", "When should we run the database migration?", 0},
+		{"bob", "How about next week", 0},
+		{"carol", "yes, Tuesday works", 1},
+		{"alice", "Great, booked", 0},
+	}
+	for i, line := range lines {
+		message := &tgbotapi.Message{
+			MessageID: i + 1,
+			From:      &tgbotapi.User{ID: int64(i + 1), UserName: line.user},
+			Chat:      chat,
+			Date:      int(start.Add(time.Duration(i) * time.Minute).Unix()),
+			Text:      line.text,
+		}
+		if line.replyTo != 0 {
+			message.ReplyToMessage = &tgbotapi.Message{MessageID: line.replyTo}
+		}
+		b.handleMessage(ctx, message)
+	}
+
+	drainQueue(t, b)
+	b.indexConversations(ctx, time.Now())
+
+	results, err := b.search.Search(ctx, "tuesday works", chat.ID, search.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 || len(results[0].Snippet) != len(lines) {
+		t.Fatalf("Expected the whole conversation as a snippet, got %+v", results)
+	}
+	if results[0].Message.Text != "yes, Tuesday works" {
+		t.Errorf("Expected the matching line to be highlighted, got %q", results[0].Message.Text)
+	}
+
+	formatted := b.formatSearchResults("tuesday works", search.ModeSemantic, results, len(results), time.Millisecond, chat.UserName)
+	if !strings.Contains(formatted, "👉 carol: yes, Tuesday works") || !strings.Contains(formatted, "▫️ alice: When should we run") {
+		t.Errorf("Expected the snippet with the best line marked, got:\n%s", formatted)
+	}
+
+	// Deleting a message drops it from the windows, which are built again
+	deleted := results[0].Message.ID
+	if err := b.db.DeleteMessagesByIDs(ctx, []int64{deleted}); err != nil {
+		t.Fatalf("DeleteMessagesByIDs failed: %v", err)
+	}
+	b.indexConversations(ctx, time.Now())
+
+	results, err = b.search.Search(ctx, "database migration", chat.ID, search.SearchOptions{})
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(results) == 0 || len(results[0].Snippet) != len(lines)-1 {
+		t.Fatalf("Expected the rebuilt window without the deleted message, got %+v", results)
+	}
+	for _, line := range results[0].Snippet {
+		if line.ID == deleted {
+			t.Errorf("Expected the deleted message to be gone from the window")
+		}
+	}
+}
+
+func TestLongMessageChunkSearch(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	var runbook []string
+	for i := 0; i < 40; i++ {
+		runbook = append(runbook, fmt.Sprintf("Step %d: check the dashboard and note the queue depth for shard %d.", i, i))
+	}
+	runbook[30] = "Step 30: rotate the kafka broker certificate through vault before restarting."
+	texts := []string{
+		strings.Join(runbook, " "),
+		"Anyone up for pizza on Friday?",
+		"The nightly build is green again",
+	}
+
+	chat := &tgbotapi.Chat{ID: -100, Type: "supergroup"}
+	for i, text := range texts {
+		b.handleMessage(ctx, &tgbotapi.Message{
+			MessageID: i + 1,
+			From:      &tgbotapi.User{ID: int64(i + 1), UserName: []string{"alice", "bob", "carol"}[i]},
+			Chat:      chat,
+			Date:      int(time.Now().Unix()),
+			Text:      text,
+		})
+	}
+	drainQueue(t, b)
+
+	for _, filter := range []database.MessageFilter{{}, {Usernames: []string{"alice"}}} {
+		results, err := b.search.Search(ctx, "rotate kafka broker certificate vault", chat.ID, search.SearchOptions{Filter: filter, Limit: 5})
+		if err != nil {
+			t.Fatalf("Search failed: %v", err)
+		}
+		if len(results) == 0 || results[0].Message.TelegramMessageID != 1 {
+			t.Fatalf("Expected the runbook first with filter %+v, got %+v", filter, results)
+		}
+		if !strings.Contains(results[0].Passage, runbook[30]) {
+			t.Errorf("Expected the passage with the certificate step, got %q", results[0].Passage)
+		}
+
+		seen := make(map[int64]bool)
+		for _, result := range results {
+			if seen[result.Message.ID] {
+				t.Errorf("Expected one result per message, got message %d twice", result.Message.ID)
+			}
+			seen[result.Message.ID] = true
+		}
+
+		formatted := b.formatSearchResults("kafka certificate", search.ModeSemantic, results, len(results), time.Millisecond, "")
+		if !strings.Contains(formatted, "💬 ...") || strings.Contains(formatted, "Step 0:") {
+			t.Errorf("Expected the matching passage instead of the start of the runbook, got:\n%s", formatted)
+		}
+	}
+
+	// Rebuilt indexes find the chunks again
+	if err := b.search.RebuildIndex(ctx, chat.ID); err != nil {
+		t.Fatalf("RebuildIndex failed: %v", err)
+	}
+	results, _ := b.search.Search(ctx, "rotate kafka broker certificate vault", chat.ID, search.SearchOptions{})
+	if len(results) == 0 || !strings.Contains(results[0].Passage, runbook[30]) {
+		t.Errorf("Expected the passage after rebuilding the index, got %+v", results)
+	}
+}
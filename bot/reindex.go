@@ -0,0 +1,190 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// embeddingReconcileInterval is how often messages left without an
+	// embedding are queued again
+	embeddingReconcileInterval = 30 * time.Minute
+
+	// reindexProgressInterval is how often /reindex edits its progress message
+	reindexProgressInterval = 3 * time.Second
+	// reindexStallTimeout is how long /reindex waits without progress before
+	// it stops reporting and leaves the rest to the queue
+	reindexStallTimeout = 2 * time.Minute
+)
+
+// StartEmbeddingReconciler queues messages stored without an embedding now
+// and then on every interval. The embedding queue retries them with
+// backoff; messages whose jobs gave up are picked up again on a later pass.
+func (b *Bot) StartEmbeddingReconciler(interval time.Duration) {
+	b.every(interval, func(ctx context.Context) {
+		b.reconcileEmbeddings(ctx, time.Now())
+	})
+}
+
+// reconcileEmbeddings queues the messages of every chat that are missing
+// an embedding and not queued yet
+func (b *Bot) reconcileEmbeddings(ctx context.Context, now time.Time) {
+	chatIDs, err := b.db.GetChatIDs(ctx)
+	if err != nil {
+		log.Printf("Error listing chats for embedding backfill: %v", err)
+		return
+	}
+
+	total := 0
+	for _, chatID := range chatIDs {
+		queued, err := b.db.QueueMissingEmbeddings(ctx, chatID, now)
+		if err != nil {
+			log.Printf("Error queueing missing embeddings in chat %d: %v", chatID, err)
+			continue
+		}
+		total += queued
+	}
+
+	if total > 0 {
+		log.Printf("🔁 Queued %d messages without embeddings", total)
+		b.queue.Notify()
+	}
+}
+
+// parseReindexArgs reports whether /reindex should re-embed every message
+// instead of only those without an embedding
+func parseReindexArgs(args string) (all bool, err error) {
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "", "missing":
+		return false, nil
+	case "all":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown option %q, expected missing or all", strings.TrimSpace(args))
+}
+
+// reindexProgress is a snapshot of a running /reindex
+type reindexProgress struct {
+	total    int // messages queued by the command
+	pending  int // messages of the chat still waiting for an embedding
+	retrying int // pending messages that already failed at least once
+}
+
+func (p reindexProgress) done() int {
+	return max(0, min(p.total, p.total-p.pending))
+}
+
+// formatReindexProgress renders the live progress message of /reindex
+func formatReindexProgress(p reindexProgress, elapsed time.Duration, stalled bool) string {
+	done := p.done()
+	percent := float64(done) / float64(max(p.total, 1)) * 100
+
+	var status string
+	switch {
+	case p.pending == 0:
+		status = fmt.Sprintf("✅ *Reindex complete:* %d message%s embedded in %v", p.total, pluralize(p.total), elapsed.Round(time.Second))
+	case stalled:
+		status = "⚠️ *Reindex stalled.* The embedding service isn't responding, I'll keep retrying in the background."
+	default:
+		status = "🔄 *Reindexing...*"
+	}
+
+	text := fmt.Sprintf("%s\n\n📈 *Progress:* %d/%d (%.0f%%)", status, done, p.total, percent)
+	if p.retrying > 0 && p.pending > 0 {
+		text += fmt.Sprintf("\n🔁 *Retrying:* %d message%s", p.retrying, pluralize(p.retrying))
+	}
+	return text
+}
+
+// handleReindexCommand lets admins queue the chat's messages for embedding
+// and follow the progress in a live-edited message
+func (b *Bot) handleReindexCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if !b.requireAdmin(message) {
+		return
+	}
+
+	all, err := parseReindexArgs(args)
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf(`❌ %s
+
+*Usage:*
+• `+"`/reindex`"+` - embed messages that are missing an embedding
+• `+"`/reindex all`"+` - re-embed every message in this chat`, err.Error()))
+		return
+	}
+
+	total, err := b.db.RequeueEmbeddings(ctx, message.Chat.ID, !all, time.Now())
+	if err != nil {
+		log.Printf("Error queueing reindex: %v", err)
+		b.sendReply(message, "❌ I couldn't start reindexing right now. Please try again.")
+		return
+	}
+	if total == 0 {
+		b.sendReply(message, "✅ Every message in this chat already has an embedding.")
+		return
+	}
+	b.queue.Notify()
+	log.Printf("🔁 Reindexing %d messages in chat %d (all: %v)", total, message.Chat.ID, all)
+
+	progress := reindexProgress{total: total, pending: total}
+	reply := tgbotapi.NewMessage(message.Chat.ID, formatReindexProgress(progress, 0, false))
+	reply.ParseMode = "Markdown"
+	reply.ReplyToMessageID = message.MessageID
+	sent, err := b.api.Send(reply)
+	if err != nil {
+		log.Printf("Error sending reindex progress: %v", err)
+		return
+	}
+
+	b.spawn(func() { b.trackReindex(ctx, message.Chat.ID, sent.MessageID, progress) })
+}
+
+// trackReindex edits the progress message until the chat's queue is empty
+// or stops moving
+func (b *Bot) trackReindex(ctx context.Context, chatID int64, messageID int, progress reindexProgress) {
+	ticker := time.NewTicker(reindexProgressInterval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	lastProgress := start
+	lastText := formatReindexProgress(progress, 0, false)
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.stopping:
+			return // The queue picks the rest up after a restart
+		}
+
+		pending, retrying, err := b.db.ChatEmbeddingBacklog(ctx, chatID)
+		if err != nil {
+			log.Printf("Error reading reindex progress: %v", err)
+			continue
+		}
+
+		if pending < progress.pending {
+			lastProgress = time.Now()
+		}
+		progress.pending, progress.retrying = pending, retrying
+		stalled := time.Since(lastProgress) > reindexStallTimeout
+
+		text := formatReindexProgress(progress, time.Since(start), stalled)
+		if text != lastText {
+			edit := tgbotapi.NewEditMessageText(chatID, messageID, text)
+			edit.ParseMode = "Markdown"
+			if _, err := b.api.Send(edit); err != nil {
+				log.Printf("Error editing reindex progress: %v", err)
+			}
+			lastText = text
+		}
+
+		if pending == 0 || stalled {
+			return
+		}
+	}
+}
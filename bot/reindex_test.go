@@ -0,0 +1,42 @@
+package bot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseReindexArgs(t *testing.T) {
+	if all, err := parseReindexArgs(""); err != nil || all {
+		t.Errorf("Expected missing-only reindex by default, got %v, %v", all, err)
+	}
+	if all, err := parseReindexArgs(" ALL "); err != nil || !all {
+		t.Errorf("Expected full reindex, got %v, %v", all, err)
+	}
+	if _, err := parseReindexArgs("everything"); err == nil {
+		t.Error("Expected error for unknown option")
+	}
+}
+
+func TestFormatReindexProgress(t *testing.T) {
+	running := formatReindexProgress(reindexProgress{total: 10, pending: 4, retrying: 2}, time.Second, false)
+	if !strings.Contains(running, "6/10 (60%)") || !strings.Contains(running, "Retrying:* 2 messages") {
+		t.Errorf("Unexpected progress message: %s", running)
+	}
+
+	// New messages queued meanwhile don't push progress below zero
+	busy := formatReindexProgress(reindexProgress{total: 10, pending: 12}, time.Second, false)
+	if !strings.Contains(busy, "0/10") {
+		t.Errorf("Unexpected progress message: %s", busy)
+	}
+
+	stalled := formatReindexProgress(reindexProgress{total: 10, pending: 4}, time.Minute, true)
+	if !strings.Contains(stalled, "stalled") {
+		t.Errorf("Expected stalled notice, got: %s", stalled)
+	}
+
+	done := formatReindexProgress(reindexProgress{total: 1}, 90*time.Second, false)
+	if !strings.Contains(done, "1 message embedded in 1m30s") || !strings.Contains(done, "1/1 (100%)") {
+		t.Errorf("Unexpected completion message: %s", done)
+	}
+}
@@ -0,0 +1,172 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// retentionSweepInterval is how often expired messages are purged
+const retentionSweepInterval = time.Hour
+
+// embeddingCacheRows is how many cached embeddings the database keeps
+const embeddingCacheRows = 100000
+
+// StartRetentionSweeper purges messages older than each chat's retention
+// window now and then on every interval
+func (b *Bot) StartRetentionSweeper(interval time.Duration) {
+	b.every(interval, func(ctx context.Context) {
+		b.sweepRetention(ctx, time.Now())
+	})
+}
+
+// sweepRetention deletes the messages that fell out of their chat's
+// retention window
+func (b *Bot) sweepRetention(ctx context.Context, now time.Time) {
+	chatIDs, err := b.db.GetChatIDs(ctx)
+	if err != nil {
+		log.Printf("Error listing chats for retention sweep: %v", err)
+		return
+	}
+
+	for _, chatID := range chatIDs {
+		b.purgeExpired(ctx, chatID, now)
+	}
+
+	// Keep the persistent embedding cache bounded, dropping the oldest entries
+	if pruned, err := b.db.PruneEmbeddingCache(ctx, embeddingCacheRows); err != nil {
+		log.Printf("Error pruning embedding cache: %v", err)
+	} else if pruned > 0 {
+		log.Printf("🗑️ Pruned %d cached embeddings", pruned)
+	}
+}
+
+// purgeExpired deletes the messages of a chat that are older than its
+// retention window
+func (b *Bot) purgeExpired(ctx context.Context, chatID int64, now time.Time) {
+	days, err := b.retentionDays(ctx, chatID)
+	if err != nil {
+		log.Printf("Error reading retention for chat %d: %v", chatID, err)
+		return
+	}
+	if days == 0 {
+		return
+	}
+
+	ids, err := b.db.DeleteMessages(ctx, chatID, database.MessageFilter{Before: now.AddDate(0, 0, -days)})
+	if err != nil {
+		log.Printf("Error purging expired messages in chat %d: %v", chatID, err)
+		return
+	}
+
+	if len(ids) > 0 {
+		b.forgetIndexed(chatID, ids)
+		log.Printf("🗑️ Purged %d messages older than %d days in chat %d", len(ids), days, chatID)
+	}
+}
+
+// retentionDays returns the retention window of a chat, 0 meaning forever
+func (b *Bot) retentionDays(ctx context.Context, chatID int64) (int, error) {
+	days, ok, err := b.db.GetRetentionDays(ctx, chatID)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return b.config.RetentionDays, nil
+	}
+	return days, nil
+}
+
+// forgetIndexed removes deleted messages from the search index and drops
+// cached result pages that could still show them
+func (b *Bot) forgetIndexed(chatID int64, ids []int64) {
+	for _, id := range ids {
+		b.search.RemoveMessage(chatID, id)
+	}
+	b.results.removeChat(chatID)
+	b.inline.removeChat(chatID)
+}
+
+// retentionSetting is a parsed /retention argument
+type retentionSetting struct {
+	days  int
+	reset bool // go back to the configured default
+}
+
+// parseRetentionArg accepts a number of days, "off" or "default"
+func parseRetentionArg(arg string) (retentionSetting, error) {
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "off", "forever", "0":
+		return retentionSetting{days: 0}, nil
+	case "default", "reset":
+		return retentionSetting{reset: true}, nil
+	}
+
+	days, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(arg), "d"))
+	if err != nil || days < 0 {
+		return retentionSetting{}, fmt.Errorf("invalid retention %q, expected a number of days, off or default", arg)
+	}
+	return retentionSetting{days: days}, nil
+}
+
+func describeRetention(days int) string {
+	if days == 0 {
+		return "messages are kept forever"
+	}
+	return fmt.Sprintf("messages are deleted after %d day%s", days, pluralize(days))
+}
+
+// handleRetentionCommand shows or, for admins, changes the chat's retention
+// window
+func (b *Bot) handleRetentionCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if strings.TrimSpace(args) == "" {
+		days, err := b.retentionDays(ctx, message.Chat.ID)
+		if err != nil {
+			log.Printf("Error reading retention: %v", err)
+			b.sendReply(message, "❌ I couldn't read the retention setting right now. Please try again.")
+			return
+		}
+
+		b.sendReply(message, fmt.Sprintf(`🗓️ *Retention:* %s
+
+*Admins can change it:*
+• `+"`/retention 30`"+` - delete messages after 30 days
+• `+"`/retention off`"+` - keep messages forever
+• `+"`/retention default`"+` - use the bot default (%s)`,
+			describeRetention(days), describeRetention(b.config.RetentionDays)))
+		return
+	}
+
+	if !b.requireAdmin(message) {
+		return
+	}
+
+	setting, err := parseRetentionArg(args)
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/retention 30`", err.Error()))
+		return
+	}
+
+	if setting.reset {
+		err = b.db.ClearRetentionDays(ctx, message.Chat.ID)
+	} else {
+		err = b.db.SetRetentionDays(ctx, message.Chat.ID, setting.days)
+	}
+	if err != nil {
+		log.Printf("Error saving retention: %v", err)
+		b.sendReply(message, "❌ I couldn't save the retention setting right now. Please try again.")
+		return
+	}
+
+	days, _ := b.retentionDays(ctx, message.Chat.ID)
+	b.sendReply(message, fmt.Sprintf("✅ *Retention updated:* %s", describeRetention(days)))
+
+	// Apply a shorter window right away instead of waiting for the sweeper
+	b.spawn(func() { b.purgeExpired(ctx, message.Chat.ID, time.Now()) })
+}
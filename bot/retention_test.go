@@ -0,0 +1,48 @@
+package bot
+
+import "testing"
+
+func TestParseRetentionArg(t *testing.T) {
+	tests := []struct {
+		arg      string
+		expected retentionSetting
+	}{
+		{"30", retentionSetting{days: 30}},
+		{"90d", retentionSetting{days: 90}},
+		{"off", retentionSetting{days: 0}},
+		{"Forever", retentionSetting{days: 0}},
+		{"default", retentionSetting{reset: true}},
+	}
+
+	for _, tt := range tests {
+		setting, err := parseRetentionArg(tt.arg)
+		if err != nil {
+			t.Errorf("parseRetentionArg(%q) failed: %v", tt.arg, err)
+			continue
+		}
+		if setting != tt.expected {
+			t.Errorf("parseRetentionArg(%q): expected %+v, got %+v", tt.arg, tt.expected, setting)
+		}
+	}
+
+	for _, bad := range []string{"-1", "a month", "30x"} {
+		if _, err := parseRetentionArg(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestResultCacheRemoveChat(t *testing.T) {
+	cache := newResultCache(resultCacheTTL)
+	purged := cache.put(&cachedSearch{chatID: 1})
+	kept := cache.put(&cachedSearch{chatID: 2})
+
+	cache.removeChat(1)
+
+	if _, ok := cache.get(purged); ok {
+		t.Error("Expected results of the purged chat to be dropped")
+	}
+	if _, ok := cache.get(kept); !ok {
+		t.Error("Expected results of other chats to be kept")
+	}
+}
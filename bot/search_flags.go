@@ -0,0 +1,69 @@
+package bot
+
+import (
+	"fmt"
+	"semantic-search-bot/embedding"
+	"semantic-search-bot/search"
+	"strings"
+)
+
+// searchFlags holds the --flags accepted by /search
+type searchFlags struct {
+	mode    search.Mode
+	history bool // also match earlier versions of edited messages
+	private bool // send the results to the requester's private chat
+}
+
+// parseSearchFlags strips leading --flags (e.g. --mode=hybrid, --history,
+// --private) from the /search arguments and returns them along with the
+// remaining query
+func parseSearchFlags(args string) (searchFlags, string, error) {
+	flags := searchFlags{mode: search.ModeSemantic}
+
+	fields := strings.Fields(args)
+	i := 0
+	for ; i < len(fields) && strings.HasPrefix(fields[i], "--"); i++ {
+		name, value, _ := strings.Cut(strings.TrimPrefix(fields[i], "--"), "=")
+
+		switch strings.ToLower(name) {
+		case "mode":
+			mode, err := search.ParseMode(value)
+			if err != nil {
+				return flags, "", err
+			}
+			flags.mode = mode
+		case "hybrid", "keyword", "semantic":
+			flags.mode = search.Mode(strings.ToLower(name))
+		case "history":
+			flags.history = true
+		case "private":
+			flags.private = true
+		default:
+			return flags, "", fmt.Errorf("unknown option --%s", name)
+		}
+	}
+
+	// Earlier versions are only matched by their embeddings, the keyword
+	// index holds the current text of messages alone
+	if flags.history && flags.mode == search.ModeKeyword {
+		return flags, "", fmt.Errorf("--history doesn't work in keyword mode: earlier versions of edited messages are matched by meaning, and the keyword index only holds the current text")
+	}
+
+	return flags, strings.Join(fields[i:], " "), nil
+}
+
+// keywordFallback switches a search to keyword mode while the embedding
+// service is known to be down, returning a notice telling the user so
+func (b *Bot) keywordFallback(flags *searchFlags) string {
+	if flags.mode == search.ModeKeyword || b.breaker.Health().State != embedding.BreakerOpen {
+		return ""
+	}
+
+	flags.mode = search.ModeKeyword
+	notice := "\n⚠️ *My AI service is unavailable right now, so I'm matching keywords only.*"
+	if flags.history {
+		flags.history = false
+		notice += "\n⚠️ *Earlier versions of edited messages can only be matched by meaning, so they aren't searched.*"
+	}
+	return notice
+}
@@ -0,0 +1,38 @@
+package bot
+
+import (
+	"semantic-search-bot/search"
+	"testing"
+)
+
+func TestParseSearchFlags(t *testing.T) {
+	tests := []struct {
+		args  string
+		flags searchFlags
+		query string
+	}{
+		{"deploy plan", searchFlags{mode: search.ModeSemantic}, "deploy plan"},
+		{"--mode=hybrid INC-1234", searchFlags{mode: search.ModeHybrid}, "INC-1234"},
+		{"--keyword --private db01.prod", searchFlags{mode: search.ModeKeyword, private: true}, "db01.prod"},
+		{"--history --hybrid deploy", searchFlags{mode: search.ModeHybrid, history: true}, "deploy"},
+		{"deploy --history", searchFlags{mode: search.ModeSemantic}, "deploy --history"},
+	}
+	for _, tt := range tests {
+		flags, query, err := parseSearchFlags(tt.args)
+		if err != nil {
+			t.Errorf("parseSearchFlags(%q) failed: %v", tt.args, err)
+			continue
+		}
+		if flags != tt.flags || query != tt.query {
+			t.Errorf("parseSearchFlags(%q) = %+v %q, expected %+v %q", tt.args, flags, query, tt.flags, tt.query)
+		}
+	}
+
+	// Earlier versions can't be matched by keyword, so asking for both fails
+	// instead of silently ignoring --history
+	for _, args := range []string{"--history --mode=keyword deploy", "--keyword --history deploy", "--verbose deploy", "--mode=fuzzy deploy"} {
+		if _, _, err := parseSearchFlags(args); err == nil {
+			t.Errorf("Expected an error for %q", args)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"semantic-search-bot/search"
+	"sort"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// searchAllPerChat caps the results /searchall shows from each chat
+	searchAllPerChat = 3
+	// searchAllMaxChats caps the chats listed in a /searchall reply
+	searchAllMaxChats = 5
+)
+
+// chatResults are the matches found in one of the user's chats
+type chatResults struct {
+	chat    database.MemberChat
+	results []search.SearchResult
+}
+
+// handleSearchAllCommand searches every chat the user belongs to and lists
+// the matches grouped by chat. It only runs in private chats, since the
+// results would otherwise be shown to members of other chats.
+func (b *Bot) handleSearchAllCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if !message.Chat.IsPrivate() {
+		b.sendReply(message, "🔒 /searchall shows messages from all your chats, so it only works in a private chat with me.")
+		return
+	}
+
+	flags, query, err := parseSearchFlags(args)
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/searchall --mode=hybrid INC-1234`", err.Error()))
+		return
+	}
+
+	parsed, err := search.ParseQuery(query, time.Now())
+	if err != nil {
+		b.sendReply(message, fmt.Sprintf("❌ %s\n\n💡 *Try:* `/searchall from:@alice after:7d deploy`", err.Error()))
+		return
+	}
+
+	if strings.TrimSpace(parsed.Text) == "" && parsed.Filter.IsEmpty() {
+		b.sendReply(message, `🔍 *Search All Your Chats*
+
+*How to search:* `+"`/searchall <your question or keywords>`"+`
+
+I look through every chat you have posted in and still belong to, and group the matches by chat. The same options and filters as /search work here, e.g. `+"`/searchall --mode=hybrid from:@alice deploy`"+`.`)
+		return
+	}
+
+	notice := b.keywordFallback(&flags)
+
+	startTime := time.Now()
+	groups, err := b.searchAll(ctx, message.From.ID, parsed, flags)
+	searchDuration := time.Since(startTime)
+	b.perf.RecordSearchTime(searchDuration)
+
+	if err != nil {
+		log.Printf("Search all error: %v", err)
+		b.sendReply(message, "❌ I couldn't search your chats right now. Please try again.")
+		return
+	}
+	if len(groups) == 0 {
+		b.sendReply(message, fmt.Sprintf("🔍 No matches for \"%s\" in your chats.\n\n💡 I only search chats you have posted in since I joined them.%s", query, notice))
+		return
+	}
+
+	b.sendReply(message, formatSearchAll(query, groups, searchDuration)+notice)
+
+	log.Printf("Search all completed: query='%s', mode=%s, chats=%d, duration=%v, user=%d",
+		query, flags.mode, len(groups), searchDuration, message.From.ID)
+}
+
+// searchAll runs a search in every chat the user may search from outside
+// it, returning the chats with matches, best match first
+func (b *Bot) searchAll(ctx context.Context, userID int64, parsed search.Query, flags searchFlags) ([]chatResults, error) {
+	chats, err := b.memberChats(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []chatResults
+	for _, chat := range chats {
+		results, err := b.search.Search(ctx, parsed.Text, chat.ChatID, search.SearchOptions{
+			Mode:         flags.mode,
+			Filter:       parsed.Filter,
+			Limit:        searchAllPerChat,
+			IncludeEdits: flags.history,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search chat %d: %w", chat.ChatID, err)
+		}
+		if len(results) > 0 {
+			groups = append(groups, chatResults{chat: chat, results: results})
+		}
+	}
+
+	// Chats with equally good matches stay in order of recent activity
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].results[0].Similarity > groups[j].results[0].Similarity
+	})
+	return groups, nil
+}
+
+// formatSearchAll renders the matches of a /searchall grouped by chat
+func formatSearchAll(query string, groups []chatResults, searchDuration time.Duration) string {
+	var msg strings.Builder
+
+	msg.WriteString(fmt.Sprintf("🎯 *Found matches in %d chat%s*\n", len(groups), pluralize(len(groups))))
+	msg.WriteString(fmt.Sprintf("📝 *Search:* \"%s\" | ⚡ *Speed:* %v\n\n", query, formatDuration(searchDuration)))
+
+	for _, group := range groups[:min(len(groups), searchAllMaxChats)] {
+		msg.WriteString(fmt.Sprintf("💬 *%s*\n", group.chat.Title))
+		for i, result := range group.results {
+			msg.WriteString(fmt.Sprintf("*%d.* %s • 👤 %s • 📅 %s", i+1, matchLabel(result),
+				getDisplayName(result.Message.Username), result.Message.Timestamp.Format("Jan 2 at 15:04")))
+			if link := messageLink(result.Message.ChatID, "", result.Message); link != "" {
+				msg.WriteString(fmt.Sprintf(" • [🔗 Jump](%s)", link))
+			}
+			msg.WriteString(fmt.Sprintf("\n%s%s\n", contentIcon(result.Message.ContentType), truncateText(result.Message.Text, 150)))
+		}
+		msg.WriteString("\n")
+	}
+
+	if hidden := len(groups) - searchAllMaxChats; hidden > 0 {
+		msg.WriteString(fmt.Sprintf("➕ _%d more chat%s had matches, try a more specific query_\n\n", hidden, pluralize(hidden)))
+	}
+	msg.WriteString("💡 *Tip:* Chat admins can hide a chat from these searches with /crosschat off")
+	return msg.String()
+}
+
+// matchLabel describes how a result matched the query
+func matchLabel(result search.SearchResult) string {
+	switch {
+	case result.Similarity == 0 && !result.KeywordMatch:
+		return "📌 filter match"
+	case result.Similarity == 0:
+		return "🔤 keyword match"
+	}
+	return fmt.Sprintf("*%.0f%% match*", result.Similarity*100)
+}
+
+// handleCrossChatCommand shows or, for admins, changes whether members can
+// find the chat's messages from other chats with /searchall and inline mode
+func (b *Bot) handleCrossChatCommand(ctx context.Context, message *tgbotapi.Message, args string) {
+	if strings.TrimSpace(args) == "" {
+		enabled, err := b.db.GetCrossChatSearch(ctx, message.Chat.ID)
+		if err != nil {
+			log.Printf("Error reading cross-chat search setting: %v", err)
+			b.sendReply(message, "❌ I couldn't read the setting right now. Please try again.")
+			return
+		}
+
+		b.sendReply(message, fmt.Sprintf(`🌐 *Searches from other chats:* %s
+
+*Admins can change it:*
+• `+"`/crosschat on`"+` - members can find this chat's messages with /searchall and inline mode
+• `+"`/crosschat off`"+` - this chat can only be searched from inside it`, describeCrossChat(enabled)))
+		return
+	}
+
+	if !b.requireAdmin(message) {
+		return
+	}
+
+	var enabled bool
+	switch strings.ToLower(strings.TrimSpace(args)) {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		b.sendReply(message, "❌ Expected on or off\n\n💡 *Try:* `/crosschat off`")
+		return
+	}
+
+	if err := b.db.SetCrossChatSearch(ctx, message.Chat.ID, enabled); err != nil {
+		log.Printf("Error saving cross-chat search setting: %v", err)
+		b.sendReply(message, "❌ I couldn't save the setting right now. Please try again.")
+		return
+	}
+	b.inline.removeChat(message.Chat.ID)
+
+	b.sendReply(message, fmt.Sprintf("✅ *Searches from other chats:* %s", describeCrossChat(enabled)))
+}
+
+func describeCrossChat(enabled bool) string {
+	if enabled {
+		return "allowed"
+	}
+	return "off"
+}
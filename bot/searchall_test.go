@@ -0,0 +1,78 @@
+package bot
+
+import (
+	"context"
+	"semantic-search-bot/search"
+	"strings"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestSearchAll(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBot(t)
+
+	alice := &tgbotapi.User{ID: 1, UserName: "alice"}
+	ops := &tgbotapi.Chat{ID: -1001, Type: "supergroup", Title: "Ops"}
+	infra := &tgbotapi.Chat{ID: -1002, Type: "supergroup", Title: "Infra"}
+	private := &tgbotapi.Chat{ID: -1003, Type: "supergroup", Title: "Leadership"}
+	quiet := &tgbotapi.Chat{ID: -1004, Type: "supergroup", Title: "Random"}
+
+	date := int(time.Now().Unix())
+	messages := []*tgbotapi.Message{
+		{MessageID: 1, From: alice, Chat: ops, Date: date, Text: "Deploy rollback steps are in the wiki"},
+		{MessageID: 2, From: alice, Chat: ops, Date: date, Text: "The deploy rollback needs a ticket"},
+		{MessageID: 1, From: alice, Chat: infra, Date: date, Text: "The deploy rollback failed on db01"},
+		{MessageID: 1, From: alice, Chat: private, Date: date, Text: "Deploy rollback budget review"},
+		{MessageID: 1, From: alice, Chat: quiet, Date: date, Text: "Anyone up for pizza on Friday?"},
+	}
+	for _, message := range messages {
+		b.handleMessage(ctx, message)
+	}
+	drainQueue(t, b)
+
+	for _, chat := range []*tgbotapi.Chat{ops, infra, private, quiet} {
+		b.access.setMember(chat.ID, alice.ID, true)
+	}
+	if err := b.db.SetCrossChatSearch(ctx, private.ID, false); err != nil {
+		t.Fatalf("SetCrossChatSearch failed: %v", err)
+	}
+
+	parsed, _ := search.ParseQuery("deploy rollback", time.Now())
+	groups, err := b.searchAll(ctx, alice.ID, parsed, searchFlags{mode: search.ModeSemantic})
+	if err != nil {
+		t.Fatalf("searchAll failed: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, group := range groups {
+		counts[group.chat.Title] = len(group.results)
+		for _, result := range group.results {
+			if result.Message.ChatID != group.chat.ChatID {
+				t.Errorf("Expected %s to hold only its own messages, got one from chat %d", group.chat.Title, result.Message.ChatID)
+			}
+		}
+	}
+	if counts["Ops"] != 2 || counts["Infra"] != 1 {
+		t.Errorf("Expected matches grouped by chat, got %v", counts)
+	}
+	if _, ok := counts["Leadership"]; ok {
+		t.Error("Expected the opted out chat to be skipped")
+	}
+
+	formatted := formatSearchAll("deploy rollback", groups, time.Millisecond)
+	if !strings.Contains(formatted, "💬 *Ops*") || !strings.Contains(formatted, "💬 *Infra*") || strings.Contains(formatted, "budget") {
+		t.Errorf("Expected results under their chat titles, got:\n%s", formatted)
+	}
+
+	// Chats the user left are skipped too
+	b.access.setMember(infra.ID, alice.ID, false)
+	groups, _ = b.searchAll(ctx, alice.ID, parsed, searchFlags{mode: search.ModeSemantic})
+	for _, group := range groups {
+		if group.chat.ChatID == infra.ID {
+			t.Error("Expected the chat alice left to be skipped")
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package bot
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// threadTTL bounds how long an unclaimed thread ID is remembered
+const threadTTL = 10 * time.Minute
+
+// threadTracker records the forum topic (message_thread_id) of incoming
+// messages. go-telegram-bot-api v5.5.1 predates forum topics and drops the
+// field while decoding updates, so it wraps the API's HTTP client and reads
+// it from the raw getUpdates responses instead.
+type threadTracker struct {
+	client  tgbotapi.HTTPClient
+	threads map[threadKey]trackedThread
+	mutex   sync.Mutex
+}
+
+type threadKey struct {
+	chatID    int64
+	messageID int
+}
+
+type trackedThread struct {
+	threadID int
+	seen     time.Time
+}
+
+type rawUpdates struct {
+	Result []struct {
+		Message       *rawThreadMessage `json:"message"`
+		EditedMessage *rawThreadMessage `json:"edited_message"`
+	} `json:"result"`
+}
+
+// rawThreadMessage holds the topic fields of a message. Replies in groups
+// without topics carry a message_thread_id too, so only messages flagged
+// with is_topic_message belong to a forum topic.
+type rawThreadMessage struct {
+	MessageID       int  `json:"message_id"`
+	MessageThreadID int  `json:"message_thread_id"`
+	IsTopicMessage  bool `json:"is_topic_message"`
+	Chat            struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
+func newThreadTracker(client tgbotapi.HTTPClient) *threadTracker {
+	return &threadTracker{
+		client:  client,
+		threads: make(map[threadKey]trackedThread),
+	}
+}
+
+// Do implements tgbotapi.HTTPClient
+func (t *threadTracker) Do(req *http.Request) (*http.Response, error) {
+	resp, err := t.client.Do(req)
+	if err != nil || !strings.HasSuffix(req.URL.Path, "/getUpdates") {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.record(body)
+	return resp, nil
+}
+
+func (t *threadTracker) record(body []byte) {
+	var updates rawUpdates
+	if err := json.Unmarshal(body, &updates); err != nil {
+		return // Let the library report malformed responses
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	for key, thread := range t.threads {
+		if now.Sub(thread.seen) > threadTTL {
+			delete(t.threads, key)
+		}
+	}
+
+	for _, update := range updates.Result {
+		for _, msg := range []*rawThreadMessage{update.Message, update.EditedMessage} {
+			if msg != nil && msg.IsTopicMessage && msg.MessageThreadID != 0 {
+				t.threads[threadKey{msg.Chat.ID, msg.MessageID}] = trackedThread{msg.MessageThreadID, now}
+			}
+		}
+	}
+}
+
+// threadID returns the forum topic of a received message, or 0 if it was
+// not posted in a topic
+func (t *threadTracker) threadID(chatID int64, messageID int) int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	key := threadKey{chatID, messageID}
+	thread, exists := t.threads[key]
+	if !exists {
+		return 0
+	}
+	delete(t.threads, key)
+	return thread.threadID
+}
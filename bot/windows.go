@@ -0,0 +1,36 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// conversationIndexInterval is how often new messages are grouped into
+// conversation windows
+const conversationIndexInterval = time.Minute
+
+// StartConversationIndexer keeps the conversation windows of every chat up
+// to date, for CONTEXT_WINDOWS
+func (b *Bot) StartConversationIndexer(interval time.Duration) {
+	b.every(interval, func(ctx context.Context) {
+		b.indexConversations(ctx, time.Now())
+	})
+}
+
+// indexConversations windows and embeds the new and changed conversations
+// of every chat
+func (b *Bot) indexConversations(ctx context.Context, now time.Time) {
+	chatIDs, err := b.db.GetChatIDs(ctx)
+	if err != nil {
+		log.Printf("Error listing chats for conversation windows: %v", err)
+		return
+	}
+
+	for _, chatID := range chatIDs {
+		if err := b.search.IndexConversations(ctx, chatID, now); err != nil {
+			// Whatever is left is picked up by the next pass
+			log.Printf("Error indexing conversations of chat %d: %v", chatID, err)
+		}
+	}
+}
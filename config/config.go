@@ -3,18 +3,37 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	TelegramToken   string
-	DatabasePath    string
-	EmbeddingAPIURL string
-	EmbeddingModel  string
-	MaxResults      int
+	TelegramToken     string
+	DatabasePath      string
+	EmbeddingProvider string // ollama, openai or hashing
+	EmbeddingAPIURL   string
+	EmbeddingAPIKey   string // bearer token for OpenAI-compatible servers, if required
+	EmbeddingModel    string
+	MaxResults        int
+	RetentionDays     int // default retention window for every chat, 0 keeps messages forever
+
+	EmbeddingWorkers   int // concurrent embedding requests
+	EmbeddingBatchSize int // messages embedded per request
+	EmbeddingCacheSize int // embeddings kept in memory by text hash
+
+	BreakerFailures  int // consecutive embedding failures that open the circuit breaker
+	BreakerCooldown  int // seconds the breaker stays open before probing the service
+	BreakerSuccesses int // successful probes that close the breaker again
+
+	ContextWindows bool // also embed conversation windows and rank them in semantic searches
+
+	DocumentMaxSize int // MB of an attached file downloaded to index its text, 0 disables it
 }
 
+// maxDocumentSize is the largest file bots can download from the Bot API, in MB
+const maxDocumentSize = 20
+
 func Load() *Config {
 	// Load .env file if it exists
 	if err := godotenv.Load(); err != nil {
@@ -22,12 +41,43 @@ func Load() *Config {
 		log.Println("Using environment variables or defaults")
 	}
 
+	provider := getEnv("EMBEDDING_PROVIDER", "ollama")
+	defaultAPIURL := "http://localhost:11434"
+	defaultModel := "all-minilm:latest"
+	switch provider {
+	case "openai":
+		defaultAPIURL = "http://localhost:8080" // llama.cpp server
+	case "hashing":
+		defaultModel = "hashing" // offline, no API
+	}
+
+	documentMaxSize := getEnvInt("DOCUMENT_MAX_SIZE_MB", 10)
+	if documentMaxSize > maxDocumentSize {
+		log.Printf("DOCUMENT_MAX_SIZE_MB %d exceeds the Bot API download limit, using %d", documentMaxSize, maxDocumentSize)
+		documentMaxSize = maxDocumentSize
+	}
+
 	return &Config{
-		TelegramToken:   getEnv("TELEGRAM_TOKEN", ""),
-		DatabasePath:    getEnv("DATABASE_PATH", "./messages.db"),
-		EmbeddingAPIURL: getEnv("EMBEDDING_API_URL", "http://localhost:11434"),
-		EmbeddingModel:  getEnv("EMBEDDING_MODEL", "all-minilm:latest"),
-		MaxResults:      3,
+		TelegramToken:     getEnv("TELEGRAM_TOKEN", ""),
+		DatabasePath:      getEnv("DATABASE_PATH", "./messages.db"),
+		EmbeddingProvider: provider,
+		EmbeddingAPIURL:   getEnv("EMBEDDING_API_URL", defaultAPIURL),
+		EmbeddingAPIKey:   getEnv("EMBEDDING_API_KEY", ""),
+		EmbeddingModel:    getEnv("EMBEDDING_MODEL", defaultModel),
+		MaxResults:        3,
+		RetentionDays:     getEnvInt("RETENTION_DAYS", 0),
+
+		EmbeddingWorkers:   getEnvInt("EMBEDDING_WORKERS", 2),
+		EmbeddingBatchSize: getEnvInt("EMBEDDING_BATCH_SIZE", 16),
+		EmbeddingCacheSize: getEnvInt("EMBEDDING_CACHE_SIZE", 10000),
+
+		BreakerFailures:  getEnvInt("EMBEDDING_BREAKER_FAILURES", 5),
+		BreakerCooldown:  getEnvInt("EMBEDDING_BREAKER_COOLDOWN", 30),
+		BreakerSuccesses: getEnvInt("EMBEDDING_BREAKER_SUCCESSES", 2),
+
+		ContextWindows: getEnvBool("CONTEXT_WINDOWS", false),
+
+		DocumentMaxSize: documentMaxSize,
 	}
 }
 
@@ -37,3 +87,31 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < 0 {
+		log.Printf("Invalid value %q for %s, using default %d", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Invalid value %q for %s, using default %t", value, key, defaultValue)
+		return defaultValue
+	}
+	return parsed
+}
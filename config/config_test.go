@@ -39,8 +39,19 @@ func TestLoadConfigDefaults(t *testing.T) {
 	// Clear environment variables
 	os.Unsetenv("TELEGRAM_TOKEN")
 	os.Unsetenv("DATABASE_PATH")
+	os.Unsetenv("EMBEDDING_PROVIDER")
 	os.Unsetenv("EMBEDDING_API_URL")
+	os.Unsetenv("EMBEDDING_API_KEY")
 	os.Unsetenv("EMBEDDING_MODEL")
+	os.Unsetenv("RETENTION_DAYS")
+	os.Unsetenv("EMBEDDING_WORKERS")
+	os.Unsetenv("EMBEDDING_BATCH_SIZE")
+	os.Unsetenv("EMBEDDING_CACHE_SIZE")
+	os.Unsetenv("EMBEDDING_BREAKER_FAILURES")
+	os.Unsetenv("EMBEDDING_BREAKER_COOLDOWN")
+	os.Unsetenv("EMBEDDING_BREAKER_SUCCESSES")
+	os.Unsetenv("CONTEXT_WINDOWS")
+	os.Unsetenv("DOCUMENT_MAX_SIZE_MB")
 
 	cfg := Load()
 
@@ -53,6 +64,10 @@ func TestLoadConfigDefaults(t *testing.T) {
 		t.Errorf("Expected default database path './messages.db', got '%s'", cfg.DatabasePath)
 	}
 
+	if cfg.EmbeddingProvider != "ollama" {
+		t.Errorf("Expected default provider 'ollama', got '%s'", cfg.EmbeddingProvider)
+	}
+
 	if cfg.EmbeddingAPIURL != "http://localhost:11434" {
 		t.Errorf("Expected default API URL, got '%s'", cfg.EmbeddingAPIURL)
 	}
@@ -64,6 +79,65 @@ func TestLoadConfigDefaults(t *testing.T) {
 	if cfg.MaxResults != 3 {
 		t.Errorf("Expected MaxResults 3, got %d", cfg.MaxResults)
 	}
+
+	if cfg.RetentionDays != 0 {
+		t.Errorf("Expected RetentionDays 0, got %d", cfg.RetentionDays)
+	}
+
+	if cfg.EmbeddingWorkers != 2 || cfg.EmbeddingBatchSize != 16 {
+		t.Errorf("Expected 2 embedding workers with batches of 16, got %d and %d", cfg.EmbeddingWorkers, cfg.EmbeddingBatchSize)
+	}
+
+	if cfg.EmbeddingCacheSize != 10000 {
+		t.Errorf("Expected EmbeddingCacheSize 10000, got %d", cfg.EmbeddingCacheSize)
+	}
+
+	if cfg.BreakerFailures != 5 || cfg.BreakerCooldown != 30 || cfg.BreakerSuccesses != 2 {
+		t.Errorf("Expected breaker thresholds 5/30/2, got %d/%d/%d", cfg.BreakerFailures, cfg.BreakerCooldown, cfg.BreakerSuccesses)
+	}
+
+	if cfg.ContextWindows {
+		t.Errorf("Expected conversation windows to be off by default")
+	}
+
+	if cfg.DocumentMaxSize != 10 {
+		t.Errorf("Expected DocumentMaxSize 10, got %d", cfg.DocumentMaxSize)
+	}
+}
+
+func TestLoadConfigDocumentMaxSize(t *testing.T) {
+	defer os.Unsetenv("DOCUMENT_MAX_SIZE_MB")
+	os.Setenv("DOCUMENT_MAX_SIZE_MB", "50")
+
+	cfg := Load()
+
+	if cfg.DocumentMaxSize != 20 {
+		t.Errorf("Expected the Bot API download limit of 20 MB, got %d", cfg.DocumentMaxSize)
+	}
+}
+
+func TestLoadConfigOpenAIProvider(t *testing.T) {
+	defer os.Unsetenv("EMBEDDING_PROVIDER")
+	os.Unsetenv("EMBEDDING_API_URL")
+	os.Setenv("EMBEDDING_PROVIDER", "openai")
+
+	cfg := Load()
+
+	if cfg.EmbeddingAPIURL != "http://localhost:8080" {
+		t.Errorf("Expected llama.cpp server default URL, got '%s'", cfg.EmbeddingAPIURL)
+	}
+}
+
+func TestLoadConfigHashingProvider(t *testing.T) {
+	defer os.Unsetenv("EMBEDDING_PROVIDER")
+	os.Unsetenv("EMBEDDING_MODEL")
+	os.Setenv("EMBEDDING_PROVIDER", "hashing")
+
+	cfg := Load()
+
+	if cfg.EmbeddingModel != "hashing" {
+		t.Errorf("Expected hashing model by default, got '%s'", cfg.EmbeddingModel)
+	}
 }
 
 func TestGetEnv(t *testing.T) {
@@ -83,3 +157,39 @@ func TestGetEnv(t *testing.T) {
 	// Clean up
 	os.Unsetenv("TEST_VAR")
 }
+
+func TestGetEnvInt(t *testing.T) {
+	defer os.Unsetenv("TEST_INT_VAR")
+
+	os.Setenv("TEST_INT_VAR", "30")
+	if result := getEnvInt("TEST_INT_VAR", 0); result != 30 {
+		t.Errorf("Expected 30, got %d", result)
+	}
+
+	// Invalid and negative values fall back to the default
+	for _, value := range []string{"thirty", "-5"} {
+		os.Setenv("TEST_INT_VAR", value)
+		if result := getEnvInt("TEST_INT_VAR", 7); result != 7 {
+			t.Errorf("Expected default 7 for %q, got %d", value, result)
+		}
+	}
+
+	os.Unsetenv("TEST_INT_VAR")
+	if result := getEnvInt("TEST_INT_VAR", 7); result != 7 {
+		t.Errorf("Expected default 7, got %d", result)
+	}
+}
+
+func TestGetEnvBool(t *testing.T) {
+	defer os.Unsetenv("TEST_BOOL_VAR")
+
+	os.Setenv("TEST_BOOL_VAR", "true")
+	if !getEnvBool("TEST_BOOL_VAR", false) {
+		t.Errorf("Expected true")
+	}
+
+	os.Setenv("TEST_BOOL_VAR", "maybe")
+	if getEnvBool("TEST_BOOL_VAR", false) {
+		t.Errorf("Expected default false for an invalid value")
+	}
+}
@@ -0,0 +1,130 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// chunkColumns lists the message_chunks columns read by scanChunks
+const chunkColumns = `message_chunks.id, message_chunks.message_id, message_chunks.chat_id, message_chunks.position,
+	message_chunks.source, message_chunks.page, message_chunks.text, message_chunks.embedding, message_chunks.embedding_dim,
+	message_chunks.embedding_model`
+
+// GetChunksWithEmbeddings returns the chunks of a chat's messages that have
+// a vector from the given model
+func (db *DB) GetChunksWithEmbeddings(ctx context.Context, chatID int64, model string) ([]MessageChunk, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT `+chunkColumns+`
+	FROM message_chunks
+	WHERE chat_id = ? AND embedding_dim > 0 AND embedding_model = ?
+	`, chatID, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message chunks: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChunks(rows)
+}
+
+// FilterChunksWithEmbeddings returns the chunks with a vector from the
+// given model of the chat's messages that match the filter
+func (db *DB) FilterChunksWithEmbeddings(ctx context.Context, chatID int64, model string, filter MessageFilter) ([]MessageChunk, error) {
+	where, args := filter.where("messages.")
+	query := `
+	SELECT ` + chunkColumns + `
+	FROM message_chunks
+	JOIN messages ON messages.id = message_chunks.message_id
+	WHERE message_chunks.chat_id = ? AND message_chunks.embedding_dim > 0 AND message_chunks.embedding_model = ? AND ` + where + `
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, append([]interface{}{chatID, model}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message chunks: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChunks(rows)
+}
+
+// GetChunksByIDs returns chunks by ID, skipping those that no longer exist
+func (db *DB) GetChunksByIDs(ctx context.Context, ids []int64) ([]MessageChunk, error) {
+	if len(ids) == 0 {
+		return []MessageChunk{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT `+chunkColumns+`
+	FROM message_chunks
+	WHERE id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message chunks: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChunks(rows)
+}
+
+// saveChunks replaces a message's chunks from model inside a transaction,
+// setting the IDs of the stored chunks
+func saveChunks(ctx context.Context, tx *sql.Tx, messageID, chatID int64, model string, chunks []MessageChunk) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_chunks WHERE message_id = ? AND embedding_model = ?`, messageID, model); err != nil {
+		return fmt.Errorf("failed to delete message chunks: %w", err)
+	}
+
+	for i := range chunks {
+		if chunks[i].Source == "" {
+			chunks[i].Source = ChunkFromText
+		}
+		result, err := tx.ExecContext(ctx, `
+		INSERT INTO message_chunks (message_id, chat_id, position, source, page, text, embedding, embedding_dim, embedding_model)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, messageID, chatID, i, chunks[i].Source, chunks[i].Page, chunks[i].Text,
+			encodeEmbedding(chunks[i].Embedding), len(chunks[i].Embedding), model)
+		if err != nil {
+			return fmt.Errorf("failed to save message chunk: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("failed to get chunk ID: %w", err)
+		}
+		chunks[i].ID, chunks[i].MessageID, chunks[i].ChatID = id, messageID, chatID
+		chunks[i].Position, chunks[i].EmbeddingModel = i, model
+	}
+	return nil
+}
+
+// scanChunks reads rows selected with chunkColumns
+func scanChunks(rows *sql.Rows) ([]MessageChunk, error) {
+	var chunks []MessageChunk
+	for rows.Next() {
+		var c MessageChunk
+		var embeddingBlob []byte
+		var embeddingDim int
+		if err := rows.Scan(&c.ID, &c.MessageID, &c.ChatID, &c.Position, &c.Source, &c.Page, &c.Text, &embeddingBlob, &embeddingDim, &c.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("failed to scan message chunk: %w", err)
+		}
+
+		if embeddingDim > 0 {
+			embedding, err := decodeEmbedding(embeddingBlob, embeddingDim)
+			if err != nil {
+				log.Printf("Failed to decode embedding for chunk %d: %v", c.ID, err)
+				continue
+			}
+			c.Embedding = embedding
+		}
+
+		chunks = append(chunks, c)
+	}
+	return chunks, rows.Err()
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMessageChunks(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	id, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, UserID: 1, Username: "alice", Text: "a long runbook", Timestamp: now}, now)
+	other, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, UserID: 2, Username: "bob", Text: "short", Timestamp: now}, now)
+	jobs, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+
+	chunks := []MessageChunk{{Text: "first part", Embedding: []float64{1, 0}}, {Text: "second part", Embedding: []float64{0, 1}}}
+	if ok, err := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{0.7, 0.7}, chunks, "test-model", now); err != nil || !ok {
+		t.Fatalf("CompleteEmbeddingJob failed: %v, %v", ok, err)
+	}
+	db.CompleteEmbeddingJob(ctx, jobs[1], []float64{1, 0}, nil, "test-model", now)
+	if chunks[0].ID == 0 || chunks[1].ID == 0 || chunks[1].Position != 1 || chunks[1].MessageID != id {
+		t.Errorf("Expected the stored chunks to be filled in, got %+v", chunks)
+	}
+
+	stored, err := db.GetChunksWithEmbeddings(ctx, 1, "test-model")
+	if err != nil || len(stored) != 2 {
+		t.Fatalf("Expected 2 chunks, got %d (%v)", len(stored), err)
+	}
+	if filtered, _ := db.FilterChunksWithEmbeddings(ctx, 1, "test-model", MessageFilter{Usernames: []string{"bob"}}); len(filtered) != 0 {
+		t.Errorf("Expected the filter to apply to the chunks' message, got %d chunks", len(filtered))
+	}
+	if byID, _ := db.GetChunksByIDs(ctx, []int64{chunks[1].ID}); len(byID) != 1 || byID[0].Text != "second part" || len(byID[0].Embedding) != 2 {
+		t.Errorf("Expected the second chunk by ID, got %+v", byID)
+	}
+
+	// Embedding the message again replaces its chunks
+	db.QueueEmbeddings(ctx, []int64{id}, now)
+	jobs, _ = db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0}, []MessageChunk{{Text: "only part", Embedding: []float64{1, 0}}}, "test-model", now)
+	if stored, _ := db.GetChunksWithEmbeddings(ctx, 1, "test-model"); len(stored) != 1 || stored[0].Text != "only part" {
+		t.Errorf("Expected the chunks to be replaced, got %+v", stored)
+	}
+
+	// Chunks belong to the text they were cut from
+	db.UpdateMessageText(ctx, id, "an edited runbook", nil, "", now)
+	if stored, _ := db.GetChunksWithEmbeddings(ctx, 1, "test-model"); len(stored) != 0 {
+		t.Errorf("Expected an edit to drop the chunks, got %d", len(stored))
+	}
+
+	jobs, _ = db.ClaimEmbeddingJobs(ctx, 10, now.Add(time.Minute), time.Minute)
+	if ok, _ := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0}, []MessageChunk{{Text: "edited part", Embedding: []float64{1, 0}}}, "test-model", now); !ok {
+		t.Fatal("Expected the edited message to be embedded")
+	}
+	if err := db.DeleteMessagesByIDs(ctx, []int64{id, other}); err != nil {
+		t.Fatalf("DeleteMessagesByIDs failed: %v", err)
+	}
+	if stored, _ := db.GetChunksWithEmbeddings(ctx, 1, "test-model"); len(stored) != 0 {
+		t.Errorf("Expected deleting the message to delete its chunks, got %d", len(stored))
+	}
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// GetMessagesBefore returns up to limit messages of a chat's thread sent
+// before the message with the given timestamp and row ID, newest first
+func (db *DB) GetMessagesBefore(ctx context.Context, chatID int64, threadID int, timestamp time.Time, id int64, limit int) ([]Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND thread_id = ? AND (timestamp < ? OR (timestamp = ? AND id < ?))
+	ORDER BY timestamp DESC, id DESC
+	LIMIT ?
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, chatID, threadID, timestamp.UTC(), timestamp.UTC(), id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query earlier messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessagesAfter returns up to limit messages of a chat's thread sent
+// after the message with the given timestamp and row ID, oldest first
+func (db *DB) GetMessagesAfter(ctx context.Context, chatID int64, threadID int, timestamp time.Time, id int64, limit int) ([]Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND thread_id = ? AND (timestamp > ? OR (timestamp = ? AND id > ?))
+	ORDER BY timestamp, id
+	LIMIT ?
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, chatID, threadID, timestamp.UTC(), timestamp.UTC(), id, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query later messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
@@ -0,0 +1,46 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGetMessagesAround(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	var ids []int64
+	for i, text := range []string{"one", "two", "three", "four", "five"} {
+		// "three" and "four" share a timestamp
+		at := start.Add(time.Duration(min(i, 2)) * time.Minute)
+		if i == 4 {
+			at = start.Add(10 * time.Minute)
+		}
+		id, err := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: i + 1, UserID: 1, Text: text, Timestamp: at})
+		if err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	// Other threads and chats are left out
+	db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 9, ThreadID: 4, UserID: 1, Text: "topic", Timestamp: start.Add(time.Minute)})
+	db.SaveMessage(ctx, Message{ChatID: 2, TelegramMessageID: 1, UserID: 1, Text: "other chat", Timestamp: start.Add(time.Minute)})
+
+	before, err := db.GetMessagesBefore(ctx, 1, 0, start.Add(2*time.Minute), ids[3], 2)
+	if err != nil {
+		t.Fatalf("GetMessagesBefore failed: %v", err)
+	}
+	if len(before) != 2 || before[0].Text != "three" || before[1].Text != "two" {
+		t.Errorf("Expected three and two, newest first, got %+v", before)
+	}
+
+	after, err := db.GetMessagesAfter(ctx, 1, 0, start.Add(time.Minute), ids[1], 5)
+	if err != nil {
+		t.Fatalf("GetMessagesAfter failed: %v", err)
+	}
+	if len(after) != 3 || after[0].Text != "three" || after[2].Text != "five" {
+		t.Errorf("Expected three, four and five, oldest first, got %+v", after)
+	}
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// GetPrivateResults reports whether a chat's search results are sent to the
+// requester's private chat instead of the chat itself
+func (db *DB) GetPrivateResults(ctx context.Context, chatID int64) (bool, error) {
+	var enabled bool
+	err := db.conn.QueryRowContext(ctx, `SELECT private_results FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read private results setting: %w", err)
+	}
+	return enabled, nil
+}
+
+// SetPrivateResults chooses whether a chat's search results are sent to the
+// requester's private chat
+func (db *DB) SetPrivateResults(ctx context.Context, chatID int64, enabled bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, private_results) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET private_results = excluded.private_results
+	`, chatID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to save private results setting: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPrivateResults(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if enabled, err := db.GetPrivateResults(ctx, -1); err != nil || enabled {
+		t.Errorf("Expected results in the chat by default, got %v (%v)", enabled, err)
+	}
+
+	if err := db.SetCrossChatSearch(ctx, -1, false); err != nil {
+		t.Fatalf("SetCrossChatSearch failed: %v", err)
+	}
+	if err := db.SetPrivateResults(ctx, -1, true); err != nil {
+		t.Fatalf("SetPrivateResults failed: %v", err)
+	}
+	if enabled, _ := db.GetPrivateResults(ctx, -1); !enabled {
+		t.Error("Expected results to be sent privately")
+	}
+	if enabled, _ := db.GetCrossChatSearch(ctx, -1); enabled {
+		t.Error("Expected other settings of the chat to stay")
+	}
+	if enabled, _ := db.GetPrivateResults(ctx, -2); enabled {
+		t.Error("Expected other chats to keep their results in the chat")
+	}
+
+	if err := db.SetPrivateResults(ctx, -1, false); err != nil {
+		t.Fatalf("SetPrivateResults failed: %v", err)
+	}
+	if enabled, _ := db.GetPrivateResults(ctx, -1); enabled {
+		t.Error("Expected results in the chat again")
+	}
+}
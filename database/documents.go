@@ -0,0 +1,86 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// SaveDocumentPages stores the text of the file attached to a message in
+// place of any stored before, and queues the message to be embedded again
+// along with it
+func (db *DB) SaveDocumentPages(ctx context.Context, messageID int64, pages []DocumentPage, now time.Time) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_documents WHERE message_id = ?`, messageID); err != nil {
+		return fmt.Errorf("failed to delete document text: %w", err)
+	}
+	for _, page := range pages {
+		_, err := tx.ExecContext(ctx, `INSERT INTO message_documents (message_id, page, text) VALUES (?, ?, ?)`, messageID, page.Page, page.Text)
+		if err != nil {
+			return fmt.Errorf("failed to save document page %d: %w", page.Page, err)
+		}
+	}
+
+	if err := queueEmbedding(ctx, tx, messageID, now); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDocumentPages returns the text of the file attached to a message,
+// in page order
+func (db *DB) GetDocumentPages(ctx context.Context, messageID int64) ([]DocumentPage, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT page, text FROM message_documents WHERE message_id = ? ORDER BY page`, messageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document text: %w", err)
+	}
+	defer rows.Close()
+
+	var pages []DocumentPage
+	for rows.Next() {
+		var page DocumentPage
+		if err := rows.Scan(&page.Page, &page.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan document page: %w", err)
+		}
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+// loadDocuments fills in the file text of claimed jobs inside the claiming
+// transaction. placeholders binds args, the jobs' message IDs.
+func loadDocuments(ctx context.Context, tx *sql.Tx, jobs []EmbeddingJob, placeholders string, args []interface{}) error {
+	rows, err := tx.QueryContext(ctx, `
+	SELECT message_id, page, text FROM message_documents
+	WHERE message_id IN (`+placeholders+`)
+	ORDER BY message_id, page
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query document text: %w", err)
+	}
+	defer rows.Close()
+
+	pages := make(map[int64][]DocumentPage)
+	for rows.Next() {
+		var messageID int64
+		var page DocumentPage
+		if err := rows.Scan(&messageID, &page.Page, &page.Text); err != nil {
+			return fmt.Errorf("failed to scan document page: %w", err)
+		}
+		pages[messageID] = append(pages[messageID], page)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to query document text: %w", err)
+	}
+
+	for i := range jobs {
+		jobs[i].Document = pages[jobs[i].MessageID]
+	}
+	return nil
+}
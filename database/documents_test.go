@@ -0,0 +1,52 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDocumentPages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	id, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, UserID: 1, Username: "alice", Text: "runbook.pdf", ContentType: ContentDocument, Timestamp: now}, now)
+	stale, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+
+	pages := []DocumentPage{{Page: 1, Text: "Welcome"}, {Page: 3, Text: "Rotate the certificates"}}
+	if err := db.SaveDocumentPages(ctx, id, pages, now); err != nil {
+		t.Fatalf("SaveDocumentPages failed: %v", err)
+	}
+	if stored, err := db.GetDocumentPages(ctx, id); err != nil || len(stored) != 2 || stored[1] != pages[1] {
+		t.Fatalf("Expected the saved pages, got %+v (%v)", stored, err)
+	}
+
+	// A job claimed before the text was saved would drop the document chunks
+	if ok, _ := db.CompleteEmbeddingJob(ctx, stale[0], []float64{1, 0}, nil, "test-model", now); ok {
+		t.Error("Expected a job without the document text to be discarded")
+	}
+
+	jobs, _ := db.ClaimEmbeddingJobs(ctx, 10, now.Add(time.Minute), time.Minute)
+	if len(jobs) != 1 || len(jobs[0].Document) != 2 || jobs[0].Document[1].Page != 3 {
+		t.Fatalf("Expected the claimed job to carry the pages, got %+v", jobs)
+	}
+	chunks := []MessageChunk{
+		{Text: "runbook.pdf", Embedding: []float64{1, 0}},
+		{Source: ChunkFromDocument, Page: 3, Text: "Rotate the certificates", Embedding: []float64{0, 1}},
+	}
+	if ok, err := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0}, chunks, "test-model", now); err != nil || !ok {
+		t.Fatalf("CompleteEmbeddingJob failed: %v, %v", ok, err)
+	}
+	stored, _ := db.GetChunksByIDs(ctx, []int64{chunks[0].ID, chunks[1].ID})
+	if len(stored) != 2 || stored[0].Source != ChunkFromText || stored[1].Source != ChunkFromDocument || stored[1].Page != 3 {
+		t.Errorf("Expected the chunk sources and pages, got %+v", stored)
+	}
+
+	if err := db.DeleteMessagesByIDs(ctx, []int64{id}); err != nil {
+		t.Fatalf("DeleteMessagesByIDs failed: %v", err)
+	}
+	if stored, _ := db.GetDocumentPages(ctx, id); len(stored) != 0 {
+		t.Errorf("Expected deleting the message to delete its document text, got %+v", stored)
+	}
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// GetMessageByTelegramID returns the stored message for a Telegram message,
+// or nil if it was never stored
+func (db *DB) GetMessageByTelegramID(ctx context.Context, chatID int64, telegramMessageID int) (*Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND telegram_message_id = ?
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, chatID, telegramMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message: %w", err)
+	}
+	defer rows.Close()
+
+	messages, err := scanMessages(rows)
+	if err != nil || len(messages) == 0 {
+		return nil, err
+	}
+	return &messages[0], nil
+}
+
+// UpdateMessageText replaces the text and embedding of a message, moving
+// the previous version into the edit history. Without an embedding the
+// message is queued to be embedded again.
+func (db *DB) UpdateMessageText(ctx context.Context, id int64, text string, embedding []float64, model string, editedAt time.Time) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO message_edits (message_id, chat_id, text, embedding, embedding_dim, embedding_model, edited_at)
+	SELECT id, chat_id, text, embedding, embedding_dim, embedding_model, ?
+	FROM messages
+	WHERE id = ?
+	`, editedAt, id)
+	if err != nil {
+		return fmt.Errorf("failed to save edit history: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `UPDATE messages SET text = ?, embedding = ?, embedding_dim = ?, embedding_model = ? WHERE id = ?`,
+		text, encodeEmbedding(embedding), len(embedding), model, id)
+	if err != nil {
+		return fmt.Errorf("failed to update message: %w", err)
+	}
+
+	if updated, _ := result.RowsAffected(); updated == 0 {
+		return sql.ErrNoRows
+	}
+
+	// A vector staged by a model migration and chunks belong to the old text
+	if _, err := tx.ExecContext(ctx, `DELETE FROM staged_embeddings WHERE message_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to drop staged embedding: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM message_chunks WHERE message_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to drop message chunks: %w", err)
+	}
+
+	// Windows containing the message are built again with the new text
+	if err := invalidateConversations(ctx, tx, "?", []interface{}{id}); err != nil {
+		return err
+	}
+
+	if len(embedding) == 0 {
+		if err := queueEmbedding(ctx, tx, id, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FilterEditsWithEmbeddings returns previous versions of the chat's messages
+// that have an embedding from the given model, restricted by a filter on the
+// current message
+func (db *DB) FilterEditsWithEmbeddings(ctx context.Context, chatID int64, model string, filter MessageFilter) ([]MessageEdit, error) {
+	where, args := filter.where("messages.")
+	query := `
+	SELECT message_edits.id, message_edits.message_id, message_edits.chat_id, message_edits.text,
+		message_edits.embedding, message_edits.embedding_dim, message_edits.embedding_model, message_edits.edited_at
+	FROM message_edits
+	JOIN messages ON messages.id = message_edits.message_id
+	WHERE message_edits.chat_id = ? AND message_edits.embedding_dim > 0 AND message_edits.embedding_model = ? AND ` + where + `
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, append([]interface{}{chatID, model}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query message edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []MessageEdit
+	for rows.Next() {
+		var edit MessageEdit
+		var embeddingBlob []byte
+		var embeddingDim int
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.ChatID, &edit.Text, &embeddingBlob, &embeddingDim, &edit.EmbeddingModel, &edit.EditedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message edit: %w", err)
+		}
+
+		embedding, err := decodeEmbedding(embeddingBlob, embeddingDim)
+		if err != nil {
+			log.Printf("Failed to decode embedding for edit %d: %v", edit.ID, err)
+			continue
+		}
+		edit.Embedding = embedding
+
+		edits = append(edits, edit)
+	}
+
+	return edits, rows.Err()
+}
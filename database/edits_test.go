@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestUpdateMessageTextKeepsHistory(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	id, err := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 7, UserID: 1, Text: "meet on Monday", Timestamp: now, Embedding: []float64{1, 0}})
+	if err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+
+	if err := db.UpdateMessageText(ctx, id, "meet on Tuesday", []float64{0, 1}, "", now.Add(time.Minute)); err != nil {
+		t.Fatalf("UpdateMessageText failed: %v", err)
+	}
+
+	msg, err := db.GetMessageByTelegramID(ctx, 1, 7)
+	if err != nil || msg == nil {
+		t.Fatalf("GetMessageByTelegramID failed: %v", err)
+	}
+	if msg.ID != id || msg.Text != "meet on Tuesday" || msg.Embedding[1] != 1 {
+		t.Errorf("Expected updated message, got %+v", msg)
+	}
+
+	edits, err := db.FilterEditsWithEmbeddings(ctx, 1, "", MessageFilter{})
+	if err != nil {
+		t.Fatalf("FilterEditsWithEmbeddings failed: %v", err)
+	}
+	if len(edits) != 1 || edits[0].MessageID != id || edits[0].Text != "meet on Monday" || edits[0].Embedding[0] != 1 {
+		t.Errorf("Expected previous version in history, got %+v", edits)
+	}
+
+	if missing, err := db.GetMessageByTelegramID(ctx, 1, 8); missing != nil || err != nil {
+		t.Errorf("Expected no message, got %+v, %v", missing, err)
+	}
+
+	if err := db.UpdateMessageText(ctx, 999, "nothing", nil, "", now); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("Expected sql.ErrNoRows for unknown message, got %v", err)
+	}
+}
+
+func TestTelegramMessageIDIsUnique(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	msg := Message{ChatID: 1, TelegramMessageID: 7, UserID: 1, Text: "hello", Timestamp: time.Now()}
+	if _, err := db.SaveMessage(ctx, msg); err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if _, err := db.SaveMessage(ctx, msg); err == nil {
+		t.Error("Expected duplicate Telegram message to be rejected")
+	}
+
+	// Rows without a Telegram ID predate tracking and may repeat
+	legacy := Message{ChatID: 1, UserID: 1, Text: "legacy", Timestamp: time.Now()}
+	db.SaveMessage(ctx, legacy)
+	if _, err := db.SaveMessage(ctx, legacy); err != nil {
+		t.Errorf("Expected legacy rows to be accepted, got %v", err)
+	}
+}
@@ -0,0 +1,235 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"semantic-search-bot/embedding"
+	"strings"
+)
+
+// embeddedTextsQuery selects every text embedded for a set of messages:
+// their text, chunks, earlier versions and the conversation windows holding
+// them. Each %[1]s is replaced by the same placeholders.
+const embeddedTextsQuery = `
+	SELECT text FROM messages WHERE id IN (%[1]s)
+	UNION SELECT text FROM message_chunks WHERE message_id IN (%[1]s)
+	UNION SELECT text FROM message_edits WHERE message_id IN (%[1]s)
+	UNION SELECT w.text FROM conversation_windows w
+		JOIN conversation_window_messages l ON l.window_id = w.id
+		WHERE l.message_id IN (%[1]s)
+	`
+
+// remainingTextsQuery selects which of a set of texts are still held by a
+// message, chunk, earlier version or conversation window
+const remainingTextsQuery = `
+	SELECT text FROM messages WHERE text IN (%[1]s)
+	UNION SELECT text FROM message_chunks WHERE text IN (%[1]s)
+	UNION SELECT text FROM message_edits WHERE text IN (%[1]s)
+	UNION SELECT text FROM conversation_windows WHERE text IN (%[1]s)
+	`
+
+// LoadCachedEmbeddings returns the cached vectors of model for the given
+// text hashes; hashes without an entry are left out. Entries that can't be
+// decoded are deleted so the texts are embedded again.
+func (db *DB) LoadCachedEmbeddings(ctx context.Context, model string, keys []string) (map[string][]float64, error) {
+	embeddings := make(map[string][]float64, len(keys))
+	var corrupt []interface{}
+	for start := 0; start < len(keys); start += deleteBatchSize {
+		batch := keys[start:min(start+deleteBatchSize, len(keys))]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := []interface{}{model}
+		for _, key := range batch {
+			args = append(args, key)
+		}
+
+		rows, err := db.conn.QueryContext(ctx, `
+		SELECT text_hash, embedding, embedding_dim FROM embedding_cache
+		WHERE model = ? AND text_hash IN (`+placeholders+`)
+		`, args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query embedding cache: %w", err)
+		}
+
+		for rows.Next() {
+			var key string
+			var blob []byte
+			var dim int
+			if err := rows.Scan(&key, &blob, &dim); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan cached embedding: %w", err)
+			}
+
+			embedding, err := decodeEmbedding(blob, dim)
+			if err != nil {
+				log.Printf("Deleting corrupt cached embedding %s: %v", key, err)
+				corrupt = append(corrupt, key)
+				continue
+			}
+			embeddings[key] = embedding
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to query embedding cache: %w", err)
+		}
+	}
+
+	if len(corrupt) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(corrupt)), ",")
+		_, err := db.conn.ExecContext(ctx, `DELETE FROM embedding_cache WHERE model = ? AND text_hash IN (`+placeholders+`)`,
+			append([]interface{}{model}, corrupt...)...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to delete corrupt cached embeddings: %w", err)
+		}
+	}
+
+	return embeddings, nil
+}
+
+// SaveCachedEmbeddings stores vectors of model by text hash
+func (db *DB) SaveCachedEmbeddings(ctx context.Context, model string, entries map[string][]float64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.PrepareContext(ctx, `
+	INSERT INTO embedding_cache (model, text_hash, embedding, embedding_dim) VALUES (?, ?, ?, ?)
+	ON CONFLICT(model, text_hash) DO UPDATE SET embedding = excluded.embedding, embedding_dim = excluded.embedding_dim
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer insert.Close()
+
+	for key, embedding := range entries {
+		if _, err := insert.ExecContext(ctx, model, key, encodeEmbedding(embedding), len(embedding)); err != nil {
+			return fmt.Errorf("failed to cache embedding: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PruneEmbeddingCache keeps the newest keep cached vectors and deletes the
+// rest, returning the number of deleted entries
+func (db *DB) PruneEmbeddingCache(ctx context.Context, keep int) (int, error) {
+	result, err := db.conn.ExecContext(ctx, `
+	DELETE FROM embedding_cache WHERE rowid NOT IN (
+		SELECT rowid FROM embedding_cache ORDER BY created_at DESC, rowid DESC LIMIT ?
+	)
+	`, keep)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune embedding cache: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	return int(deleted), nil
+}
+
+// OnEmbeddingCacheDeleted registers fn to be told the keys of cached
+// embeddings deleted along with messages, so copies held in memory can be
+// dropped too. It must be called before the database is used.
+func (db *DB) OnEmbeddingCacheDeleted(fn func(keys []string)) {
+	db.cacheDeleted = fn
+}
+
+func (db *DB) forgetCachedEmbeddings(keys []string) {
+	if len(keys) > 0 && db.cacheDeleted != nil {
+		db.cacheDeleted(keys)
+	}
+}
+
+// collectEmbeddedTexts adds the texts embedded for the messages bound by
+// placeholders and args to texts
+func collectEmbeddedTexts(ctx context.Context, tx *sql.Tx, placeholders string, args []interface{}, texts map[string]bool) error {
+	found, err := queryTexts(ctx, tx, fmt.Sprintf(embeddedTextsQuery, placeholders), repeatArgs(args, 4))
+	if err != nil {
+		return fmt.Errorf("failed to query embedded texts: %w", err)
+	}
+	for _, text := range found {
+		if text != "" {
+			texts[text] = true
+		}
+	}
+	return nil
+}
+
+// deleteCachedEmbeddings deletes the cached vectors, of every model, of the
+// texts no remaining message still holds and returns their keys. Deleted
+// messages would otherwise live on as vectors of their text.
+func deleteCachedEmbeddings(ctx context.Context, tx *sql.Tx, texts map[string]bool) ([]string, error) {
+	candidates := make([]string, 0, len(texts))
+	for text := range texts {
+		candidates = append(candidates, text)
+	}
+
+	var keys []string
+	for start := 0; start < len(candidates); start += deleteBatchSize {
+		batch := candidates[start:min(start+deleteBatchSize, len(candidates))]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]interface{}, len(batch))
+		for i, text := range batch {
+			args[i] = text
+		}
+
+		remaining, err := queryTexts(ctx, tx, fmt.Sprintf(remainingTextsQuery, placeholders), repeatArgs(args, 4))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query remaining texts: %w", err)
+		}
+		kept := make(map[string]bool, len(remaining))
+		for _, text := range remaining {
+			kept[embedding.CacheKey(text)] = true
+		}
+
+		var batchKeys []interface{}
+		for _, text := range batch {
+			if key := embedding.CacheKey(text); !kept[key] {
+				kept[key] = true // texts differing only in spacing share a key
+				batchKeys = append(batchKeys, key)
+				keys = append(keys, key)
+			}
+		}
+		if len(batchKeys) == 0 {
+			continue
+		}
+
+		keyPlaceholders := strings.TrimSuffix(strings.Repeat("?,", len(batchKeys)), ",")
+		if _, err := tx.ExecContext(ctx, `DELETE FROM embedding_cache WHERE text_hash IN (`+keyPlaceholders+`)`, batchKeys...); err != nil {
+			return nil, fmt.Errorf("failed to delete cached embeddings: %w", err)
+		}
+	}
+	return keys, nil
+}
+
+// queryTexts returns the single text column of a query
+func queryTexts(ctx context.Context, tx *sql.Tx, query string, args []interface{}) ([]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var texts []string
+	for rows.Next() {
+		var text string
+		if err := rows.Scan(&text); err != nil {
+			return nil, err
+		}
+		texts = append(texts, text)
+	}
+	return texts, rows.Err()
+}
+
+// repeatArgs binds the same arguments to a query using them n times
+func repeatArgs(args []interface{}, n int) []interface{} {
+	repeated := make([]interface{}, 0, len(args)*n)
+	for i := 0; i < n; i++ {
+		repeated = append(repeated, args...)
+	}
+	return repeated
+}
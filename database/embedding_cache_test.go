@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEmbeddingCache(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if err := db.SaveCachedEmbeddings(ctx, "model-a", map[string][]float64{"k1": {1, 0}, "k2": {0, 1}}); err != nil {
+		t.Fatalf("SaveCachedEmbeddings failed: %v", err)
+	}
+	if err := db.SaveCachedEmbeddings(ctx, "model-b", map[string][]float64{"k1": {0.5, 0.5}}); err != nil {
+		t.Fatalf("SaveCachedEmbeddings failed: %v", err)
+	}
+
+	found, err := db.LoadCachedEmbeddings(ctx, "model-a", []string{"k1", "k3"})
+	if err != nil {
+		t.Fatalf("LoadCachedEmbeddings failed: %v", err)
+	}
+	if len(found) != 1 || found["k1"][0] != 1 {
+		t.Errorf("Expected only k1 of model-a, got %v", found)
+	}
+
+	// Corrupt entries are deleted instead of being skipped on every lookup
+	if _, err := db.conn.ExecContext(ctx, `INSERT INTO embedding_cache (model, text_hash, embedding, embedding_dim) VALUES ('model-a', 'bad', x'0102', 2)`); err != nil {
+		t.Fatalf("Failed to insert corrupt entry: %v", err)
+	}
+	found, err = db.LoadCachedEmbeddings(ctx, "model-a", []string{"k1", "bad"})
+	if err != nil {
+		t.Fatalf("LoadCachedEmbeddings failed: %v", err)
+	}
+	if _, ok := found["bad"]; ok || len(found) != 1 {
+		t.Errorf("Expected the corrupt entry to be left out, got %v", found)
+	}
+	var corrupt int
+	db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_cache WHERE text_hash = 'bad'`).Scan(&corrupt)
+	if corrupt != 0 {
+		t.Error("Expected the corrupt entry to be deleted")
+	}
+
+	pruned, err := db.PruneEmbeddingCache(ctx, 1)
+	if err != nil {
+		t.Fatalf("PruneEmbeddingCache failed: %v", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Expected 2 pruned entries, got %d", pruned)
+	}
+}
@@ -0,0 +1,232 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrMigrationIncomplete is returned by SwitchEmbeddingModel while messages
+// whose vectors serve searches have no vector staged for the new model, e.g.
+// because their jobs gave up
+var ErrMigrationIncomplete = errors.New("messages are missing a staged embedding")
+
+// unstagedEmbeddingsQuery selects the messages of a chat that have a vector
+// serving searches but none staged for a model. It binds the chat ID, then
+// the model.
+const unstagedEmbeddingsQuery = `
+	SELECT id FROM messages
+	WHERE chat_id = ? AND embedding_dim > 0
+	AND id NOT IN (SELECT message_id FROM staged_embeddings WHERE model = ?)`
+
+// AdoptEmbeddingModel labels vectors stored before models were tracked
+// with model, and pins every chat that has vectors but no active model to
+// the model most of its vectors come from. It is meant to be called at
+// startup with the configured model, before the search indexes are built.
+func (db *DB) AdoptEmbeddingModel(ctx context.Context, model string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE messages SET embedding_model = ? WHERE embedding_dim > 0 AND embedding_model = '';
+	UPDATE message_edits SET embedding_model = ? WHERE embedding_dim > 0 AND embedding_model = '';
+	`, model, model)
+	if err != nil {
+		return fmt.Errorf("failed to label embeddings: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, embedding_model)
+	SELECT chat_id, embedding_model FROM (
+		SELECT chat_id, embedding_model, ROW_NUMBER() OVER (PARTITION BY chat_id ORDER BY COUNT(*) DESC) AS position
+		FROM messages
+		WHERE embedding_dim > 0
+		GROUP BY chat_id, embedding_model
+	) WHERE position = 1
+	ON CONFLICT(chat_id) DO UPDATE SET embedding_model = COALESCE(embedding_model, excluded.embedding_model)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to pin chat embedding models: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetEmbeddingModelState returns the embedding models of a chat
+func (db *DB) GetEmbeddingModelState(ctx context.Context, chatID int64) (EmbeddingModelState, error) {
+	state := EmbeddingModelState{ChatID: chatID}
+	var active, migrating sql.NullString
+	err := db.conn.QueryRowContext(ctx, `SELECT embedding_model, migration_model FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&active, &migrating)
+	if err == sql.ErrNoRows {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read embedding model: %w", err)
+	}
+
+	state.Active, state.Migrating = active.String, migrating.String
+	return state, nil
+}
+
+// GetEmbeddingModelStates returns the embedding models of every chat that
+// has an active model or a running migration
+func (db *DB) GetEmbeddingModelStates(ctx context.Context) ([]EmbeddingModelState, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT chat_id, COALESCE(embedding_model, ''), COALESCE(migration_model, '')
+	FROM chat_settings
+	WHERE embedding_model IS NOT NULL OR migration_model IS NOT NULL
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding models: %w", err)
+	}
+	defer rows.Close()
+
+	var states []EmbeddingModelState
+	for rows.Next() {
+		var state EmbeddingModelState
+		if err := rows.Scan(&state.ChatID, &state.Active, &state.Migrating); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding model: %w", err)
+		}
+		states = append(states, state)
+	}
+
+	return states, rows.Err()
+}
+
+// StartEmbeddingMigration starts re-embedding a chat with model. Every
+// message is queued; the new vectors are staged while the current ones keep
+// serving searches until SwitchEmbeddingModel. Returns the number of queued
+// messages.
+func (db *DB) StartEmbeddingMigration(ctx context.Context, chatID int64, model string, now time.Time) (int, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, migration_model) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET migration_model = excluded.migration_model
+	`, chatID, model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save migration model: %w", err)
+	}
+
+	// Vectors staged for another model are of no use anymore
+	_, err = tx.ExecContext(ctx, `
+	DELETE FROM staged_embeddings
+	WHERE model != ? AND message_id IN (SELECT id FROM messages WHERE chat_id = ?)
+	`, model, chatID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to drop staged embeddings: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+	INSERT INTO pending_embeddings (message_id, next_attempt_at)
+	SELECT id, ? FROM messages
+	WHERE chat_id = ? AND id NOT IN (SELECT message_id FROM staged_embeddings)
+	ON CONFLICT(message_id) DO UPDATE SET attempts = 0, next_attempt_at = excluded.next_attempt_at, last_error = ''
+	`, now.UTC(), chatID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue migration: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit migration: %w", err)
+	}
+
+	queued, _ := result.RowsAffected()
+	return int(queued), nil
+}
+
+// CancelEmbeddingMigration stops a chat's migration and drops its staged
+// vectors and chunks
+func (db *DB) CancelEmbeddingMigration(ctx context.Context, chatID int64) error {
+	_, err := db.conn.ExecContext(ctx, `
+	UPDATE chat_settings SET migration_model = NULL WHERE chat_id = ?;
+	DELETE FROM staged_embeddings WHERE message_id IN (SELECT id FROM messages WHERE chat_id = ?);
+	DELETE FROM message_chunks
+	WHERE chat_id = ? AND embedding_model != COALESCE((SELECT embedding_model FROM chat_settings WHERE chat_id = ?), '');
+	`, chatID, chatID, chatID, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to cancel migration: %w", err)
+	}
+	return nil
+}
+
+// SwitchEmbeddingModel completes a chat's migration: staged vectors of
+// model replace the current ones and model starts serving searches. Chunks
+// of other models are dropped, since vectors of the old model can't be
+// compared with the new one. It fails with ErrMigrationIncomplete, leaving
+// the old vectors serving, while any message with a vector lacks a staged
+// one.
+func (db *DB) SwitchEmbeddingModel(ctx context.Context, chatID int64, model string) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var missing int
+	if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+unstagedEmbeddingsQuery+`)`, chatID, model).Scan(&missing); err != nil {
+		return fmt.Errorf("failed to count unstaged embeddings: %w", err)
+	}
+	if missing > 0 {
+		return fmt.Errorf("%w: %d messages", ErrMigrationIncomplete, missing)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	UPDATE messages SET
+		embedding = (SELECT embedding FROM staged_embeddings WHERE message_id = messages.id),
+		embedding_dim = (SELECT embedding_dim FROM staged_embeddings WHERE message_id = messages.id),
+		embedding_model = ?
+	WHERE chat_id = ? AND id IN (SELECT message_id FROM staged_embeddings WHERE model = ?);
+
+	UPDATE messages SET embedding = NULL, embedding_dim = 0, embedding_model = ''
+	WHERE chat_id = ? AND embedding_model != ?;
+
+	DELETE FROM staged_embeddings WHERE message_id IN (SELECT id FROM messages WHERE chat_id = ?);
+	DELETE FROM message_chunks WHERE chat_id = ? AND embedding_model != ?;
+
+	UPDATE chat_settings SET embedding_model = ?, migration_model = NULL WHERE chat_id = ?;
+	`, model, chatID, model, chatID, model, chatID, chatID, model, model, chatID)
+	if err != nil {
+		return fmt.Errorf("failed to switch embedding model: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// QueueUnstagedEmbeddings queues the messages of a chat that keep a vector
+// of the old model but have none staged for model, so a migration whose
+// jobs gave up tries them again. Returns the number of queued messages.
+func (db *DB) QueueUnstagedEmbeddings(ctx context.Context, chatID int64, model string, now time.Time) (int, error) {
+	result, err := db.conn.ExecContext(ctx, `
+	INSERT INTO pending_embeddings (message_id, next_attempt_at)
+	SELECT id, ? FROM (`+unstagedEmbeddingsQuery+`)
+	WHERE true
+	ON CONFLICT(message_id) DO NOTHING
+	`, now.UTC(), chatID, model)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue unstaged embeddings: %w", err)
+	}
+
+	queued, _ := result.RowsAffected()
+	return int(queued), nil
+}
+
+// StagedEmbeddingCount returns how many messages of a chat have a vector
+// staged by a migration
+func (db *DB) StagedEmbeddingCount(ctx context.Context, chatID int64) (int, error) {
+	var count int
+	err := db.conn.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM staged_embeddings
+	WHERE message_id IN (SELECT id FROM messages WHERE chat_id = ?)
+	`, chatID).Scan(&count)
+	return count, err
+}
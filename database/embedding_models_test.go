@@ -0,0 +1,127 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingModelMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	first, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 1, Text: "first message", Timestamp: now, Embedding: []float64{1, 0}})
+	second, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 2, UserID: 1, Text: "second message", Timestamp: now, Embedding: []float64{0, 1}})
+
+	// Vectors stored before models were tracked belong to the configured model
+	if err := db.AdoptEmbeddingModel(ctx, "old-model"); err != nil {
+		t.Fatalf("AdoptEmbeddingModel failed: %v", err)
+	}
+	if state, _ := db.GetEmbeddingModelState(ctx, 1); state.Active != "old-model" || state.Migrating != "" {
+		t.Errorf("Expected chat pinned to old-model, got %+v", state)
+	}
+
+	queued, err := db.StartEmbeddingMigration(ctx, 1, "new-model", now)
+	if err != nil {
+		t.Fatalf("StartEmbeddingMigration failed: %v", err)
+	}
+	if queued != 2 {
+		t.Errorf("Expected 2 queued messages, got %d", queued)
+	}
+
+	// New vectors are staged while the old ones keep serving
+	jobs, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if ok, err := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0, 0}, nil, "new-model", now); err != nil || ok {
+		t.Errorf("Expected staged embedding, got %v, %v", ok, err)
+	}
+	if serving, _ := db.GetMessagesWithEmbeddings(ctx, 1, "old-model"); len(serving) != 2 {
+		t.Errorf("Expected old vectors to keep serving, got %d", len(serving))
+	}
+	if staged, _ := db.StagedEmbeddingCount(ctx, 1); staged != 1 {
+		t.Errorf("Expected 1 staged vector, got %d", staged)
+	}
+	if states, _ := db.GetEmbeddingModelStates(ctx); len(states) != 1 || states[0].Migrating != "new-model" {
+		t.Errorf("Expected a running migration, got %+v", states)
+	}
+
+	// The second job gave up: switching would leave its message without a
+	// vector, so the old model keeps serving
+	db.DropEmbeddingJob(ctx, second)
+	if err := db.SwitchEmbeddingModel(ctx, 1, "new-model"); !errors.Is(err, ErrMigrationIncomplete) {
+		t.Fatalf("Expected ErrMigrationIncomplete, got %v", err)
+	}
+	if serving, _ := db.GetMessagesWithEmbeddings(ctx, 1, "old-model"); len(serving) != 2 {
+		t.Errorf("Expected old vectors to keep serving, got %d", len(serving))
+	}
+	if state, _ := db.GetEmbeddingModelState(ctx, 1); state.Active != "old-model" || state.Migrating != "new-model" {
+		t.Errorf("Expected the migration to keep running, got %+v", state)
+	}
+
+	// Only the message without a staged vector is tried again
+	requeued, err := db.QueueUnstagedEmbeddings(ctx, 1, "new-model", now)
+	if err != nil {
+		t.Fatalf("QueueUnstagedEmbeddings failed: %v", err)
+	}
+	if requeued != 1 {
+		t.Errorf("Expected 1 requeued message, got %d", requeued)
+	}
+	jobs, _ = db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(jobs) != 1 || jobs[0].MessageID != second {
+		t.Fatalf("Expected the second message to be queued, got %+v", jobs)
+	}
+	db.CompleteEmbeddingJob(ctx, jobs[0], []float64{0, 1, 0}, nil, "new-model", now)
+
+	if err := db.SwitchEmbeddingModel(ctx, 1, "new-model"); err != nil {
+		t.Fatalf("SwitchEmbeddingModel failed: %v", err)
+	}
+
+	switched, _ := db.GetMessagesWithEmbeddings(ctx, 1, "new-model")
+	if len(switched) != 2 || switched[0].ID != first || len(switched[0].Embedding) != 3 {
+		t.Errorf("Expected the staged vectors to serve, got %+v", switched)
+	}
+	if old, _ := db.GetMessagesWithEmbeddings(ctx, 1, "old-model"); len(old) != 0 {
+		t.Errorf("Expected old vectors to be dropped, got %d", len(old))
+	}
+	if state, _ := db.GetEmbeddingModelState(ctx, 1); state.Active != "new-model" || state.Migrating != "" {
+		t.Errorf("Expected chat switched to new-model, got %+v", state)
+	}
+	if staged, _ := db.StagedEmbeddingCount(ctx, 1); staged != 0 {
+		t.Errorf("Expected staged vectors to be cleared, got %d", staged)
+	}
+}
+
+func TestCancelEmbeddingMigration(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	id, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 1, Text: "hello", Timestamp: now}, now)
+
+	// A chat's first vector pins its model
+	jobs, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if ok, _ := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0}, nil, "old-model", now); !ok {
+		t.Error("Expected the first vector to serve searches")
+	}
+	if state, _ := db.GetEmbeddingModelState(ctx, 1); state.Active != "old-model" {
+		t.Errorf("Expected chat pinned to old-model, got %+v", state)
+	}
+
+	db.StartEmbeddingMigration(ctx, 1, "new-model", now)
+	jobs, _ = db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0, 0}, nil, "new-model", now)
+
+	if err := db.CancelEmbeddingMigration(ctx, 1); err != nil {
+		t.Fatalf("CancelEmbeddingMigration failed: %v", err)
+	}
+	if state, _ := db.GetEmbeddingModelState(ctx, 1); state.Active != "old-model" || state.Migrating != "" {
+		t.Errorf("Expected migration to be cancelled, got %+v", state)
+	}
+	if staged, _ := db.StagedEmbeddingCount(ctx, 1); staged != 0 {
+		t.Errorf("Expected staged vectors to be dropped, got %d", staged)
+	}
+	if serving, _ := db.GetMessagesWithEmbeddings(ctx, 1, "old-model"); len(serving) != 1 || serving[0].ID != id {
+		t.Errorf("Expected the old vector to keep serving, got %+v", serving)
+	}
+}
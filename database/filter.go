@@ -0,0 +1,75 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// MessageFilter restricts which messages a query considers. The zero value
+// matches everything.
+type MessageFilter struct {
+	Usernames []string  // match any of these authors or forward origins (case-insensitive, without @)
+	After     time.Time // inclusive lower bound on timestamp
+	Before    time.Time // exclusive upper bound on timestamp
+	HasLink   bool      // only messages containing a URL
+
+	ContentTypes []string // match any of these content types, e.g. ContentPhoto
+}
+
+// IsEmpty reports whether the filter matches every message
+func (f MessageFilter) IsEmpty() bool {
+	return len(f.Usernames) == 0 && f.After.IsZero() && f.Before.IsZero() && !f.HasLink && len(f.ContentTypes) == 0
+}
+
+// where builds SQL conditions for the filter, to be ANDed onto a query over
+// messages. column prefixes every column name, e.g. "messages." for joins.
+func (f MessageFilter) where(column string) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	// Messages forwarded from a user's account count as theirs too. Their
+	// origin is stored as @username.
+	if len(f.Usernames) > 0 {
+		placeholders := make([]string, len(f.Usernames))
+		var origins []interface{}
+		for i, username := range f.Usernames {
+			placeholders[i] = "?"
+			args = append(args, strings.ToLower(username))
+			origins = append(origins, "@"+strings.ToLower(username))
+		}
+		in := " IN (" + strings.Join(placeholders, ",") + ")"
+		conditions = append(conditions, "(LOWER("+column+"username)"+in+" OR LOWER("+column+"forward_origin)"+in+")")
+		args = append(args, origins...)
+	}
+
+	// Timestamps are stored in UTC and compared as text, so bounds must be too
+	if !f.After.IsZero() {
+		conditions = append(conditions, column+"timestamp >= ?")
+		args = append(args, f.After.UTC())
+	}
+
+	if !f.Before.IsZero() {
+		conditions = append(conditions, column+"timestamp < ?")
+		args = append(args, f.Before.UTC())
+	}
+
+	if f.HasLink {
+		text := column + "text"
+		conditions = append(conditions, "("+text+" LIKE '%http://%' OR "+text+" LIKE '%https://%' OR "+
+			text+" LIKE '%www.%' OR "+text+" LIKE '%t.me/%')")
+	}
+
+	if len(f.ContentTypes) > 0 {
+		placeholders := make([]string, len(f.ContentTypes))
+		for i, contentType := range f.ContentTypes {
+			placeholders[i] = "?"
+			args = append(args, contentType)
+		}
+		conditions = append(conditions, column+"content_type IN ("+strings.Join(placeholders, ",")+")")
+	}
+
+	if len(conditions) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(conditions, " AND "), args
+}
@@ -0,0 +1,209 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// KeywordMatch is a message matched by full-text search
+type KeywordMatch struct {
+	ID    int64
+	Score float64 // higher is better
+}
+
+// ftsTriggers keep messages_fts in sync with messages.text
+var ftsTriggers = map[string]string{
+	"messages_fts_insert": `
+	CREATE TRIGGER messages_fts_insert AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, text) VALUES (new.id, new.text);
+	END`,
+	"messages_fts_delete": `
+	CREATE TRIGGER messages_fts_delete AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+	END`,
+	"messages_fts_update": `
+	CREATE TRIGGER messages_fts_update AFTER UPDATE OF text ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, text) VALUES ('delete', old.id, old.text);
+		INSERT INTO messages_fts(rowid, text) VALUES (new.id, new.text);
+	END`,
+}
+
+// detectFTS checks whether SQLite was built with FTS5.
+//
+// FTS5 is only compiled into go-sqlite3 with the sqlite_fts5 build tag
+// (see the Makefile). Without it the sync triggers are dropped, so that
+// writes to messages (including migrations) keep working, and KeywordSearch
+// falls back to LIKE matching. It runs before migrations.
+func (db *DB) detectFTS() error {
+	if err := db.conn.QueryRow(`SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&db.ftsAvailable); err != nil {
+		return fmt.Errorf("failed to check FTS5 support: %w", err)
+	}
+
+	if db.ftsAvailable {
+		return nil
+	}
+
+	log.Printf("⚠️  SQLite built without FTS5, keyword search will use LIKE matching (build with -tags sqlite_fts5)")
+	for name := range ftsTriggers {
+		if _, err := db.conn.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			return fmt.Errorf("failed to drop trigger %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// initFTS sets up the messages_fts FTS5 table and its sync triggers after
+// migrations have run. The index is rebuilt whenever a trigger had to be
+// recreated, so a binary built with FTS5 catches up on rows written by one
+// built without it or on tables rebuilt by a migration.
+func (db *DB) initFTS() error {
+	if !db.ftsAvailable {
+		return nil
+	}
+
+	_, err := db.conn.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(text, content='messages', content_rowid='id')`)
+	if err != nil {
+		return fmt.Errorf("failed to create messages_fts table: %w", err)
+	}
+
+	rebuild := false
+	for name, ddl := range ftsTriggers {
+		var count int
+		if err := db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?`, name).Scan(&count); err != nil {
+			return fmt.Errorf("failed to check trigger %s: %w", name, err)
+		}
+		if count > 0 {
+			continue
+		}
+
+		if _, err := db.conn.Exec(ddl); err != nil {
+			return fmt.Errorf("failed to create trigger %s: %w", name, err)
+		}
+		rebuild = true
+	}
+
+	if rebuild {
+		log.Println("Rebuilding full-text search index...")
+		if _, err := db.conn.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`); err != nil {
+			return fmt.Errorf("failed to rebuild messages_fts: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// KeywordSearch finds messages in a chat containing any of the query terms
+// and matching the filter, best matches first. Scores are BM25 when FTS5 is
+// available, otherwise the number of matched terms.
+func (db *DB) KeywordSearch(ctx context.Context, chatID int64, query string, filter MessageFilter, limit int) ([]KeywordMatch, error) {
+	terms := keywordTerms(query)
+	if len(terms) == 0 {
+		return []KeywordMatch{}, nil
+	}
+
+	if db.ftsAvailable {
+		return db.ftsSearch(ctx, chatID, terms, filter, limit)
+	}
+	return db.likeSearch(ctx, chatID, terms, filter, limit)
+}
+
+func (db *DB) ftsSearch(ctx context.Context, chatID int64, terms []string, filter MessageFilter, limit int) ([]KeywordMatch, error) {
+	// Quote every term so identifiers like INC-1234 or db01.prod are
+	// matched as phrases instead of being parsed as FTS5 syntax
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = `"` + term + `"`
+	}
+
+	where, filterArgs := filter.where("messages.")
+	query := `
+	SELECT messages.id, bm25(messages_fts)
+	FROM messages_fts
+	JOIN messages ON messages.id = messages_fts.rowid
+	WHERE messages_fts MATCH ? AND messages.chat_id = ? AND ` + where + `
+	ORDER BY bm25(messages_fts)
+	LIMIT ?
+	`
+
+	args := append([]interface{}{strings.Join(quoted, " OR "), chatID}, filterArgs...)
+	rows, err := db.conn.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run full-text search: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []KeywordMatch{}
+	for rows.Next() {
+		var match KeywordMatch
+		var rank float64
+		if err := rows.Scan(&match.ID, &rank); err != nil {
+			return nil, fmt.Errorf("failed to scan full-text match: %w", err)
+		}
+		match.Score = -rank // bm25() is lower for better matches
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+func (db *DB) likeSearch(ctx context.Context, chatID int64, terms []string, filter MessageFilter, limit int) ([]KeywordMatch, error) {
+	var score []string
+	var args []interface{}
+	for _, term := range terms {
+		score = append(score, `(text LIKE ? ESCAPE '\')`)
+		args = append(args, "%"+escapeLike(term)+"%")
+	}
+
+	where, filterArgs := filter.where("")
+	query := fmt.Sprintf(`
+	SELECT id, score FROM (
+		SELECT id, timestamp, %s AS score
+		FROM messages
+		WHERE chat_id = ? AND %s
+	)
+	WHERE score > 0
+	ORDER BY score DESC, timestamp DESC
+	LIMIT ?
+	`, strings.Join(score, " + "), where)
+
+	args = append(args, chatID)
+	args = append(args, filterArgs...)
+	args = append(args, limit)
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run keyword search: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []KeywordMatch{}
+	for rows.Next() {
+		var match KeywordMatch
+		if err := rows.Scan(&match.ID, &match.Score); err != nil {
+			return nil, fmt.Errorf("failed to scan keyword match: %w", err)
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+// keywordTerms splits a query into search terms, dropping quote characters
+// that would break FTS5 phrase syntax
+func keywordTerms(query string) []string {
+	var terms []string
+	for _, field := range strings.Fields(query) {
+		term := strings.ReplaceAll(field, `"`, "")
+		if term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func escapeLike(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "%", `\%`)
+	return strings.ReplaceAll(s, "_", `\_`)
+}
@@ -0,0 +1,166 @@
+package database
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+	db, err := NewDB(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestKeywordSearch(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	texts := []string{
+		"deploy failed on db01.prod with error E1234",
+		"lunch at noon?",
+		"INC-1234 is assigned to the infra team",
+		"the deploy went fine this time",
+	}
+	for i, text := range texts {
+		if _, err := db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Text: text, Timestamp: now.Add(time.Duration(i) * time.Minute)}); err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+	}
+	db.SaveMessage(ctx, Message{ChatID: 2, UserID: 1, Text: "INC-1234 in another chat", Timestamp: now})
+
+	matches, err := db.KeywordSearch(ctx, 1, "INC-1234", MessageFilter{}, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != 3 {
+		t.Errorf("Expected only message 3 for INC-1234, got %+v", matches)
+	}
+
+	matches, err = db.KeywordSearch(ctx, 1, "deploy E1234", MessageFilter{}, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 2 || matches[0].ID != 1 {
+		t.Errorf("Expected message 1 ranked first of 2 matches, got %+v", matches)
+	}
+
+	matches, err = db.KeywordSearch(ctx, 1, `"`, MessageFilter{}, 10)
+	if err != nil || len(matches) != 0 {
+		t.Errorf("Expected no matches for empty query, got %+v, %v", matches, err)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	base := time.Date(2026, 1, 10, 12, 0, 0, 0, time.Local)
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Username: "Alice", Text: "deploy notes https://wiki/deploy", Timestamp: base, Embedding: []float64{1, 0}})
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 2, Username: "bob", Text: "deploy tomorrow", Timestamp: base.AddDate(0, 0, 1), Embedding: []float64{0, 1}})
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Username: "Alice", Text: "deploy done", Timestamp: base.AddDate(0, 0, 2)})
+
+	byAlice := MessageFilter{Usernames: []string{"alice"}}
+	messages, err := db.FilterRecentMessages(ctx, 1, byAlice, 10)
+	if err != nil {
+		t.Fatalf("FilterRecentMessages failed: %v", err)
+	}
+	if len(messages) != 2 || messages[0].ID != 3 {
+		t.Errorf("Expected Alice's 2 messages newest first, got %+v", messages)
+	}
+
+	withEmbeddings, err := db.FilterMessagesWithEmbeddings(ctx, 1, "", byAlice)
+	if err != nil {
+		t.Fatalf("FilterMessagesWithEmbeddings failed: %v", err)
+	}
+	if len(withEmbeddings) != 1 || withEmbeddings[0].ID != 1 {
+		t.Errorf("Expected only message 1, got %+v", withEmbeddings)
+	}
+
+	dayTwo := MessageFilter{
+		After:  time.Date(2026, 1, 11, 0, 0, 0, 0, time.Local),
+		Before: time.Date(2026, 1, 12, 0, 0, 0, 0, time.Local),
+	}
+	matches, err := db.KeywordSearch(ctx, 1, "deploy", dayTwo, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != 2 {
+		t.Errorf("Expected only message 2 in date range, got %+v", matches)
+	}
+
+	matches, err = db.KeywordSearch(ctx, 1, "deploy", MessageFilter{HasLink: true}, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != 1 {
+		t.Errorf("Expected only message 1 with a link, got %+v", matches)
+	}
+}
+
+func TestFilterMatchesForwardOrigin(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Username: "alice", Text: "deploy notes", Timestamp: now})
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 2, Username: "bob", Text: "deploy plan", ForwardOrigin: "@Alice", Timestamp: now})
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 2, Username: "bob", Text: "deploy news", ForwardOrigin: "Ops Channel", Timestamp: now})
+
+	matches, err := db.KeywordSearch(ctx, 1, "deploy", MessageFilter{Usernames: []string{"alice"}}, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected Alice's message and the one forwarded from her, got %+v", matches)
+	}
+	for _, match := range matches {
+		if match.ID == 3 {
+			t.Errorf("Expected the channel forward not to match, got %+v", match)
+		}
+	}
+
+	messages, err := db.FilterRecentMessages(ctx, 1, MessageFilter{Usernames: []string{"bob", "carol"}}, 10)
+	if err != nil {
+		t.Fatalf("FilterRecentMessages failed: %v", err)
+	}
+	if len(messages) != 2 {
+		t.Errorf("Expected Bob's 2 messages, got %+v", messages)
+	}
+}
+
+func TestFilterTimeZones(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// 23:30 UTC on Jan 10 is already Jan 11 in UTC+5, a bound in UTC-8 is
+	// compared by instant rather than by its wall clock
+	plus5 := time.FixedZone("UTC+5", 5*60*60)
+	minus8 := time.FixedZone("UTC-8", -8*60*60)
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Username: "alice", Text: "late deploy", Timestamp: time.Date(2026, 1, 11, 4, 30, 0, 0, plus5)})
+	db.SaveMessage(ctx, Message{ChatID: 1, UserID: 1, Username: "alice", Text: "early deploy", Timestamp: time.Date(2026, 1, 11, 5, 0, 0, 0, time.UTC)})
+
+	after := MessageFilter{After: time.Date(2026, 1, 10, 20, 0, 0, 0, minus8)} // 04:00 UTC on Jan 11
+	messages, err := db.FilterRecentMessages(ctx, 1, after, 10)
+	if err != nil {
+		t.Fatalf("FilterRecentMessages failed: %v", err)
+	}
+	if len(messages) != 1 || messages[0].ID != 2 {
+		t.Errorf("Expected only message 2 after the bound, got %+v", messages)
+	}
+
+	before := MessageFilter{Before: time.Date(2026, 1, 11, 9, 0, 0, 0, plus5)} // 04:00 UTC on Jan 11
+	if matches, _ := db.KeywordSearch(ctx, 1, "deploy", before, 10); len(matches) != 1 || matches[0].ID != 1 {
+		t.Errorf("Expected only message 1 before the bound, got %+v", matches)
+	}
+
+	if !messages[0].Timestamp.Equal(time.Date(2026, 1, 11, 5, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the stored instant back, got %v", messages[0].Timestamp)
+	}
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// RecordChatMember notes that a user posted in a chat, along with the
+// chat's current title if it has one
+func (db *DB) RecordChatMember(ctx context.Context, chatID, userID int64, title string, now time.Time) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO chat_members (chat_id, user_id, last_seen) VALUES (?, ?, ?)
+	ON CONFLICT(chat_id, user_id) DO UPDATE SET last_seen = excluded.last_seen
+	`, chatID, userID, now)
+	if err != nil {
+		return fmt.Errorf("failed to record chat member: %w", err)
+	}
+
+	if title != "" {
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO chat_settings (chat_id, title) VALUES (?, ?)
+		ON CONFLICT(chat_id) DO UPDATE SET title = excluded.title WHERE title != excluded.title
+		`, chatID, title)
+		if err != nil {
+			return fmt.Errorf("failed to save chat title: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetMemberChats returns the chats a user has been seen posting in that
+// allow searches from other chats, most recently active first. Title is
+// empty for chats whose title isn't known.
+func (db *DB) GetMemberChats(ctx context.Context, userID int64) ([]MemberChat, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT chat_members.chat_id, COALESCE(chat_settings.title, '')
+	FROM chat_members
+	LEFT JOIN chat_settings ON chat_settings.chat_id = chat_members.chat_id
+	WHERE chat_members.user_id = ? AND COALESCE(chat_settings.cross_chat_search, 1) = 1
+	ORDER BY chat_members.last_seen DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query member chats: %w", err)
+	}
+	defer rows.Close()
+
+	var chats []MemberChat
+	for rows.Next() {
+		var chat MemberChat
+		if err := rows.Scan(&chat.ChatID, &chat.Title); err != nil {
+			return nil, fmt.Errorf("failed to scan member chat: %w", err)
+		}
+		chats = append(chats, chat)
+	}
+	return chats, rows.Err()
+}
+
+// GetCrossChatSearch reports whether a chat's messages may be found by
+// searches made in other chats, which they are unless an admin opted out
+func (db *DB) GetCrossChatSearch(ctx context.Context, chatID int64) (bool, error) {
+	var enabled bool
+	err := db.conn.QueryRowContext(ctx, `SELECT cross_chat_search FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read cross-chat search setting: %w", err)
+	}
+	return enabled, nil
+}
+
+// SetCrossChatSearch allows or prevents searches made in other chats from
+// finding a chat's messages
+func (db *DB) SetCrossChatSearch(ctx context.Context, chatID int64, enabled bool) error {
+	_, err := db.conn.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, cross_chat_search) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET cross_chat_search = excluded.cross_chat_search
+	`, chatID, enabled)
+	if err != nil {
+		return fmt.Errorf("failed to save cross-chat search setting: %w", err)
+	}
+	return nil
+}
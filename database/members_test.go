@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestChatMembers(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	db.RecordChatMember(ctx, -1, 1, "Ops", now.Add(-time.Hour))
+	db.RecordChatMember(ctx, -2, 1, "Infra", now)
+	db.RecordChatMember(ctx, -3, 1, "", now.Add(-2*time.Hour))
+	db.RecordChatMember(ctx, -2, 2, "Infra Team", now)
+
+	chats, err := db.GetMemberChats(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetMemberChats failed: %v", err)
+	}
+	expected := []MemberChat{{-2, "Infra Team"}, {-1, "Ops"}, {-3, ""}}
+	if len(chats) != len(expected) {
+		t.Fatalf("Expected %+v, got %+v", expected, chats)
+	}
+	for i := range expected {
+		if chats[i] != expected[i] {
+			t.Errorf("Expected %+v at %d, got %+v", expected[i], i, chats[i])
+		}
+	}
+
+	// Opted out chats are left out
+	if enabled, _ := db.GetCrossChatSearch(ctx, -1); !enabled {
+		t.Error("Expected cross-chat search to be allowed by default")
+	}
+	if err := db.SetCrossChatSearch(ctx, -1, false); err != nil {
+		t.Fatalf("SetCrossChatSearch failed: %v", err)
+	}
+	if enabled, _ := db.GetCrossChatSearch(ctx, -1); enabled {
+		t.Error("Expected cross-chat search to be off")
+	}
+	if chats, _ := db.GetMemberChats(ctx, 1); len(chats) != 2 {
+		t.Errorf("Expected the opted out chat to be left out, got %+v", chats)
+	}
+
+	// Erasing a user forgets where they posted
+	if _, err := db.DeleteMessagesByUser(ctx, 1); err != nil {
+		t.Fatalf("DeleteMessagesByUser failed: %v", err)
+	}
+	if chats, _ := db.GetMemberChats(ctx, 1); len(chats) != 0 {
+		t.Errorf("Expected no chats after erasure, got %+v", chats)
+	}
+	if chats, _ := db.GetMemberChats(ctx, 2); len(chats) != 1 {
+		t.Errorf("Expected other users' chats to stay, got %+v", chats)
+	}
+}
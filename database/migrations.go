@@ -0,0 +1,419 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// migration is a single schema change. Migrations are applied in order of
+// version, each inside its own transaction, and recorded in schema_version.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// migrations must be kept in ascending version order; never edit or reorder
+// a migration that has been released, add a new one instead
+var migrations = []migration{
+	{1, "binary float32 embeddings", migrateBinaryEmbeddings},
+	{2, "telegram message and thread IDs", execMigration(`
+		ALTER TABLE messages ADD COLUMN telegram_message_id INTEGER NOT NULL DEFAULT 0;
+		ALTER TABLE messages ADD COLUMN thread_id INTEGER NOT NULL DEFAULT 0;
+		CREATE INDEX idx_chat_telegram_message ON messages(chat_id, telegram_message_id);
+	`)},
+	{3, "message edit history", execMigration(`
+		CREATE TABLE message_edits (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			embedding BLOB,
+			embedding_dim INTEGER NOT NULL DEFAULT 0,
+			edited_at DATETIME NOT NULL
+		);
+		CREATE INDEX idx_message_edits_message ON message_edits(message_id);
+		CREATE INDEX idx_message_edits_chat ON message_edits(chat_id);
+
+		-- Edits used to be stored as new rows: keep the newest row of each
+		-- Telegram message and move the older ones into the history
+		CREATE TEMP TABLE duplicate_keepers AS
+			SELECT chat_id, telegram_message_id, MAX(id) AS keep_id
+			FROM messages
+			WHERE telegram_message_id > 0
+			GROUP BY chat_id, telegram_message_id
+			HAVING COUNT(*) > 1;
+
+		INSERT INTO message_edits (message_id, chat_id, text, embedding, embedding_dim, edited_at)
+			SELECT k.keep_id, m.chat_id, m.text, m.embedding, m.embedding_dim, m.timestamp
+			FROM messages m
+			JOIN duplicate_keepers k ON k.chat_id = m.chat_id AND k.telegram_message_id = m.telegram_message_id
+			WHERE m.id != k.keep_id
+			ORDER BY m.id;
+
+		DELETE FROM messages WHERE id IN (
+			SELECT m.id
+			FROM messages m
+			JOIN duplicate_keepers k ON k.chat_id = m.chat_id AND k.telegram_message_id = m.telegram_message_id
+			WHERE m.id != k.keep_id
+		);
+
+		DROP TABLE duplicate_keepers;
+		DROP INDEX idx_chat_telegram_message;
+		CREATE UNIQUE INDEX idx_chat_telegram_message ON messages(chat_id, telegram_message_id)
+			WHERE telegram_message_id > 0;
+	`)},
+	{4, "per-chat settings", execMigration(`
+		CREATE TABLE chat_settings (
+			chat_id INTEGER PRIMARY KEY,
+			retention_days INTEGER -- NULL uses the configured default, 0 keeps messages forever
+		);
+	`)},
+	{5, "audit log", execMigration(`
+		CREATE TABLE audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			action TEXT NOT NULL,
+			user_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			details TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL
+		);
+		CREATE INDEX idx_audit_log_user ON audit_log(user_id);
+		CREATE INDEX idx_messages_user ON messages(user_id);
+	`)},
+	{6, "pending embedding queue", execMigration(`
+		CREATE TABLE pending_embeddings (
+			message_id INTEGER PRIMARY KEY,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_error TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_pending_embeddings_due ON pending_embeddings(next_attempt_at);
+	`)},
+	{7, "embedding models", execMigration(`
+		-- Vectors stored before models were tracked are labelled by AdoptEmbeddingModel
+		ALTER TABLE messages ADD COLUMN embedding_model TEXT NOT NULL DEFAULT '';
+		ALTER TABLE message_edits ADD COLUMN embedding_model TEXT NOT NULL DEFAULT '';
+
+		ALTER TABLE chat_settings ADD COLUMN embedding_model TEXT; -- model of the vectors serving searches
+		ALTER TABLE chat_settings ADD COLUMN migration_model TEXT; -- model the chat is being re-embedded with
+
+		-- Vectors of a migration's new model, swapped in once the chat is done
+		CREATE TABLE staged_embeddings (
+			message_id INTEGER PRIMARY KEY,
+			model TEXT NOT NULL,
+			embedding BLOB NOT NULL,
+			embedding_dim INTEGER NOT NULL
+		);
+	`)},
+	{8, "embedding cache", execMigration(`
+		CREATE TABLE embedding_cache (
+			model TEXT NOT NULL,
+			text_hash TEXT NOT NULL, -- hex SHA-256 of the normalized text
+			embedding BLOB NOT NULL,
+			embedding_dim INTEGER NOT NULL,
+			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (model, text_hash)
+		);
+		CREATE INDEX idx_embedding_cache_created ON embedding_cache(created_at);
+	`)},
+	{9, "conversation windows", execMigration(`
+		ALTER TABLE messages ADD COLUMN reply_to_message_id INTEGER NOT NULL DEFAULT 0; -- Telegram ID of the message replied to
+		ALTER TABLE chat_settings ADD COLUMN windowed_through INTEGER; -- last message grouped into conversation windows
+
+		-- Consecutive messages embedded as a unit. A conversation (segment) is
+		-- the chat's messages with IDs from segment_first_id to segment_last_id.
+		CREATE TABLE conversation_windows (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id INTEGER NOT NULL,
+			segment_first_id INTEGER NOT NULL,
+			segment_last_id INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			embedding BLOB,
+			embedding_dim INTEGER NOT NULL DEFAULT 0,
+			embedding_model TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_conversation_windows_segment ON conversation_windows(chat_id, segment_first_id);
+
+		CREATE TABLE conversation_window_messages (
+			window_id INTEGER NOT NULL,
+			message_id INTEGER NOT NULL,
+			position INTEGER NOT NULL, -- line of the message in the window
+			PRIMARY KEY (window_id, message_id)
+		);
+		CREATE INDEX idx_conversation_window_messages_message ON conversation_window_messages(message_id);
+
+		-- Conversations whose messages were edited or deleted, to be windowed again
+		CREATE TABLE stale_conversations (
+			chat_id INTEGER NOT NULL,
+			segment_first_id INTEGER NOT NULL,
+			segment_last_id INTEGER NOT NULL,
+			PRIMARY KEY (chat_id, segment_first_id)
+		);
+	`)},
+	{10, "message chunks", execMigration(`
+		-- Overlapping parts of long messages, embedded on their own. A message
+		-- has one set of chunks per model it was embedded with.
+		CREATE TABLE message_chunks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			message_id INTEGER NOT NULL,
+			chat_id INTEGER NOT NULL,
+			position INTEGER NOT NULL, -- order of the chunk in the message
+			text TEXT NOT NULL,
+			embedding BLOB,
+			embedding_dim INTEGER NOT NULL DEFAULT 0,
+			embedding_model TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX idx_message_chunks_message ON message_chunks(message_id);
+		CREATE INDEX idx_message_chunks_chat ON message_chunks(chat_id, embedding_model);
+	`)},
+	{11, "message content types", execMigration(`
+		ALTER TABLE messages ADD COLUMN content_type TEXT NOT NULL DEFAULT 'text'; -- text, photo, document, poll...
+		ALTER TABLE messages ADD COLUMN forward_origin TEXT NOT NULL DEFAULT ''; -- who a forwarded message came from
+	`)},
+	{12, "document text", execMigration(`
+		-- Text extracted from files attached to messages
+		CREATE TABLE message_documents (
+			message_id INTEGER NOT NULL,
+			page INTEGER NOT NULL, -- 0 for files without pages
+			text TEXT NOT NULL,
+			PRIMARY KEY (message_id, page)
+		);
+
+		ALTER TABLE message_chunks ADD COLUMN source TEXT NOT NULL DEFAULT 'text'; -- 'text' or 'document'
+		ALTER TABLE message_chunks ADD COLUMN page INTEGER NOT NULL DEFAULT 0; -- page of the attached file
+	`)},
+	{13, "chat members", execMigration(`
+		-- Who has posted in which chat, for searches across a user's chats
+		CREATE TABLE chat_members (
+			chat_id INTEGER NOT NULL,
+			user_id INTEGER NOT NULL,
+			last_seen DATETIME NOT NULL,
+			PRIMARY KEY (chat_id, user_id)
+		);
+		CREATE INDEX idx_chat_members_user ON chat_members(user_id);
+
+		INSERT INTO chat_members (chat_id, user_id, last_seen)
+		SELECT chat_id, user_id, MAX(timestamp) FROM messages GROUP BY chat_id, user_id;
+
+		ALTER TABLE chat_settings ADD COLUMN title TEXT NOT NULL DEFAULT ''; -- last seen chat title
+		ALTER TABLE chat_settings ADD COLUMN cross_chat_search INTEGER NOT NULL DEFAULT 1; -- 0 hides the chat from searches in other chats
+	`)},
+	{14, "private search results", execMigration(`
+		ALTER TABLE chat_settings ADD COLUMN private_results INTEGER NOT NULL DEFAULT 0; -- 1 sends /search results to the requester privately
+	`)},
+	{15, "utc message timestamps", migrateUTCTimestamps},
+}
+
+// execMigration builds a migration that only runs SQL statements
+func execMigration(statements string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(statements)
+		return err
+	}
+}
+
+// migrationBatchSize bounds how many rows a data migration holds in memory
+const migrationBatchSize = 500
+
+func (db *DB) migrate() error {
+	_, err := db.conn.Exec(`
+	CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+
+		log.Printf("Applying database migration %d: %s", m.version, m.name)
+		if err := db.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+
+	return nil
+}
+
+func (db *DB) applyMigration(m migration) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`INSERT INTO schema_version (version, name) VALUES (?, ?)`, m.version, m.name); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// SchemaVersion returns the version of the last applied migration
+func (db *DB) SchemaVersion() (int, error) {
+	var version int
+	err := db.conn.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+// migrateBinaryEmbeddings rebuilds the messages table with the embedding
+// stored as a little-endian float32 BLOB plus its dimension, converting the
+// JSON text embeddings of existing rows in batches
+func migrateBinaryEmbeddings(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE messages_new (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		chat_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		username TEXT,
+		text TEXT NOT NULL,
+		timestamp DATETIME NOT NULL,
+		embedding BLOB, -- little-endian float32 values
+		embedding_dim INTEGER NOT NULL DEFAULT 0
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create new messages table: %w", err)
+	}
+
+	insert, err := tx.Prepare(`
+	INSERT INTO messages_new (id, chat_id, user_id, username, text, timestamp, embedding, embedding_dim)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare insert: %w", err)
+	}
+	defer insert.Close()
+
+	var lastID int64
+	converted := 0
+	for {
+		rows, err := tx.Query(`
+		SELECT id, chat_id, user_id, username, text, timestamp, embedding
+		FROM messages
+		WHERE id > ?
+		ORDER BY id
+		LIMIT ?`, lastID, migrationBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+
+		type legacyRow struct {
+			msg           Message
+			username      sql.NullString
+			embeddingJSON sql.NullString
+		}
+
+		var batch []legacyRow
+		for rows.Next() {
+			var row legacyRow
+			if err := rows.Scan(&row.msg.ID, &row.msg.ChatID, &row.msg.UserID, &row.username, &row.msg.Text, &row.msg.Timestamp, &row.embeddingJSON); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan message: %w", err)
+			}
+			batch = append(batch, row)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, row := range batch {
+			var embedding []float64
+			if row.embeddingJSON.Valid && row.embeddingJSON.String != "" {
+				if err := json.Unmarshal([]byte(row.embeddingJSON.String), &embedding); err != nil {
+					log.Printf("Dropping invalid embedding for message %d: %v", row.msg.ID, err)
+					embedding = nil
+				}
+			}
+
+			_, err := insert.Exec(row.msg.ID, row.msg.ChatID, row.msg.UserID, row.username, row.msg.Text, row.msg.Timestamp,
+				encodeEmbedding(embedding), len(embedding))
+			if err != nil {
+				return fmt.Errorf("failed to convert message %d: %w", row.msg.ID, err)
+			}
+		}
+
+		lastID = batch[len(batch)-1].msg.ID
+		converted += len(batch)
+		log.Printf("Converted %d messages to binary embeddings", converted)
+	}
+
+	_, err = tx.Exec(`
+	DROP TABLE messages;
+	ALTER TABLE messages_new RENAME TO messages;
+	CREATE INDEX IF NOT EXISTS idx_chat_id ON messages(chat_id);
+	CREATE INDEX IF NOT EXISTS idx_timestamp ON messages(timestamp);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to swap messages table: %w", err)
+	}
+
+	return nil
+}
+
+// migrateUTCTimestamps rewrites message timestamps stored with the server's
+// UTC offset in UTC. Timestamps are compared as text, so values with
+// different offsets didn't order by time.
+func migrateUTCTimestamps(tx *sql.Tx) error {
+	update, err := tx.Prepare(`UPDATE messages SET timestamp = ? WHERE id = ?`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare update: %w", err)
+	}
+	defer update.Close()
+
+	var lastID int64
+	for {
+		rows, err := tx.Query(`SELECT id, timestamp FROM messages WHERE id > ? ORDER BY id LIMIT ?`, lastID, migrationBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+
+		var batch []Message
+		for rows.Next() {
+			var msg Message
+			if err := rows.Scan(&msg.ID, &msg.Timestamp); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan message: %w", err)
+			}
+			batch = append(batch, msg)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read messages: %w", err)
+		}
+
+		if len(batch) == 0 {
+			return nil
+		}
+
+		for _, msg := range batch {
+			if _, err := update.Exec(msg.Timestamp.UTC(), msg.ID); err != nil {
+				return fmt.Errorf("failed to convert timestamp of message %d: %w", msg.ID, err)
+			}
+		}
+		lastID = batch[len(batch)-1].ID
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingEncoding(t *testing.T) {
+	original := []float64{0.5, -1.25, 3.0, 0}
+	decoded, err := decodeEmbedding(encodeEmbedding(original), len(original))
+	if err != nil {
+		t.Fatalf("decodeEmbedding failed: %v", err)
+	}
+
+	for i := range original {
+		if math.Abs(decoded[i]-original[i]) > 1e-6 {
+			t.Errorf("Value %d: expected %f, got %f", i, original[i], decoded[i])
+		}
+	}
+
+	if encodeEmbedding(nil) != nil {
+		t.Error("Expected nil blob for empty embedding")
+	}
+
+	if _, err := decodeEmbedding([]byte{1, 2, 3}, 1); err == nil {
+		t.Error("Expected error for truncated blob")
+	}
+}
+
+func TestMigrateLegacyJSONEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// Build a database with the original JSON text schema
+	conn, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	legacy := &DB{conn: conn}
+	if err := legacy.initTables(); err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+
+	now := time.Now()
+	for i := 0; i < migrationBatchSize+10; i++ {
+		_, err := conn.Exec(`INSERT INTO messages (chat_id, user_id, username, text, timestamp, embedding) VALUES (?, ?, ?, ?, ?, ?)`,
+			1, 2, "alice", "hello world", now, "[0.25,0.5,1]")
+		if err != nil {
+			t.Fatalf("Failed to insert legacy row: %v", err)
+		}
+	}
+	conn.Exec(`INSERT INTO messages (chat_id, user_id, username, text, timestamp, embedding) VALUES (1, 2, 'bob', 'no vector', ?, '')`, now)
+	conn.Close()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("NewDB failed: %v", err)
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		t.Fatalf("SchemaVersion failed: %v", err)
+	}
+	if version != migrations[len(migrations)-1].version {
+		t.Errorf("Expected schema version %d, got %d", migrations[len(migrations)-1].version, version)
+	}
+
+	total, _ := db.GetStats(ctx, 1)
+	withEmbeddings, _ := db.GetStatsWithEmbeddings(ctx, 1)
+	if total != migrationBatchSize+11 || withEmbeddings != migrationBatchSize+10 {
+		t.Errorf("Expected %d/%d messages with embeddings, got %d/%d", migrationBatchSize+10, migrationBatchSize+11, withEmbeddings, total)
+	}
+
+	messages, err := db.GetMessagesWithEmbeddings(ctx, 1, "")
+	if err != nil {
+		t.Fatalf("GetMessagesWithEmbeddings failed: %v", err)
+	}
+	if len(messages[0].Embedding) != 3 || messages[0].Embedding[1] != 0.5 {
+		t.Errorf("Unexpected migrated embedding: %v", messages[0].Embedding)
+	}
+
+	// New rows keep getting IDs after the migrated ones
+	id, err := db.SaveMessage(ctx, Message{ChatID: 1, UserID: 2, Text: "after migration", Timestamp: now, Embedding: []float64{1, 2}})
+	if err != nil {
+		t.Fatalf("SaveMessage failed: %v", err)
+	}
+	if id != int64(migrationBatchSize+12) {
+		t.Errorf("Expected new message ID %d, got %d", migrationBatchSize+12, id)
+	}
+	db.Close()
+
+	// Reopening applies nothing twice
+	reopened, err := NewDB(path)
+	if err != nil {
+		t.Fatalf("Reopening database failed: %v", err)
+	}
+	reopened.Close()
+}
+
+func TestMigrateUTCTimestamps(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	// Written the way messages were stored before, in the server's offset
+	plus5 := time.FixedZone("UTC+5", 5*60*60)
+	written := time.Date(2026, 1, 11, 4, 30, 0, 0, plus5)
+	_, err := db.conn.Exec(`INSERT INTO messages (chat_id, user_id, username, text, timestamp) VALUES (1, 1, 'alice', 'deploy', ?)`, written)
+	if err != nil {
+		t.Fatalf("Failed to insert message: %v", err)
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		t.Fatalf("Failed to begin transaction: %v", err)
+	}
+	if err := migrateUTCTimestamps(tx); err != nil {
+		t.Fatalf("migrateUTCTimestamps failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+
+	var stored string
+	db.conn.QueryRow(`SELECT CAST(timestamp AS TEXT) FROM messages`).Scan(&stored)
+	if stored != "2026-01-10 23:30:00+00:00" {
+		t.Errorf("Expected the timestamp in UTC, got %q", stored)
+	}
+
+	messages, err := db.GetMessages(ctx, 1)
+	if err != nil {
+		t.Fatalf("GetMessages failed: %v", err)
+	}
+	if len(messages) != 1 || !messages[0].Timestamp.Equal(written) {
+		t.Errorf("Expected the same instant back, got %+v", messages)
+	}
+}
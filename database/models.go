@@ -5,11 +5,122 @@ import (
 )
 
 type Message struct {
+	ID                int64     `json:"id"`
+	ChatID            int64     `json:"chat_id"`
+	TelegramMessageID int       `json:"telegram_message_id"` // 0 for messages stored before it was tracked
+	ThreadID          int       `json:"thread_id"`           // forum topic, 0 outside topics
+	ReplyToMessageID  int       `json:"reply_to_message_id"` // Telegram ID of the message replied to, 0 if none
+	UserID            int64     `json:"user_id"`
+	Username          string    `json:"username"`
+	Text              string    `json:"text"`
+	ContentType       string    `json:"content_type"`   // one of the Content constants, ContentText if empty
+	ForwardOrigin     string    `json:"forward_origin"` // who a forwarded message came from, empty if not forwarded
+	Timestamp         time.Time `json:"timestamp"`
+	Embedding         []float64 `json:"embedding"`
+	EmbeddingModel    string    `json:"embedding_model"` // model that produced Embedding
+}
+
+// Content types of stored messages. The text of other content is its
+// caption along with e.g. a document's filename or a poll's options.
+const (
+	ContentText      = "text"
+	ContentPhoto     = "photo"
+	ContentVideo     = "video"
+	ContentAnimation = "animation"
+	ContentAudio     = "audio"
+	ContentVoice     = "voice"
+	ContentDocument  = "document"
+	ContentPoll      = "poll"
+)
+
+// MessageEdit is a previous version of an edited message
+type MessageEdit struct {
+	ID             int64     `json:"id"`
+	MessageID      int64     `json:"message_id"`
+	ChatID         int64     `json:"chat_id"`
+	Text           string    `json:"text"`
+	Embedding      []float64 `json:"embedding"`
+	EmbeddingModel string    `json:"embedding_model"`
+	EditedAt       time.Time `json:"edited_at"` // when this version was replaced
+}
+
+// AuditEntry records an action taken on stored data, e.g. a user's export
+// or erasure request
+type AuditEntry struct {
 	ID        int64     `json:"id"`
-	ChatID    int64     `json:"chat_id"`
-	UserID    int64     `json:"user_id"`
-	Username  string    `json:"username"`
-	Text      string    `json:"text"`
-	Timestamp time.Time `json:"timestamp"`
-	Embedding []float64 `json:"embedding"`
+	Action    string    `json:"action"`
+	UserID    int64     `json:"user_id"` // user who requested the action
+	ChatID    int64     `json:"chat_id"` // chat the request was made in
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// EmbeddingJob is a message waiting in the pending_embeddings queue
+type EmbeddingJob struct {
+	MessageID int64
+	ChatID    int64
+	Text      string // text to embed, as stored when the job was claimed
+	Attempts  int    // failed attempts so far
+
+	Document []DocumentPage // text of the attached file, if any
+}
+
+// DocumentPage is the text of a page of a file attached to a message
+type DocumentPage struct {
+	Page int // 0 for files without pages
+	Text string
+}
+
+// EmbeddingModelState tells which model's vectors serve a chat's searches
+// and which model, if any, the chat is being re-embedded with
+type EmbeddingModelState struct {
+	ChatID    int64
+	Active    string // empty until the chat's first message is embedded
+	Migrating string // empty when no migration is running
+}
+
+// MemberChat is a chat a user has been seen posting in
+type MemberChat struct {
+	ChatID int64
+	Title  string
+}
+
+// MessageChunk is a part of a long message, or of the file attached to a
+// message, embedded on its own so a passage deep inside can be found
+type MessageChunk struct {
+	ID             int64
+	MessageID      int64
+	ChatID         int64
+	Position       int    // order of the chunk in the message
+	Source         string // ChunkFromText if empty
+	Page           int    // page of the attached file, 0 if it has none
+	Text           string
+	Embedding      []float64
+	EmbeddingModel string
+}
+
+// Sources of message chunks
+const (
+	ChunkFromText     = "text"     // the message text
+	ChunkFromDocument = "document" // the file attached to the message
+)
+
+// ConversationWindow is a run of consecutive messages of a chat embedded as
+// a single unit, so short replies are searched along with their context
+type ConversationWindow struct {
+	ID             int64
+	ChatID         int64
+	SegmentFirstID int64   // first message of the conversation the window belongs to
+	SegmentLastID  int64   // last message of that conversation
+	MessageIDs     []int64 // messages of the window in line order
+	Text           string  // one "name: text" line per message
+	Embedding      []float64
+	EmbeddingModel string
+}
+
+// Conversation is a span of a chat's messages, by row ID
+type Conversation struct {
+	ChatID  int64
+	FirstID int64
+	LastID  int64
 }
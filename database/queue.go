@@ -0,0 +1,289 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// SaveMessageForEmbedding inserts a message without an embedding and queues
+// it for embedding in the same transaction
+func (db *DB) SaveMessageForEmbedding(ctx context.Context, msg Message, now time.Time) (int64, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	msg.Embedding = nil
+	result, err := tx.ExecContext(ctx, insertMessageQuery, messageArgs(msg)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save message: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get message ID: %w", err)
+	}
+
+	if err := queueEmbedding(ctx, tx, id, now); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit message: %w", err)
+	}
+
+	log.Printf("Saved message from %s in chat %d: %s", msg.Username, msg.ChatID, msg.Text[:min(50, len(msg.Text))])
+	return id, nil
+}
+
+// QueueEmbeddings queues stored messages for (re-)embedding. Messages that
+// are already queued are reset to be retried right away.
+func (db *DB) QueueEmbeddings(ctx context.Context, messageIDs []int64, now time.Time) error {
+	for _, id := range messageIDs {
+		if err := queueEmbedding(ctx, db.conn, id, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueEmbedding adds or resets the job of one message on a connection or
+// inside a transaction
+func queueEmbedding(ctx context.Context, exec interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}, messageID int64, now time.Time) error {
+	_, err := exec.ExecContext(ctx, `
+	INSERT INTO pending_embeddings (message_id, next_attempt_at) VALUES (?, ?)
+	ON CONFLICT(message_id) DO UPDATE SET attempts = 0, next_attempt_at = excluded.next_attempt_at, last_error = ''
+	`, messageID, now.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to queue embedding for message %d: %w", messageID, err)
+	}
+	return nil
+}
+
+// ClaimEmbeddingJobs returns up to limit jobs that are due, oldest first,
+// and leases them so they are not handed out again until lease has passed.
+// A job that is neither completed nor retried within the lease (e.g. after
+// a crash) becomes due again.
+func (db *DB) ClaimEmbeddingJobs(ctx context.Context, limit int, now time.Time, lease time.Duration) ([]EmbeddingJob, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+	SELECT p.message_id, m.chat_id, m.text, p.attempts
+	FROM pending_embeddings p
+	JOIN messages m ON m.id = p.message_id
+	WHERE p.next_attempt_at <= ?
+	ORDER BY p.message_id
+	LIMIT ?
+	`, now.UTC(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query pending embeddings: %w", err)
+	}
+
+	var jobs []EmbeddingJob
+	for rows.Next() {
+		var job EmbeddingJob
+		if err := rows.Scan(&job.MessageID, &job.ChatID, &job.Text, &job.Attempts); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan pending embedding: %w", err)
+		}
+		jobs = append(jobs, job)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query pending embeddings: %w", err)
+	}
+
+	if len(jobs) == 0 {
+		return nil, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(jobs)), ",")
+	args := []interface{}{now.Add(lease).UTC()}
+	for _, job := range jobs {
+		args = append(args, job.MessageID)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE pending_embeddings SET next_attempt_at = ? WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+		return nil, fmt.Errorf("failed to lease pending embeddings: %w", err)
+	}
+
+	if err := loadDocuments(ctx, tx, jobs, placeholders, args[1:]); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit lease: %w", err)
+	}
+	return jobs, nil
+}
+
+// CompleteEmbeddingJob stores the embedding of a claimed job, made with the
+// given model, and removes it from the queue. The embedding replaces the
+// message's vector if model serves the chat's searches (a chat without
+// vectors adopts it) and is staged for a model migration otherwise. Chunks
+// of a long message replace its chunks from model and get their IDs set.
+// If the message text changed or its file's text was stored after the job
+// was claimed the embedding is discarded and the job is made due again.
+// Returns true if the new vectors serve searches right away.
+func (db *DB) CompleteEmbeddingJob(ctx context.Context, job EmbeddingJob, embedding []float64, chunks []MessageChunk, model string, now time.Time) (bool, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, embedding_model) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET embedding_model = COALESCE(embedding_model, excluded.embedding_model)
+	`, job.ChatID, model)
+	if err != nil {
+		return false, fmt.Errorf("failed to read chat embedding model: %w", err)
+	}
+
+	var active string
+	if err := tx.QueryRowContext(ctx, `SELECT embedding_model FROM chat_settings WHERE chat_id = ?`, job.ChatID).Scan(&active); err != nil {
+		return false, fmt.Errorf("failed to read chat embedding model: %w", err)
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM messages
+	WHERE id = ? AND text = ? AND (SELECT COUNT(*) FROM message_documents WHERE message_id = messages.id) = ?
+	`, job.MessageID, job.Text, len(job.Document)).Scan(&current)
+	if err != nil {
+		return false, fmt.Errorf("failed to check message text: %w", err)
+	}
+
+	switch {
+	case current == 0:
+		_, err = tx.ExecContext(ctx, `UPDATE pending_embeddings SET next_attempt_at = ? WHERE message_id = ?`, now.UTC(), job.MessageID)
+	case active == model:
+		_, err = tx.ExecContext(ctx, `UPDATE messages SET embedding = ?, embedding_dim = ?, embedding_model = ? WHERE id = ?`,
+			encodeEmbedding(embedding), len(embedding), model, job.MessageID)
+	default:
+		_, err = tx.ExecContext(ctx, `
+		INSERT INTO staged_embeddings (message_id, model, embedding, embedding_dim) VALUES (?, ?, ?, ?)
+		ON CONFLICT(message_id) DO UPDATE SET model = excluded.model, embedding = excluded.embedding, embedding_dim = excluded.embedding_dim
+		`, job.MessageID, model, encodeEmbedding(embedding), len(embedding))
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to save embedding: %w", err)
+	}
+
+	if current > 0 {
+		if err := saveChunks(ctx, tx, job.MessageID, job.ChatID, model, chunks); err != nil {
+			return false, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pending_embeddings WHERE message_id = ?`, job.MessageID); err != nil {
+			return false, fmt.Errorf("failed to update pending embedding: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit embedding: %w", err)
+	}
+	return current > 0 && active == model, nil
+}
+
+// RetryEmbeddingJob records a failed attempt and schedules the next one
+func (db *DB) RetryEmbeddingJob(ctx context.Context, messageID int64, nextAttempt time.Time, lastError string) error {
+	_, err := db.conn.ExecContext(ctx, `
+	UPDATE pending_embeddings SET attempts = attempts + 1, next_attempt_at = ?, last_error = ?
+	WHERE message_id = ?
+	`, nextAttempt.UTC(), lastError, messageID)
+	if err != nil {
+		return fmt.Errorf("failed to reschedule embedding: %w", err)
+	}
+	return nil
+}
+
+// DeferEmbeddingJob makes a claimed job due again at nextAttempt without
+// counting an attempt
+func (db *DB) DeferEmbeddingJob(ctx context.Context, messageID int64, nextAttempt time.Time) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE pending_embeddings SET next_attempt_at = ? WHERE message_id = ?`, nextAttempt.UTC(), messageID)
+	if err != nil {
+		return fmt.Errorf("failed to defer embedding: %w", err)
+	}
+	return nil
+}
+
+// DropEmbeddingJob removes a job from the queue, leaving its message
+// without an embedding
+func (db *DB) DropEmbeddingJob(ctx context.Context, messageID int64) error {
+	if _, err := db.conn.ExecContext(ctx, `DELETE FROM pending_embeddings WHERE message_id = ?`, messageID); err != nil {
+		return fmt.Errorf("failed to drop pending embedding: %w", err)
+	}
+	return nil
+}
+
+// PendingEmbeddingCount returns the number of queued embedding jobs
+func (db *DB) PendingEmbeddingCount(ctx context.Context) (int, error) {
+	var count int
+	err := db.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM pending_embeddings`).Scan(&count)
+	return count, err
+}
+
+// QueueMissingEmbeddings queues the messages of a chat that have no
+// embedding and no pending job, e.g. because their job gave up while the
+// embedding service was down. Returns the number of queued messages.
+func (db *DB) QueueMissingEmbeddings(ctx context.Context, chatID int64, now time.Time) (int, error) {
+	result, err := db.conn.ExecContext(ctx, `
+	INSERT INTO pending_embeddings (message_id, next_attempt_at)
+	SELECT id, ? FROM messages
+	WHERE chat_id = ? AND embedding_dim = 0
+	ON CONFLICT(message_id) DO NOTHING
+	`, now.UTC(), chatID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue missing embeddings: %w", err)
+	}
+
+	queued, _ := result.RowsAffected()
+	return int(queued), nil
+}
+
+// RequeueEmbeddings queues the messages of a chat for embedding right away,
+// only those without an embedding or, if onlyMissing is false, all of them.
+// Jobs that are already queued restart their attempts. Returns the number
+// of queued messages.
+func (db *DB) RequeueEmbeddings(ctx context.Context, chatID int64, onlyMissing bool, now time.Time) (int, error) {
+	query := `
+	INSERT INTO pending_embeddings (message_id, next_attempt_at)
+	SELECT id, ? FROM messages
+	WHERE chat_id = ?`
+	if onlyMissing {
+		query += ` AND embedding_dim = 0`
+	}
+	query += `
+	ON CONFLICT(message_id) DO UPDATE SET attempts = 0, next_attempt_at = excluded.next_attempt_at, last_error = ''
+	`
+
+	result, err := db.conn.ExecContext(ctx, query, now.UTC(), chatID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue embeddings: %w", err)
+	}
+
+	queued, _ := result.RowsAffected()
+	return int(queued), nil
+}
+
+// ChatEmbeddingBacklog returns how many messages of a chat are queued for
+// embedding and how many of those have already failed at least once
+func (db *DB) ChatEmbeddingBacklog(ctx context.Context, chatID int64) (pending, retrying int, err error) {
+	err = db.conn.QueryRowContext(ctx, `
+	SELECT COUNT(*), COALESCE(SUM(p.attempts > 0), 0)
+	FROM pending_embeddings p
+	JOIN messages m ON m.id = p.message_id
+	WHERE m.chat_id = ?
+	`, chatID).Scan(&pending, &retrying)
+	return pending, retrying, err
+}
@@ -0,0 +1,201 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEmbeddingQueue(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	first, err := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 1, Text: "first message", Timestamp: now, Embedding: []float64{9}}, now)
+	if err != nil {
+		t.Fatalf("SaveMessageForEmbedding failed: %v", err)
+	}
+	second, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, TelegramMessageID: 2, UserID: 1, Text: "second message", Timestamp: now}, now)
+	third, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 2, TelegramMessageID: 1, UserID: 1, Text: "third message", Timestamp: now}, now)
+
+	if count, _ := db.GetStatsWithEmbeddings(ctx, 1); count != 0 {
+		t.Errorf("Expected queued messages to have no embedding yet, got %d", count)
+	}
+	if pending, _ := db.PendingEmbeddingCount(ctx); pending != 3 {
+		t.Errorf("Expected 3 pending jobs, got %d", pending)
+	}
+
+	// Jobs are handed out oldest first and leased
+	jobs, err := db.ClaimEmbeddingJobs(ctx, 2, now, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimEmbeddingJobs failed: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].MessageID != first || jobs[1].MessageID != second || jobs[0].Text != "first message" {
+		t.Fatalf("Expected the two oldest jobs, got %+v", jobs)
+	}
+
+	leased, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(leased) != 1 || leased[0].MessageID != third {
+		t.Errorf("Expected leased jobs to be skipped, got %+v", leased)
+	}
+
+	// A completed job stores the embedding and leaves the queue
+	ok, err := db.CompleteEmbeddingJob(ctx, jobs[0], []float64{1, 0}, nil, "test-model", now)
+	if err != nil || !ok {
+		t.Fatalf("CompleteEmbeddingJob failed: %v, %v", ok, err)
+	}
+	if count, _ := db.GetStatsWithEmbeddings(ctx, 1); count != 1 {
+		t.Errorf("Expected 1 embedded message, got %d", count)
+	}
+
+	// An embedding of outdated text is discarded and the job made due again
+	db.UpdateMessageText(ctx, second, "second message, edited", nil, "", now)
+	if ok, _ := db.CompleteEmbeddingJob(ctx, jobs[1], []float64{0, 1}, nil, "test-model", now); ok {
+		t.Error("Expected embedding of outdated text to be discarded")
+	}
+	retry, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(retry) != 1 || retry[0].MessageID != second || retry[0].Text != "second message, edited" {
+		t.Errorf("Expected the edited message to be due again, got %+v", retry)
+	}
+
+	// Failed attempts are counted and delayed
+	if err := db.RetryEmbeddingJob(ctx, second, now.Add(time.Hour), "connection refused"); err != nil {
+		t.Fatalf("RetryEmbeddingJob failed: %v", err)
+	}
+	if due, _ := db.ClaimEmbeddingJobs(ctx, 10, now.Add(2*time.Minute), time.Minute); len(due) != 1 || due[0].MessageID != third {
+		t.Errorf("Expected only the expired lease to be due, got %+v", due)
+	}
+	later, _ := db.ClaimEmbeddingJobs(ctx, 10, now.Add(2*time.Hour), time.Minute)
+	if len(later) != 2 || later[0].MessageID != second || later[0].Attempts != 1 {
+		t.Errorf("Expected the retried job with 1 attempt, got %+v", later)
+	}
+
+	// Requeueing resets attempts; deleting a message drops its job
+	db.QueueEmbeddings(ctx, []int64{second}, now)
+	db.DeleteMessagesByIDs(ctx, []int64{third})
+	due, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(due) != 1 || due[0].MessageID != second || due[0].Attempts != 0 {
+		t.Errorf("Expected only the requeued job, got %+v", due)
+	}
+
+	db.DropEmbeddingJob(ctx, second)
+	if pending, _ := db.PendingEmbeddingCount(ctx); pending != 0 {
+		t.Errorf("Expected empty queue, got %d", pending)
+	}
+}
+
+func TestRequeueMissingEmbeddings(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	embedded, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 1, Text: "embedded", Timestamp: now, Embedding: []float64{1, 0}})
+	missing, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 2, UserID: 1, Text: "missing", Timestamp: now})
+	queued, _ := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, TelegramMessageID: 3, UserID: 1, Text: "queued", Timestamp: now}, now)
+	db.SaveMessage(ctx, Message{ChatID: 2, TelegramMessageID: 1, UserID: 1, Text: "other chat", Timestamp: now})
+	db.RetryEmbeddingJob(ctx, queued, now.Add(time.Hour), "timeout")
+
+	// The reconciler only adds messages that have no job yet
+	count, err := db.QueueMissingEmbeddings(ctx, 1, now)
+	if err != nil {
+		t.Fatalf("QueueMissingEmbeddings failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 newly queued message, got %d", count)
+	}
+	due, _ := db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(due) != 1 || due[0].MessageID != missing {
+		t.Errorf("Expected the retried job to keep its backoff, got %+v", due)
+	}
+
+	pending, retrying, err := db.ChatEmbeddingBacklog(ctx, 1)
+	if err != nil {
+		t.Fatalf("ChatEmbeddingBacklog failed: %v", err)
+	}
+	if pending != 2 || retrying != 1 {
+		t.Errorf("Expected 2 pending and 1 retrying, got %d and %d", pending, retrying)
+	}
+
+	// /reindex makes missing messages due again right away
+	count, _ = db.RequeueEmbeddings(ctx, 1, true, now)
+	if count != 2 {
+		t.Errorf("Expected 2 requeued messages, got %d", count)
+	}
+	due, _ = db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(due) != 2 || due[1].MessageID != queued || due[1].Attempts != 0 {
+		t.Errorf("Expected both missing messages with reset attempts, got %+v", due)
+	}
+
+	// /reindex all also re-embeds messages that already have an embedding
+	count, _ = db.RequeueEmbeddings(ctx, 1, false, now)
+	if count != 3 {
+		t.Errorf("Expected 3 requeued messages, got %d", count)
+	}
+	due, _ = db.ClaimEmbeddingJobs(ctx, 10, now, time.Minute)
+	if len(due) != 3 || due[0].MessageID != embedded {
+		t.Errorf("Expected every message of the chat, got %+v", due)
+	}
+}
+
+func TestConcurrentEmbeddingJobs(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	const messages = 200
+	now := time.Now()
+	for i := 0; i < messages; i++ {
+		_, err := db.SaveMessageForEmbedding(ctx, Message{ChatID: 1, TelegramMessageID: i + 1, UserID: 1, Text: fmt.Sprintf("message %d", i), Timestamp: now}, now)
+		if err != nil {
+			t.Fatalf("SaveMessageForEmbedding failed: %v", err)
+		}
+	}
+
+	// Workers claim and complete jobs while new messages keep arriving, the
+	// way the queue runs next to the update handlers
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				jobs, err := db.ClaimEmbeddingJobs(ctx, 5, now, time.Minute)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if len(jobs) == 0 {
+					return
+				}
+				for _, job := range jobs {
+					if _, err := db.CompleteEmbeddingJob(ctx, job, []float64{1, 0}, nil, "model", now); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			_, err := db.SaveMessageForEmbedding(ctx, Message{ChatID: 2, TelegramMessageID: i + 1, UserID: 1, Text: "late message", Timestamp: now}, now.Add(time.Hour))
+			if err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("Concurrent queue access failed: %v", err)
+	}
+	if count, _ := db.GetStatsWithEmbeddings(ctx, 1); count != messages {
+		t.Errorf("Expected %d embedded messages, got %d", messages, count)
+	}
+}
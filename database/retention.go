@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// deleteBatchSize bounds the number of IDs bound into a single DELETE
+const deleteBatchSize = 500
+
+// DeleteMessages removes the messages of a chat matching the filter along
+// with their edit history, and returns the IDs of the deleted rows. An empty
+// filter is rejected so a chat cannot be wiped by accident.
+func (db *DB) DeleteMessages(ctx context.Context, chatID int64, filter MessageFilter) ([]int64, error) {
+	if filter.IsEmpty() {
+		return nil, fmt.Errorf("refusing to delete messages without a filter")
+	}
+
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	where, args := filter.where("")
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM messages WHERE chat_id = ? AND `+where, append([]interface{}{chatID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages to delete: %w", err)
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan message ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query messages to delete: %w", err)
+	}
+
+	keys, err := deleteMessageIDs(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit deletion: %w", err)
+	}
+	db.forgetCachedEmbeddings(keys)
+	return ids, nil
+}
+
+// DeleteMessagesByIDs removes messages and their edit history by row ID
+func (db *DB) DeleteMessagesByIDs(ctx context.Context, ids []int64) error {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	keys, err := deleteMessageIDs(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit deletion: %w", err)
+	}
+	db.forgetCachedEmbeddings(keys)
+	return nil
+}
+
+// deleteMessageIDs deletes messages, their edits, chunks, file text, queued
+// embedding jobs, staged vectors and conversation windows in batches, along
+// with the cached embeddings of texts nothing left holds. It returns the
+// keys of the deleted cache entries.
+func deleteMessageIDs(ctx context.Context, tx *sql.Tx, ids []int64) ([]string, error) {
+	texts := make(map[string]bool)
+	for start := 0; start < len(ids); start += deleteBatchSize {
+		batch := ids[start:min(start+deleteBatchSize, len(ids))]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		// Read before the windows holding the messages are invalidated
+		if err := collectEmbeddedTexts(ctx, tx, placeholders, args, texts); err != nil {
+			return nil, err
+		}
+		if err := invalidateConversations(ctx, tx, placeholders, args); err != nil {
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_edits WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete edit history: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_chunks WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete message chunks: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM message_documents WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete document text: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM pending_embeddings WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete pending embeddings: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM staged_embeddings WHERE message_id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete staged embeddings: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `DELETE FROM messages WHERE id IN (`+placeholders+`)`, args...); err != nil {
+			return nil, fmt.Errorf("failed to delete messages: %w", err)
+		}
+	}
+	return deleteCachedEmbeddings(ctx, tx, texts)
+}
+
+// GetRetentionDays returns the retention window configured for a chat. ok
+// is false when the chat has no override and the global default applies.
+func (db *DB) GetRetentionDays(ctx context.Context, chatID int64) (days int, ok bool, err error) {
+	var value sql.NullInt64
+	err = db.conn.QueryRowContext(ctx, `SELECT retention_days FROM chat_settings WHERE chat_id = ?`, chatID).Scan(&value)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read retention setting: %w", err)
+	}
+	return int(value.Int64), value.Valid, nil
+}
+
+// SetRetentionDays overrides the retention window of a chat; 0 keeps its
+// messages forever
+func (db *DB) SetRetentionDays(ctx context.Context, chatID int64, days int) error {
+	_, err := db.conn.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, retention_days) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET retention_days = excluded.retention_days
+	`, chatID, days)
+	if err != nil {
+		return fmt.Errorf("failed to save retention setting: %w", err)
+	}
+	return nil
+}
+
+// ClearRetentionDays removes a chat's override so the global default applies
+func (db *DB) ClearRetentionDays(ctx context.Context, chatID int64) error {
+	if _, err := db.conn.ExecContext(ctx, `UPDATE chat_settings SET retention_days = NULL WHERE chat_id = ?`, chatID); err != nil {
+		return fmt.Errorf("failed to clear retention setting: %w", err)
+	}
+	return nil
+}
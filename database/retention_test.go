@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDeleteMessages(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	oldID, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 1, Username: "alice", Text: "old deploy notes", Timestamp: now.AddDate(0, 0, -40), Embedding: []float64{1, 0}})
+	aliceID, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 2, UserID: 1, Username: "Alice", Text: "recent deploy notes", Timestamp: now, Embedding: []float64{0, 1}})
+	bobID, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 3, UserID: 2, Username: "bob", Text: "bob was here", Timestamp: now})
+	otherChatID, _ := db.SaveMessage(ctx, Message{ChatID: 2, TelegramMessageID: 1, UserID: 1, Username: "alice", Text: "other chat", Timestamp: now.AddDate(0, 0, -40)})
+
+	if err := db.UpdateMessageText(ctx, aliceID, "recent deploy notes v2", []float64{0, 1}, "", now); err != nil {
+		t.Fatalf("UpdateMessageText failed: %v", err)
+	}
+
+	if _, err := db.DeleteMessages(ctx, 1, MessageFilter{}); err == nil {
+		t.Error("Expected empty filter to be rejected")
+	}
+
+	// Purge by age only touches the given chat
+	deleted, err := db.DeleteMessages(ctx, 1, MessageFilter{Before: now.AddDate(0, 0, -30)})
+	if err != nil {
+		t.Fatalf("DeleteMessages failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != oldID {
+		t.Errorf("Expected message %d deleted, got %v", oldID, deleted)
+	}
+
+	// Purge by user removes the edit history too
+	deleted, err = db.DeleteMessages(ctx, 1, MessageFilter{Usernames: []string{"alice"}})
+	if err != nil {
+		t.Fatalf("DeleteMessages failed: %v", err)
+	}
+	if len(deleted) != 1 || deleted[0] != aliceID {
+		t.Errorf("Expected message %d deleted, got %v", aliceID, deleted)
+	}
+	if edits, _ := db.FilterEditsWithEmbeddings(ctx, 1, "", MessageFilter{}); len(edits) != 0 {
+		t.Errorf("Expected edit history to be deleted, got %+v", edits)
+	}
+	var orphanEdits int
+	db.conn.QueryRow(`SELECT COUNT(*) FROM message_edits`).Scan(&orphanEdits)
+	if orphanEdits != 0 {
+		t.Errorf("Expected no edit rows left, got %d", orphanEdits)
+	}
+
+	if err := db.DeleteMessagesByIDs(ctx, []int64{bobID}); err != nil {
+		t.Fatalf("DeleteMessagesByIDs failed: %v", err)
+	}
+	if count, _ := db.GetStats(ctx, 1); count != 0 {
+		t.Errorf("Expected chat 1 to be empty, got %d messages", count)
+	}
+
+	remaining, _ := db.GetMessages(ctx, 2)
+	if len(remaining) != 1 || remaining[0].ID != otherChatID {
+		t.Errorf("Expected other chat untouched, got %+v", remaining)
+	}
+
+	// Deleted messages no longer match keyword searches
+	matches, err := db.KeywordSearch(ctx, 1, "deploy", MessageFilter{}, 10)
+	if err != nil {
+		t.Fatalf("KeywordSearch failed: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("Expected no keyword matches after deletion, got %+v", matches)
+	}
+}
+
+func TestRetentionDaysSetting(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	if _, ok, err := db.GetRetentionDays(ctx, 1); ok || err != nil {
+		t.Errorf("Expected no override, got ok=%v err=%v", ok, err)
+	}
+
+	if err := db.SetRetentionDays(ctx, 1, 30); err != nil {
+		t.Fatalf("SetRetentionDays failed: %v", err)
+	}
+	if err := db.SetRetentionDays(ctx, 1, 0); err != nil {
+		t.Fatalf("SetRetentionDays failed: %v", err)
+	}
+	if days, ok, _ := db.GetRetentionDays(ctx, 1); !ok || days != 0 {
+		t.Errorf("Expected override of 0 days, got %d (ok=%v)", days, ok)
+	}
+
+	if err := db.ClearRetentionDays(ctx, 1); err != nil {
+		t.Fatalf("ClearRetentionDays failed: %v", err)
+	}
+	if _, ok, _ := db.GetRetentionDays(ctx, 1); ok {
+		t.Error("Expected override to be cleared")
+	}
+}
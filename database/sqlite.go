@@ -1,20 +1,40 @@
 package database
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type DB struct {
-	conn *sql.DB
+	conn         *sql.DB
+	ftsAvailable bool // messages_fts is available and kept in sync
+
+	cacheDeleted func(keys []string) // told which cached embeddings were deleted with their messages
 }
 
+// messageColumns lists the columns read by scanMessages, in order
+const messageColumns = `id, chat_id, telegram_message_id, thread_id, reply_to_message_id, user_id, username, text, content_type, forward_origin, timestamp, embedding, embedding_dim, embedding_model`
+
+// busyTimeout is how long a connection waits for another one's write lock,
+// in milliseconds
+const busyTimeout = 5000
+
 func NewDB(dbPath string) (*DB, error) {
-	conn, err := sql.Open("sqlite3", dbPath)
+	// The embedding workers, indexers and update handlers write concurrently.
+	// Transactions take the write lock up front so two of them never both
+	// read and then fail to upgrade with SQLITE_BUSY, which no timeout helps.
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
+	}
+	dsn := fmt.Sprintf("%s%s_txlock=immediate&_busy_timeout=%d", dbPath, separator, busyTimeout)
+
+	conn, err := sql.Open("sqlite3", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -24,9 +44,23 @@ func NewDB(dbPath string) (*DB, error) {
 		return nil, fmt.Errorf("failed to initialize tables: %w", err)
 	}
 
+	if err := db.detectFTS(); err != nil {
+		return nil, fmt.Errorf("failed to detect full-text search support: %w", err)
+	}
+
+	if err := db.migrate(); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	if err := db.initFTS(); err != nil {
+		return nil, fmt.Errorf("failed to initialize full-text search: %w", err)
+	}
+
 	return db, nil
 }
 
+// initTables creates the original (version 0) schema. Later changes are
+// applied on top of it by migrate.
 func (db *DB) initTables() error {
 	query := `
 	CREATE TABLE IF NOT EXISTS messages (
@@ -47,69 +81,57 @@ func (db *DB) initTables() error {
 	return err
 }
 
-func (db *DB) SaveMessage(msg Message) error {
-	// Convert embedding to JSON string
-	var embeddingJSON string
-	if msg.Embedding != nil {
-		embeddingBytes, err := json.Marshal(msg.Embedding)
-		if err != nil {
-			return fmt.Errorf("failed to marshal embedding: %w", err)
-		}
-		embeddingJSON = string(embeddingBytes)
+// insertMessageQuery inserts a message with the values of messageArgs
+const insertMessageQuery = `
+	INSERT INTO messages (chat_id, telegram_message_id, thread_id, reply_to_message_id, user_id, username, text, content_type, forward_origin,
+		timestamp, embedding, embedding_dim, embedding_model)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+
+func messageArgs(msg Message) []interface{} {
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = ContentText
 	}
+	// Timestamps are stored in UTC so they compare and sort as text
+	return []interface{}{msg.ChatID, msg.TelegramMessageID, msg.ThreadID, msg.ReplyToMessageID, msg.UserID, msg.Username, msg.Text, contentType, msg.ForwardOrigin,
+		msg.Timestamp.UTC(), encodeEmbedding(msg.Embedding), len(msg.Embedding), msg.EmbeddingModel}
+}
 
-	query := `
-	INSERT INTO messages (chat_id, user_id, username, text, timestamp, embedding)
-	VALUES (?, ?, ?, ?, ?, ?)
-	`
+// SaveMessage inserts a message and returns its row ID
+func (db *DB) SaveMessage(ctx context.Context, msg Message) (int64, error) {
+	result, err := db.conn.ExecContext(ctx, insertMessageQuery, messageArgs(msg)...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save message: %w", err)
+	}
 
-	_, err := db.conn.Exec(query, msg.ChatID, msg.UserID, msg.Username, msg.Text, msg.Timestamp, embeddingJSON)
+	id, err := result.LastInsertId()
 	if err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+		return 0, fmt.Errorf("failed to get message ID: %w", err)
 	}
 
 	log.Printf("Saved message from %s in chat %d: %s", msg.Username, msg.ChatID, msg.Text[:min(50, len(msg.Text))])
-	return nil
+	return id, nil
 }
 
-func (db *DB) GetMessages(chatID int64) ([]Message, error) {
+func (db *DB) GetMessages(ctx context.Context, chatID int64) ([]Message, error) {
 	query := `
-	SELECT id, chat_id, user_id, username, text, timestamp, embedding
+	SELECT ` + messageColumns + `
 	FROM messages
 	WHERE chat_id = ?
 	ORDER BY timestamp DESC
 	`
 
-	rows, err := db.conn.Query(query, chatID)
+	rows, err := db.conn.QueryContext(ctx, query, chatID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		var embeddingJSON sql.NullString
-
-		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Username, &msg.Text, &msg.Timestamp, &embeddingJSON)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-
-		// Parse embedding JSON
-		if embeddingJSON.Valid && embeddingJSON.String != "" {
-			if err := json.Unmarshal([]byte(embeddingJSON.String), &msg.Embedding); err != nil {
-				log.Printf("Failed to unmarshal embedding for message %d: %v", msg.ID, err)
-			}
-		}
-
-		messages = append(messages, msg)
-	}
-
-	return messages, nil
+	return scanMessages(rows)
 }
 
-func (db *DB) GetMessagesByIDs(ids []int64) ([]Message, error) {
+func (db *DB) GetMessagesByIDs(ctx context.Context, ids []int64) ([]Message, error) {
 	if len(ids) == 0 {
 		return []Message{}, nil
 	}
@@ -126,93 +148,154 @@ func (db *DB) GetMessagesByIDs(ids []int64) ([]Message, error) {
 	}
 
 	query := fmt.Sprintf(`
-	SELECT id, chat_id, user_id, username, text, timestamp, embedding
+	SELECT %s
 	FROM messages
 	WHERE id IN (%s)
 	ORDER BY timestamp DESC
-	`, queryPlaceholders)
+	`, messageColumns, queryPlaceholders)
 
-	rows, err := db.conn.Query(query, placeholders...)
+	rows, err := db.conn.QueryContext(ctx, query, placeholders...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages by IDs: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []Message
-	for rows.Next() {
-		var msg Message
-		var embeddingJSON sql.NullString
-
-		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Username, &msg.Text, &msg.Timestamp, &embeddingJSON)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan message: %w", err)
-		}
-
-		// Parse embedding JSON
-		if embeddingJSON.Valid && embeddingJSON.String != "" {
-			if err := json.Unmarshal([]byte(embeddingJSON.String), &msg.Embedding); err != nil {
-				log.Printf("Failed to unmarshal embedding for message %d: %v", msg.ID, err)
-			}
-		}
-
-		messages = append(messages, msg)
-	}
-
-	return messages, nil
+	return scanMessages(rows)
 }
 
 func (db *DB) Close() error {
 	return db.conn.Close()
 }
 
-func (db *DB) GetStats(chatID int64) (int, error) {
+func (db *DB) GetStats(ctx context.Context, chatID int64) (int, error) {
 	query := `SELECT COUNT(*) FROM messages WHERE chat_id = ?`
 	var count int
-	err := db.conn.QueryRow(query, chatID).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query, chatID).Scan(&count)
 	return count, err
 }
 
-func (db *DB) GetStatsWithEmbeddings(chatID int64) (int, error) {
-	query := `SELECT COUNT(*) FROM messages WHERE chat_id = ? AND embedding IS NOT NULL AND embedding != ''`
+func (db *DB) GetStatsWithEmbeddings(ctx context.Context, chatID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM messages WHERE chat_id = ? AND embedding_dim > 0`
 	var count int
-	err := db.conn.QueryRow(query, chatID).Scan(&count)
+	err := db.conn.QueryRowContext(ctx, query, chatID).Scan(&count)
 	return count, err
 }
 
-func (db *DB) GetMessagesWithEmbeddings(chatID int64) ([]Message, error) {
+// GetMessagesWithEmbeddings returns the messages of a chat that have an
+// embedding from the given model, newest first
+func (db *DB) GetMessagesWithEmbeddings(ctx context.Context, chatID int64, model string) ([]Message, error) {
 	query := `
-	SELECT id, chat_id, user_id, username, text, timestamp, embedding
+	SELECT ` + messageColumns + `
 	FROM messages
-	WHERE chat_id = ? AND embedding IS NOT NULL AND embedding != ''
+	WHERE chat_id = ? AND embedding_dim > 0 AND embedding_model = ?
 	ORDER BY timestamp DESC
 	`
 
-	rows, err := db.conn.Query(query, chatID)
+	rows, err := db.conn.QueryContext(ctx, query, chatID, model)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query messages with embeddings: %w", err)
 	}
 	defer rows.Close()
 
+	return scanMessages(rows)
+}
+
+// FilterMessagesWithEmbeddings returns the messages of a chat that have an
+// embedding from the given model and match the filter, newest first
+func (db *DB) FilterMessagesWithEmbeddings(ctx context.Context, chatID int64, model string, filter MessageFilter) ([]Message, error) {
+	where, args := filter.where("")
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND embedding_dim > 0 AND embedding_model = ? AND ` + where + `
+	ORDER BY timestamp DESC
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, append([]interface{}{chatID, model}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filtered messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// FilterRecentMessages returns up to limit messages of a chat matching the
+// filter, newest first
+func (db *DB) FilterRecentMessages(ctx context.Context, chatID int64, filter MessageFilter, limit int) ([]Message, error) {
+	where, args := filter.where("")
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND ` + where + `
+	ORDER BY timestamp DESC
+	LIMIT ?
+	`
+
+	args = append([]interface{}{chatID}, args...)
+	rows, err := db.conn.QueryContext(ctx, query, append(args, limit)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query filtered messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetChatIDs returns every chat that has at least one stored message
+func (db *DB) GetChatIDs(ctx context.Context) ([]int64, error) {
+	rows, err := db.conn.QueryContext(ctx, `SELECT DISTINCT chat_id FROM messages`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat IDs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanChatIDs(rows)
+}
+
+// scanChatIDs reads rows selecting a single chat_id column
+func scanChatIDs(rows *sql.Rows) ([]int64, error) {
+	var chatIDs []int64
+	for rows.Next() {
+		var chatID int64
+		if err := rows.Scan(&chatID); err != nil {
+			return nil, fmt.Errorf("failed to scan chat ID: %w", err)
+		}
+		chatIDs = append(chatIDs, chatID)
+	}
+
+	return chatIDs, rows.Err()
+}
+
+// scanMessages reads rows selected with messageColumns
+func scanMessages(rows *sql.Rows) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		var embeddingJSON string
+		var embeddingBlob []byte
+		var embeddingDim int
 
-		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.UserID, &msg.Username, &msg.Text, &msg.Timestamp, &embeddingJSON)
+		err := rows.Scan(&msg.ID, &msg.ChatID, &msg.TelegramMessageID, &msg.ThreadID, &msg.ReplyToMessageID, &msg.UserID, &msg.Username, &msg.Text,
+			&msg.ContentType, &msg.ForwardOrigin, &msg.Timestamp, &embeddingBlob, &embeddingDim, &msg.EmbeddingModel)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-
-		// Parse embedding JSON
-		if err := json.Unmarshal([]byte(embeddingJSON), &msg.Embedding); err != nil {
-			log.Printf("Failed to unmarshal embedding for message %d: %v", msg.ID, err)
-			continue // Skip messages with invalid embeddings
+		msg.Timestamp = msg.Timestamp.Local() // stored in UTC, shown in the server's time zone
+
+		// Decode binary embedding
+		if embeddingDim > 0 {
+			embedding, err := decodeEmbedding(embeddingBlob, embeddingDim)
+			if err != nil {
+				log.Printf("Failed to decode embedding for message %d: %v", msg.ID, err)
+			} else {
+				msg.Embedding = embedding
+			}
 		}
 
 		messages = append(messages, msg)
 	}
 
-	return messages, nil
+	return messages, rows.Err()
 }
 
 func min(a, b int) int {
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// GetMessagesByUser returns every stored message of a user across all
+// chats, oldest first
+func (db *DB) GetMessagesByUser(ctx context.Context, userID int64) ([]Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE user_id = ?
+	ORDER BY chat_id, timestamp
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetEditsByUser returns the previous versions of a user's messages
+func (db *DB) GetEditsByUser(ctx context.Context, userID int64) ([]MessageEdit, error) {
+	query := `
+	SELECT message_edits.id, message_edits.message_id, message_edits.chat_id, message_edits.text,
+		message_edits.embedding, message_edits.embedding_dim, message_edits.embedding_model, message_edits.edited_at
+	FROM message_edits
+	JOIN messages ON messages.id = message_edits.message_id
+	WHERE messages.user_id = ?
+	ORDER BY message_edits.message_id, message_edits.edited_at
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user edits: %w", err)
+	}
+	defer rows.Close()
+
+	var edits []MessageEdit
+	for rows.Next() {
+		var edit MessageEdit
+		var embeddingBlob []byte
+		var embeddingDim int
+		if err := rows.Scan(&edit.ID, &edit.MessageID, &edit.ChatID, &edit.Text, &embeddingBlob, &embeddingDim, &edit.EmbeddingModel, &edit.EditedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan message edit: %w", err)
+		}
+
+		if embeddingDim > 0 {
+			embedding, err := decodeEmbedding(embeddingBlob, embeddingDim)
+			if err != nil {
+				log.Printf("Failed to decode embedding for edit %d: %v", edit.ID, err)
+			} else {
+				edit.Embedding = embedding
+			}
+		}
+
+		edits = append(edits, edit)
+	}
+
+	return edits, rows.Err()
+}
+
+// DeleteMessagesByUser removes every stored message of a user across all
+// chats, along with their edit history and the record of which chats they
+// posted in. It returns the deleted message IDs grouped by chat.
+func (db *DB) DeleteMessagesByUser(ctx context.Context, userID int64) (map[int64][]int64, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, chat_id FROM messages WHERE user_id = ?`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query user messages: %w", err)
+	}
+
+	deleted := make(map[int64][]int64)
+	var ids []int64
+	for rows.Next() {
+		var id, chatID int64
+		if err := rows.Scan(&id, &chatID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan message ID: %w", err)
+		}
+		deleted[chatID] = append(deleted[chatID], id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query user messages: %w", err)
+	}
+
+	keys, err := deleteMessageIDs(ctx, tx, ids)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM chat_members WHERE user_id = ?`, userID); err != nil {
+		return nil, fmt.Errorf("failed to delete chat memberships: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit deletion: %w", err)
+	}
+	db.forgetCachedEmbeddings(keys)
+	return deleted, nil
+}
+
+// RecordAudit appends an entry to the audit log
+func (db *DB) RecordAudit(ctx context.Context, entry AuditEntry) error {
+	_, err := db.conn.ExecContext(ctx, `INSERT INTO audit_log (action, user_id, chat_id, details, created_at) VALUES (?, ?, ?, ?, ?)`,
+		entry.Action, entry.UserID, entry.ChatID, entry.Details, entry.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditLog returns the audit entries of a user, oldest first
+func (db *DB) GetAuditLog(ctx context.Context, userID int64) ([]AuditEntry, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT id, action, user_id, chat_id, details, created_at
+	FROM audit_log
+	WHERE user_id = ?
+	ORDER BY id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		if err := rows.Scan(&entry.ID, &entry.Action, &entry.UserID, &entry.ChatID, &entry.Details, &entry.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestUserDataExportAndErasure(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	first, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 1, UserID: 42, Username: "alice", Text: "hello from chat one", Timestamp: now, Embedding: []float64{1, 0}})
+	db.SaveMessage(ctx, Message{ChatID: 2, TelegramMessageID: 1, UserID: 42, Username: "alice", Text: "hello from chat two", Timestamp: now})
+	other, _ := db.SaveMessage(ctx, Message{ChatID: 1, TelegramMessageID: 2, UserID: 7, Username: "bob", Text: "bob stays", Timestamp: now})
+	db.UpdateMessageText(ctx, first, "hello again from chat one", []float64{0, 1}, "", now)
+
+	messages, err := db.GetMessagesByUser(ctx, 42)
+	if err != nil {
+		t.Fatalf("GetMessagesByUser failed: %v", err)
+	}
+	if len(messages) != 2 || messages[0].ChatID != 1 || messages[1].ChatID != 2 {
+		t.Errorf("Expected messages from both chats, got %+v", messages)
+	}
+
+	edits, err := db.GetEditsByUser(ctx, 42)
+	if err != nil {
+		t.Fatalf("GetEditsByUser failed: %v", err)
+	}
+	if len(edits) != 1 || edits[0].Text != "hello from chat one" {
+		t.Errorf("Expected the earlier version, got %+v", edits)
+	}
+
+	deleted, err := db.DeleteMessagesByUser(ctx, 42)
+	if err != nil {
+		t.Fatalf("DeleteMessagesByUser failed: %v", err)
+	}
+	if len(deleted) != 2 || len(deleted[1]) != 1 || deleted[1][0] != first || len(deleted[2]) != 1 {
+		t.Errorf("Expected one message per chat deleted, got %v", deleted)
+	}
+
+	if messages, _ := db.GetMessagesByUser(ctx, 42); len(messages) != 0 {
+		t.Errorf("Expected no messages left, got %+v", messages)
+	}
+	if edits, _ := db.GetEditsByUser(ctx, 42); len(edits) != 0 {
+		t.Errorf("Expected no edits left, got %+v", edits)
+	}
+	if remaining, _ := db.GetMessagesByIDs(ctx, []int64{other}); len(remaining) != 1 {
+		t.Error("Expected other users' messages to be kept")
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	now := time.Now()
+	db.RecordAudit(ctx, AuditEntry{Action: "export", UserID: 42, ChatID: 1, Details: "2 messages", CreatedAt: now})
+	db.RecordAudit(ctx, AuditEntry{Action: "erase", UserID: 42, ChatID: 1, Details: "2 messages", CreatedAt: now})
+	db.RecordAudit(ctx, AuditEntry{Action: "export", UserID: 7, ChatID: 1, CreatedAt: now})
+
+	entries, err := db.GetAuditLog(ctx, 42)
+	if err != nil {
+		t.Fatalf("GetAuditLog failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != "export" || entries[1].Action != "erase" || entries[1].Details != "2 messages" {
+		t.Errorf("Unexpected audit entries: %+v", entries)
+	}
+}
@@ -0,0 +1,34 @@
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// encodeEmbedding packs a vector as little-endian float32 values.
+// A nil or empty vector is stored as NULL.
+func encodeEmbedding(embedding []float64) []byte {
+	if len(embedding) == 0 {
+		return nil
+	}
+
+	buf := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(float32(v)))
+	}
+	return buf
+}
+
+// decodeEmbedding unpacks a vector written by encodeEmbedding
+func decodeEmbedding(data []byte, dim int) ([]float64, error) {
+	if len(data) != 4*dim {
+		return nil, fmt.Errorf("embedding blob has %d bytes, expected %d for %d dimensions", len(data), 4*dim, dim)
+	}
+
+	embedding := make([]float64, dim)
+	for i := range embedding {
+		embedding[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+	}
+	return embedding, nil
+}
@@ -0,0 +1,354 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// UnwindowedMessages returns up to limit messages of a chat stored after the
+// last message grouped into conversation windows, oldest first
+func (db *DB) UnwindowedMessages(ctx context.Context, chatID int64, limit int) ([]Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND id > COALESCE((SELECT windowed_through FROM chat_settings WHERE chat_id = ?), 0)
+	ORDER BY id
+	LIMIT ?
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, chatID, chatID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query unwindowed messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessagesInRange returns the messages of a chat with row IDs from
+// firstID to lastID, oldest first
+func (db *DB) GetMessagesInRange(ctx context.Context, chatID, firstID, lastID int64) ([]Message, error) {
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND id BETWEEN ? AND ?
+	ORDER BY id
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, chatID, firstID, lastID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// GetMessagesByTelegramIDs returns the stored messages of a chat with the
+// given Telegram message IDs; IDs that were never stored are left out
+func (db *DB) GetMessagesByTelegramIDs(ctx context.Context, chatID int64, telegramIDs []int) ([]Message, error) {
+	if len(telegramIDs) == 0 {
+		return []Message{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(telegramIDs)), ",")
+	args := []interface{}{chatID}
+	for _, id := range telegramIDs {
+		args = append(args, id)
+	}
+
+	query := `
+	SELECT ` + messageColumns + `
+	FROM messages
+	WHERE chat_id = ? AND telegram_message_id IN (` + placeholders + `)
+	`
+
+	rows, err := db.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query messages by Telegram IDs: %w", err)
+	}
+	defer rows.Close()
+
+	return scanMessages(rows)
+}
+
+// StaleConversations returns the conversations of a chat whose windows were
+// dropped because one of their messages was edited or deleted
+func (db *DB) StaleConversations(ctx context.Context, chatID int64) ([]Conversation, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT chat_id, segment_first_id, segment_last_id FROM stale_conversations
+	WHERE chat_id = ?
+	ORDER BY segment_first_id
+	`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stale conversations: %w", err)
+	}
+	defer rows.Close()
+
+	var conversations []Conversation
+	for rows.Next() {
+		var c Conversation
+		if err := rows.Scan(&c.ChatID, &c.FirstID, &c.LastID); err != nil {
+			return nil, fmt.Errorf("failed to scan stale conversation: %w", err)
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// SaveConversationWindows replaces the windows of the conversations that
+// start within span with windows, and records the chat's messages up to
+// through as windowed. The IDs of the new windows are set in place; the IDs
+// of the replaced ones are returned.
+func (db *DB) SaveConversationWindows(ctx context.Context, span Conversation, through int64, windows []ConversationWindow) ([]int64, error) {
+	tx, err := db.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	spanArgs := []interface{}{span.ChatID, span.FirstID, span.LastID}
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM conversation_windows WHERE chat_id = ? AND segment_first_id BETWEEN ? AND ?`, spanArgs...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation windows: %w", err)
+	}
+	var removed []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan window ID: %w", err)
+		}
+		removed = append(removed, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query conversation windows: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+	DELETE FROM conversation_window_messages WHERE window_id IN (
+		SELECT id FROM conversation_windows WHERE chat_id = ? AND segment_first_id BETWEEN ? AND ?
+	)`, spanArgs...); err != nil {
+		return nil, fmt.Errorf("failed to delete window messages: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM conversation_windows WHERE chat_id = ? AND segment_first_id BETWEEN ? AND ?`, spanArgs...); err != nil {
+		return nil, fmt.Errorf("failed to delete conversation windows: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM stale_conversations WHERE chat_id = ? AND segment_first_id BETWEEN ? AND ?`, spanArgs...); err != nil {
+		return nil, fmt.Errorf("failed to clear stale conversations: %w", err)
+	}
+
+	for i, window := range windows {
+		result, err := tx.ExecContext(ctx, `
+		INSERT INTO conversation_windows (chat_id, segment_first_id, segment_last_id, text)
+		VALUES (?, ?, ?, ?)
+		`, span.ChatID, window.SegmentFirstID, window.SegmentLastID, window.Text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save conversation window: %w", err)
+		}
+
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get window ID: %w", err)
+		}
+
+		for position, messageID := range window.MessageIDs {
+			if _, err := tx.ExecContext(ctx, `
+			INSERT OR IGNORE INTO conversation_window_messages (window_id, message_id, position) VALUES (?, ?, ?)
+			`, id, messageID, position); err != nil {
+				return nil, fmt.Errorf("failed to save window messages: %w", err)
+			}
+		}
+		windows[i].ID = id
+	}
+
+	_, err = tx.ExecContext(ctx, `
+	INSERT INTO chat_settings (chat_id, windowed_through) VALUES (?, ?)
+	ON CONFLICT(chat_id) DO UPDATE SET windowed_through = MAX(COALESCE(windowed_through, 0), excluded.windowed_through)
+	`, span.ChatID, through)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save windowing progress: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit conversation windows: %w", err)
+	}
+	return removed, nil
+}
+
+// HasConversationWindows reports whether windows were built for exactly the
+// given conversation, i.e. it has not grown since
+func (db *DB) HasConversationWindows(ctx context.Context, c Conversation) (bool, error) {
+	var count int
+	err := db.conn.QueryRowContext(ctx, `
+	SELECT COUNT(*) FROM conversation_windows WHERE chat_id = ? AND segment_first_id = ? AND segment_last_id = ?
+	`, c.ChatID, c.FirstID, c.LastID).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("failed to query conversation windows: %w", err)
+	}
+	return count > 0, nil
+}
+
+// WindowsToEmbed returns up to limit windows of a chat without a vector from
+// the given model
+func (db *DB) WindowsToEmbed(ctx context.Context, chatID int64, model string, limit int) ([]ConversationWindow, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT id, chat_id, segment_first_id, segment_last_id, text
+	FROM conversation_windows
+	WHERE chat_id = ? AND (embedding_dim = 0 OR embedding_model != ?)
+	ORDER BY id
+	LIMIT ?
+	`, chatID, model, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query windows to embed: %w", err)
+	}
+	defer rows.Close()
+
+	var windows []ConversationWindow
+	for rows.Next() {
+		var w ConversationWindow
+		if err := rows.Scan(&w.ID, &w.ChatID, &w.SegmentFirstID, &w.SegmentLastID, &w.Text); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation window: %w", err)
+		}
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// SaveWindowEmbedding stores the vector of a window, made with model
+func (db *DB) SaveWindowEmbedding(ctx context.Context, windowID int64, embedding []float64, model string) error {
+	_, err := db.conn.ExecContext(ctx, `UPDATE conversation_windows SET embedding = ?, embedding_dim = ?, embedding_model = ? WHERE id = ?`,
+		encodeEmbedding(embedding), len(embedding), model, windowID)
+	if err != nil {
+		return fmt.Errorf("failed to save window embedding: %w", err)
+	}
+	return nil
+}
+
+// GetWindowsWithEmbeddings returns the windows of a chat that have a vector
+// from the given model, without their messages
+func (db *DB) GetWindowsWithEmbeddings(ctx context.Context, chatID int64, model string) ([]ConversationWindow, error) {
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT id, chat_id, segment_first_id, segment_last_id, text, embedding, embedding_dim, embedding_model
+	FROM conversation_windows
+	WHERE chat_id = ? AND embedding_dim > 0 AND embedding_model = ?
+	`, chatID, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation windows: %w", err)
+	}
+	defer rows.Close()
+
+	return scanWindows(rows)
+}
+
+// GetWindowsByIDs returns windows along with the IDs of their messages
+func (db *DB) GetWindowsByIDs(ctx context.Context, ids []int64) ([]ConversationWindow, error) {
+	if len(ids) == 0 {
+		return []ConversationWindow{}, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+
+	rows, err := db.conn.QueryContext(ctx, `
+	SELECT id, chat_id, segment_first_id, segment_last_id, text, embedding, embedding_dim, embedding_model
+	FROM conversation_windows
+	WHERE id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query conversation windows: %w", err)
+	}
+	windows, err := scanWindows(rows)
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err = db.conn.QueryContext(ctx, `
+	SELECT window_id, message_id FROM conversation_window_messages
+	WHERE window_id IN (`+placeholders+`)
+	ORDER BY window_id, position
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query window messages: %w", err)
+	}
+	defer rows.Close()
+
+	messageIDs := make(map[int64][]int64, len(windows))
+	for rows.Next() {
+		var windowID, messageID int64
+		if err := rows.Scan(&windowID, &messageID); err != nil {
+			return nil, fmt.Errorf("failed to scan window message: %w", err)
+		}
+		messageIDs[windowID] = append(messageIDs[windowID], messageID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to query window messages: %w", err)
+	}
+
+	for i := range windows {
+		windows[i].MessageIDs = messageIDs[windows[i].ID]
+	}
+	return windows, nil
+}
+
+// scanWindows reads conversation window rows without their messages
+func scanWindows(rows *sql.Rows) ([]ConversationWindow, error) {
+	var windows []ConversationWindow
+	for rows.Next() {
+		var w ConversationWindow
+		var embeddingBlob []byte
+		var embeddingDim int
+		if err := rows.Scan(&w.ID, &w.ChatID, &w.SegmentFirstID, &w.SegmentLastID, &w.Text, &embeddingBlob, &embeddingDim, &w.EmbeddingModel); err != nil {
+			return nil, fmt.Errorf("failed to scan conversation window: %w", err)
+		}
+
+		if embeddingDim > 0 {
+			embedding, err := decodeEmbedding(embeddingBlob, embeddingDim)
+			if err != nil {
+				log.Printf("Failed to decode embedding for window %d: %v", w.ID, err)
+			} else {
+				w.Embedding = embedding
+			}
+		}
+
+		windows = append(windows, w)
+	}
+	return windows, rows.Err()
+}
+
+// staleWindowsQuery selects the windows of conversations marked stale
+const staleWindowsQuery = `
+	SELECT w.id FROM conversation_windows w
+	JOIN stale_conversations s ON s.chat_id = w.chat_id AND s.segment_first_id = w.segment_first_id`
+
+// invalidateConversations marks the conversations containing the given
+// messages as stale and drops their windows, so no window keeps the text of
+// an edited or deleted message. placeholders binds args, the message IDs.
+func invalidateConversations(ctx context.Context, tx *sql.Tx, placeholders string, args []interface{}) error {
+	_, err := tx.ExecContext(ctx, `
+	INSERT OR IGNORE INTO stale_conversations (chat_id, segment_first_id, segment_last_id)
+	SELECT DISTINCT w.chat_id, w.segment_first_id, w.segment_last_id
+	FROM conversation_window_messages l
+	JOIN conversation_windows w ON w.id = l.window_id
+	WHERE l.message_id IN (`+placeholders+`)
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to mark conversations stale: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM conversation_window_messages WHERE window_id IN (`+staleWindowsQuery+`)`); err != nil {
+		return fmt.Errorf("failed to delete window messages: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM conversation_windows WHERE id IN (`+staleWindowsQuery+`)`); err != nil {
+		return fmt.Errorf("failed to delete conversation windows: %w", err)
+	}
+	return nil
+}
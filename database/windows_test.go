@@ -0,0 +1,150 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// saveTestMessages stores one message per text in chat 1, returning their IDs
+func saveTestMessages(t *testing.T, db *DB, texts ...string) []int64 {
+	t.Helper()
+
+	ids := make([]int64, len(texts))
+	for i, text := range texts {
+		id, err := db.SaveMessage(context.Background(), Message{ChatID: 1, TelegramMessageID: i + 1, UserID: 1, Username: "alice", Text: text, Timestamp: time.Now()})
+		if err != nil {
+			t.Fatalf("SaveMessage failed: %v", err)
+		}
+		ids[i] = id
+	}
+	return ids
+}
+
+func TestSaveConversationWindows(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	ids := saveTestMessages(t, db, "deploy tonight?", "yes at 9", "rollback plan ready", "lunch?")
+
+	unwindowed, err := db.UnwindowedMessages(ctx, 1, 10)
+	if err != nil {
+		t.Fatalf("UnwindowedMessages failed: %v", err)
+	}
+	if len(unwindowed) != 4 {
+		t.Fatalf("Expected 4 unwindowed messages, got %d", len(unwindowed))
+	}
+
+	span := Conversation{ChatID: 1, FirstID: ids[0], LastID: ids[2]}
+	windows := []ConversationWindow{
+		{SegmentFirstID: ids[0], SegmentLastID: ids[2], MessageIDs: []int64{ids[0], ids[1]}, Text: "alice: deploy tonight?\nalice: yes at 9"},
+		{SegmentFirstID: ids[0], SegmentLastID: ids[2], MessageIDs: []int64{ids[1], ids[2]}, Text: "alice: yes at 9\nalice: rollback plan ready"},
+	}
+	removed, err := db.SaveConversationWindows(ctx, span, ids[2], windows)
+	if err != nil {
+		t.Fatalf("SaveConversationWindows failed: %v", err)
+	}
+	if len(removed) != 0 || windows[0].ID == 0 || windows[1].ID == 0 {
+		t.Fatalf("Expected new windows with IDs and none removed, got %+v (removed %v)", windows, removed)
+	}
+
+	saved, err := db.GetWindowsByIDs(ctx, []int64{windows[0].ID, windows[1].ID})
+	if err != nil {
+		t.Fatalf("GetWindowsByIDs failed: %v", err)
+	}
+	for _, window := range saved {
+		if window.ID == windows[1].ID && (len(window.MessageIDs) != 2 || window.MessageIDs[0] != ids[1] || window.MessageIDs[1] != ids[2]) {
+			t.Errorf("Expected the window's messages in order, got %v", window.MessageIDs)
+		}
+	}
+	if len(saved) != 2 {
+		t.Errorf("Expected 2 saved windows, got %+v", saved)
+	}
+
+	unwindowed, _ = db.UnwindowedMessages(ctx, 1, 10)
+	if len(unwindowed) != 1 || unwindowed[0].ID != ids[3] {
+		t.Errorf("Expected only the last message left to window, got %+v", unwindowed)
+	}
+
+	// The conversation grew: its windows are replaced by ones for the new span
+	grown := Conversation{ChatID: 1, FirstID: ids[0], LastID: ids[3]}
+	rewindowed := []ConversationWindow{
+		{SegmentFirstID: ids[0], SegmentLastID: ids[3], MessageIDs: ids, Text: "alice: deploy tonight?\nalice: lunch?"},
+	}
+	removed, err = db.SaveConversationWindows(ctx, grown, ids[3], rewindowed)
+	if err != nil {
+		t.Fatalf("SaveConversationWindows failed: %v", err)
+	}
+	if len(removed) != 2 {
+		t.Errorf("Expected both old windows to be replaced, got %v", removed)
+	}
+	if old, _ := db.GetWindowsByIDs(ctx, removed); len(old) != 0 {
+		t.Errorf("Expected the old windows to be gone, got %+v", old)
+	}
+	if has, _ := db.HasConversationWindows(ctx, span); has {
+		t.Error("Expected no windows for the old span")
+	}
+	if has, _ := db.HasConversationWindows(ctx, grown); !has {
+		t.Error("Expected windows for the grown span")
+	}
+
+	// Progress never moves back, e.g. when a stale conversation is rebuilt
+	if _, err := db.SaveConversationWindows(ctx, grown, ids[0], rewindowed); err != nil {
+		t.Fatalf("SaveConversationWindows failed: %v", err)
+	}
+	if unwindowed, _ = db.UnwindowedMessages(ctx, 1, 10); len(unwindowed) != 0 {
+		t.Errorf("Expected every message to stay windowed, got %+v", unwindowed)
+	}
+}
+
+func TestEditsAndDeletesInvalidateConversations(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	ids := saveTestMessages(t, db, "deploy tonight?", "yes at 9", "lunch?", "pizza")
+
+	first := Conversation{ChatID: 1, FirstID: ids[0], LastID: ids[1]}
+	second := Conversation{ChatID: 1, FirstID: ids[2], LastID: ids[3]}
+	for _, c := range []Conversation{first, second} {
+		windows := []ConversationWindow{{SegmentFirstID: c.FirstID, SegmentLastID: c.LastID, MessageIDs: []int64{c.FirstID, c.LastID}, Text: "window"}}
+		if _, err := db.SaveConversationWindows(ctx, c, c.LastID, windows); err != nil {
+			t.Fatalf("SaveConversationWindows failed: %v", err)
+		}
+	}
+
+	// Editing a message drops the windows of its conversation only
+	if err := db.UpdateMessageText(ctx, ids[1], "yes at 10", []float64{1, 0}, "", time.Now()); err != nil {
+		t.Fatalf("UpdateMessageText failed: %v", err)
+	}
+	stale, err := db.StaleConversations(ctx, 1)
+	if err != nil {
+		t.Fatalf("StaleConversations failed: %v", err)
+	}
+	if len(stale) != 1 || stale[0] != first {
+		t.Fatalf("Expected the edited conversation to be stale, got %+v", stale)
+	}
+	if has, _ := db.HasConversationWindows(ctx, first); has {
+		t.Error("Expected the edited conversation's windows to be dropped")
+	}
+	if has, _ := db.HasConversationWindows(ctx, second); !has {
+		t.Error("Expected the other conversation to keep its windows")
+	}
+
+	// Deleting a message does the same
+	if err := db.DeleteMessagesByIDs(ctx, []int64{ids[3]}); err != nil {
+		t.Fatalf("DeleteMessagesByIDs failed: %v", err)
+	}
+	if stale, _ = db.StaleConversations(ctx, 1); len(stale) != 2 || stale[1] != second {
+		t.Fatalf("Expected both conversations to be stale, got %+v", stale)
+	}
+	if has, _ := db.HasConversationWindows(ctx, second); has {
+		t.Error("Expected the deleted message's windows to be dropped")
+	}
+
+	// Rebuilding a conversation clears its stale mark
+	rebuilt := []ConversationWindow{{SegmentFirstID: first.FirstID, SegmentLastID: first.LastID, MessageIDs: []int64{first.FirstID, first.LastID}, Text: "window"}}
+	if _, err := db.SaveConversationWindows(ctx, first, first.LastID, rebuilt); err != nil {
+		t.Fatalf("SaveConversationWindows failed: %v", err)
+	}
+	if stale, _ = db.StaleConversations(ctx, 1); len(stale) != 1 || stale[0] != second {
+		t.Errorf("Expected only the second conversation to stay stale, got %+v", stale)
+	}
+}
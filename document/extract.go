@@ -0,0 +1,183 @@
+// Package document extracts searchable text from files shared in chats
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// MaxTextBytes caps how much text is kept from a single document
+const MaxTextBytes = 1 << 20
+
+// ErrUnsupported is returned for files whose text can't be extracted
+var ErrUnsupported = errors.New("unsupported document type")
+
+// Page is the text of a page of a document. Number is 0 for formats
+// without pages, such as text files.
+type Page struct {
+	Number int
+	Text   string
+}
+
+// textExtensions are plain text, markup and source code files
+var textExtensions = map[string]bool{
+	".txt": true, ".text": true, ".log": true, ".md": true, ".markdown": true, ".rst": true, ".csv": true, ".tsv": true,
+	".json": true, ".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".cfg": true, ".conf": true, ".env": true,
+	".xml": true, ".html": true, ".htm": true, ".css": true, ".sql": true, ".diff": true, ".patch": true,
+	".go": true, ".py": true, ".js": true, ".jsx": true, ".ts": true, ".tsx": true, ".java": true, ".kt": true,
+	".c": true, ".h": true, ".cc": true, ".cpp": true, ".hpp": true, ".cs": true, ".rs": true, ".rb": true,
+	".php": true, ".swift": true, ".scala": true, ".lua": true, ".pl": true, ".r": true, ".sh": true, ".bash": true,
+	".zsh": true, ".ps1": true, ".dockerfile": true, ".tf": true, ".proto": true, ".graphql": true,
+}
+
+// Supported reports whether text can be extracted from a file, judging by
+// its name and MIME type
+func Supported(fileName, mimeType string) bool {
+	return isPDF(fileName, mimeType) || isText(fileName, mimeType)
+}
+
+// Extract returns the text of a PDF, plain text, Markdown or source code
+// file, skipping pages without text. At most MaxTextBytes are kept.
+func Extract(fileName, mimeType string, data []byte) ([]Page, error) {
+	var pages []Page
+	var err error
+	switch {
+	case isPDF(fileName, mimeType):
+		pages, err = extractPDF(data)
+	case isText(fileName, mimeType):
+		pages, err = extractText(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	return truncatePages(pages, MaxTextBytes), nil
+}
+
+func isPDF(fileName, mimeType string) bool {
+	return mimeType == "application/pdf" || strings.EqualFold(filepath.Ext(fileName), ".pdf")
+}
+
+func isText(fileName, mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/x-yaml", "application/x-sh", "application/javascript", "application/sql":
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(fileName))
+	return textExtensions[ext] || strings.EqualFold(filepath.Base(fileName), "Dockerfile") || strings.EqualFold(filepath.Base(fileName), "Makefile")
+}
+
+// extractText returns a text file as a single page
+func extractText(data []byte) ([]Page, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, fmt.Errorf("%w: not a UTF-8 text file", ErrUnsupported)
+	}
+
+	text := strings.TrimSpace(strings.ReplaceAll(string(data), "\r\n", "\n"))
+	if text == "" {
+		return nil, nil
+	}
+	return []Page{{Text: text}}, nil
+}
+
+// extractPDF returns the text of each page of a PDF. Words are separated
+// by the gaps between the glyphs, since PDFs often position words instead
+// of writing spaces.
+func extractPDF(data []byte) (pages []Page, err error) {
+	// The PDF reader panics on some malformed files
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("failed to read PDF: %v", r)
+		}
+	}()
+
+	reader, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF: %w", err)
+	}
+
+	size := 0
+	for number := 1; number <= reader.NumPage() && size < MaxTextBytes; number++ {
+		page := reader.Page(number)
+		if page.V.IsNull() {
+			continue
+		}
+
+		text := pageText(page.Content().Text)
+		if text == "" {
+			continue
+		}
+		pages = append(pages, Page{Number: number, Text: text})
+		size += len(text)
+	}
+	return pages, nil
+}
+
+// pageText joins the glyphs of a page into lines of words
+func pageText(glyphs []pdf.Text) string {
+	var text strings.Builder
+	var previous pdf.Text
+	end := 0.0 // where the previous glyph ends
+	for i, glyph := range glyphs {
+		if i > 0 {
+			switch {
+			case math.Abs(glyph.Y-previous.Y) > previous.FontSize/2:
+				text.WriteString("\n")
+			case glyph.X-end > glyph.FontSize/4:
+				text.WriteString(" ")
+			}
+		}
+		text.WriteString(glyph.S)
+
+		width := glyph.W
+		if width == 0 {
+			// Fonts without widths: assume an average glyph
+			width = glyph.FontSize / 2 * float64(utf8.RuneCountInString(glyph.S))
+		}
+		previous, end = glyph, glyph.X+width
+	}
+
+	lines := strings.Split(text.String(), "\n")
+	var kept []string
+	for _, line := range lines {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "\n")
+}
+
+// truncatePages keeps pages up to limit bytes of text, cutting the last one
+// on a rune boundary
+func truncatePages(pages []Page, limit int) []Page {
+	size := 0
+	for i, page := range pages {
+		if size+len(page.Text) <= limit {
+			size += len(page.Text)
+			continue
+		}
+
+		cut := limit - size
+		for cut > 0 && !utf8.RuneStart(page.Text[cut]) {
+			cut--
+		}
+		if cut == 0 {
+			return pages[:i]
+		}
+		pages[i].Text = page.Text[:cut]
+		return pages[:i+1]
+	}
+	return pages
+}
@@ -0,0 +1,112 @@
+package document
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// buildPDF writes a minimal PDF with one page per text, each shown with
+// the standard Helvetica font
+func buildPDF(texts ...string) []byte {
+	var objects []string
+	objects = append(objects, "<< /Type /Catalog /Pages 2 0 R >>")
+
+	var kids []string
+	for i := range texts {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	objects = append(objects, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(texts)))
+	objects = append(objects, "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>")
+
+	for i, text := range texts {
+		content := fmt.Sprintf("BT /F1 12 Tf 72 720 Td (%s) Tj 0 -20 Td (second line) Tj ET", text)
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func TestExtractPDF(t *testing.T) {
+	data := buildPDF("Welcome to the runbook", "Restart the broker before rotating certificates")
+
+	pages, err := Extract("runbook.pdf", "application/pdf", data)
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %+v", pages)
+	}
+	if pages[1].Number != 2 || pages[1].Text != "Restart the broker before rotating certificates\nsecond line" {
+		t.Errorf("Unexpected second page: %+v", pages[1])
+	}
+
+	if _, err := Extract("broken.pdf", "application/pdf", []byte("%PDF-1.4 not really")); err == nil {
+		t.Error("Expected an error for a malformed PDF")
+	}
+}
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		fileName, mimeType string
+	}{
+		{"notes.md", ""},
+		{"deploy.sh", "application/x-sh"},
+		{"main.go", "application/octet-stream"},
+		{"server.log", "text/plain"},
+		{"Dockerfile", ""},
+	}
+	for _, tt := range tests {
+		if !Supported(tt.fileName, tt.mimeType) {
+			t.Errorf("Expected %s (%s) to be supported", tt.fileName, tt.mimeType)
+		}
+	}
+
+	pages, err := Extract("notes.md", "", []byte("\xef\xbb\xbf# Release notes\r\n\r\n- fixed the login bug\r\n"))
+	if err != nil {
+		t.Fatalf("Extract failed: %v", err)
+	}
+	if len(pages) != 1 || pages[0].Number != 0 || pages[0].Text != "# Release notes\n\n- fixed the login bug" {
+		t.Errorf("Unexpected pages: %+v", pages)
+	}
+
+	if Supported("photo.jpg", "image/jpeg") {
+		t.Error("Expected images to be unsupported")
+	}
+	if _, err := Extract("photo.jpg", "image/jpeg", []byte{0xff, 0xd8}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for an image, got %v", err)
+	}
+	if _, err := Extract("data.txt", "", []byte{'a', 0, 'b'}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Expected ErrUnsupported for binary data, got %v", err)
+	}
+}
+
+func TestTruncatePages(t *testing.T) {
+	pages := truncatePages([]Page{{Number: 1, Text: "abcd"}, {Number: 2, Text: "éfgh"}, {Number: 3, Text: "ijkl"}}, 5)
+	if len(pages) != 1 || pages[0].Text != "abcd" {
+		t.Errorf("Expected the cut to stay on a rune boundary, got %+v", pages)
+	}
+
+	pages = truncatePages([]Page{{Number: 1, Text: "abcd"}, {Number: 2, Text: "efgh"}}, 6)
+	if len(pages) != 2 || pages[1].Text != "ef" {
+		t.Errorf("Expected the second page to be cut, got %+v", pages)
+	}
+}
@@ -0,0 +1,289 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// BreakerState is the state of a CircuitBreaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"    // requests reach the service
+	BreakerOpen     BreakerState = "open"      // requests fail right away
+	BreakerHalfOpen BreakerState = "half-open" // trial requests probe the service
+)
+
+// ErrCircuitOpen matches the errors returned while the breaker rejects
+// requests
+var ErrCircuitOpen = errors.New("embedding service unavailable")
+
+// CircuitOpenError is returned instead of calling the service while the
+// breaker is open
+type CircuitOpenError struct {
+	RetryAt   time.Time // when the next trial request is allowed
+	LastError string    // the failure that opened the breaker
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%v, retrying after %s: %s", ErrCircuitOpen, e.RetryAt.Format(time.TimeOnly), e.LastError)
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// BreakerSettings tunes a CircuitBreaker
+type BreakerSettings struct {
+	FailureThreshold  int           // consecutive failures that open the breaker
+	OpenTimeout       time.Duration // how long it stays open before a trial request
+	HalfOpenSuccesses int           // successful trial requests that close it again
+}
+
+// DefaultBreakerSettings are used for settings left at zero
+var DefaultBreakerSettings = BreakerSettings{
+	FailureThreshold:  5,
+	OpenTimeout:       30 * time.Second,
+	HalfOpenSuccesses: 2,
+}
+
+// BreakerHealth describes the embedding service as seen by the breaker
+type BreakerHealth struct {
+	State       BreakerState
+	Failures    int       // consecutive failures
+	LastError   string    // most recent failure, empty if none
+	LastFailure time.Time // zero if none
+	RetryAt     time.Time // next trial request while open
+}
+
+// CircuitBreaker stops calling a failing embedding service. After
+// FailureThreshold consecutive failures it opens and rejects requests with a
+// CircuitOpenError for OpenTimeout, so callers don't each wait for the HTTP
+// timeout. Then it lets one trial request through at a time and closes again
+// after HalfOpenSuccesses of them succeed; a failed trial opens it again.
+//
+// Each model has its own state, so a model the service doesn't have leaves
+// the others working. Error statuses below 500 are answers from a working
+// service and don't count as failures.
+type CircuitBreaker struct {
+	inner  Embedder
+	state  *breakerState  // state of inner's model
+	models *breakerModels // shared by the embedders WithModel returns
+}
+
+// breakerModels holds the state of every model a breaker has been used with
+type breakerModels struct {
+	settings BreakerSettings
+	states   map[string]*breakerState
+	mutex    sync.Mutex
+}
+
+// state returns the state of a model, starting it closed on first use
+func (m *breakerModels) state(model string) *breakerState {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	state, ok := m.states[model]
+	if !ok {
+		state = &breakerState{
+			model:    model,
+			settings: m.settings,
+			now:      time.Now,
+			state:    BreakerClosed,
+		}
+		m.states[model] = state
+	}
+	return state
+}
+
+type breakerState struct {
+	model    string
+	settings BreakerSettings
+	now      func() time.Time
+
+	state       BreakerState
+	failures    int
+	successes   int  // trial successes while half-open
+	trial       bool // a trial request is in flight
+	lastError   string
+	lastFailure time.Time
+	openedAt    time.Time
+	mutex       sync.Mutex
+}
+
+func NewCircuitBreaker(inner Embedder, settings BreakerSettings) *CircuitBreaker {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultBreakerSettings.FailureThreshold
+	}
+	if settings.OpenTimeout <= 0 {
+		settings.OpenTimeout = DefaultBreakerSettings.OpenTimeout
+	}
+	if settings.HalfOpenSuccesses <= 0 {
+		settings.HalfOpenSuccesses = DefaultBreakerSettings.HalfOpenSuccesses
+	}
+
+	models := &breakerModels{settings: settings, states: make(map[string]*breakerState)}
+	return &CircuitBreaker{inner: inner, state: models.state(inner.ModelName()), models: models}
+}
+
+func (b *CircuitBreaker) ModelName() string {
+	return b.inner.ModelName()
+}
+
+func (b *CircuitBreaker) WithModel(model string) Embedder {
+	inner := b.inner.WithModel(model)
+	return &CircuitBreaker{inner: inner, state: b.models.state(inner.ModelName()), models: b.models}
+}
+
+// Unwrap returns the wrapped embedder, for requests that must reach the
+// embedding service such as connection tests
+func (b *CircuitBreaker) Unwrap() Embedder {
+	return b.inner
+}
+
+// Health returns the breaker's view of the embedding service for its model
+func (b *CircuitBreaker) Health() BreakerHealth {
+	return b.state.health()
+}
+
+func (b *CircuitBreaker) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	trial, err := b.state.acquire()
+	if err != nil {
+		return nil, err
+	}
+	embedding, err := b.inner.GetEmbedding(ctx, text)
+	b.state.release(ctx, trial, err)
+	return embedding, err
+}
+
+func (b *CircuitBreaker) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := checkTexts(texts); err != nil {
+		return nil, err
+	}
+
+	trial, err := b.state.acquire()
+	if err != nil {
+		return nil, err
+	}
+	embeddings, err := b.inner.GetEmbeddings(ctx, texts)
+	b.state.release(ctx, trial, err)
+	return embeddings, err
+}
+
+// acquire returns an error if the request must not reach the service, and
+// whether it is a trial request
+func (s *breakerState) acquire() (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := s.now()
+	switch s.state {
+	case BreakerOpen:
+		retryAt := s.openedAt.Add(s.settings.OpenTimeout)
+		if now.Before(retryAt) {
+			return false, &CircuitOpenError{RetryAt: retryAt, LastError: s.lastError}
+		}
+		s.transition(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if s.trial {
+			// Another trial is probing the service
+			return false, &CircuitOpenError{RetryAt: now, LastError: s.lastError}
+		}
+		s.trial = true
+		return true, nil
+	}
+	return false, nil
+}
+
+// release records the outcome of a request allowed by acquire
+func (s *breakerState) release(ctx context.Context, trial bool, err error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if trial {
+		s.trial = false
+	}
+
+	if err != nil && ctx.Err() != nil {
+		// Canceled by the caller, which says nothing about the service. A
+		// canceled trial leaves the next request to probe it.
+		return
+	}
+	if err != nil && serviceFailure(err) {
+		s.failures++
+		s.lastError = err.Error()
+		s.lastFailure = s.now()
+		if trial || (s.state == BreakerClosed && s.failures >= s.settings.FailureThreshold) {
+			s.openedAt = s.lastFailure
+			s.transition(BreakerOpen)
+		}
+		return
+	}
+
+	s.failures = 0
+	if trial && s.state == BreakerHalfOpen {
+		s.successes++
+		if s.successes >= s.settings.HalfOpenSuccesses {
+			s.transition(BreakerClosed)
+		}
+	}
+}
+
+// serviceFailure reports whether err means the service is unreachable or
+// failing: a transport error, a timeout or a 5xx status. A 4xx status, such
+// as a 404 for a missing model or a 400 for bad input, comes from a working
+// service.
+func serviceFailure(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= http.StatusInternalServerError
+	}
+	return true
+}
+
+// transition changes the state and logs it. The caller holds the mutex.
+func (s *breakerState) transition(state BreakerState) {
+	if s.state == state {
+		return
+	}
+
+	s.state = state
+	s.successes = 0
+	switch state {
+	case BreakerOpen:
+		log.Printf("⚠️  Embedding circuit breaker for %s opened after %d failures, retrying in %v: %s", s.model, s.failures, s.settings.OpenTimeout, s.lastError)
+	case BreakerHalfOpen:
+		log.Printf("🔁 Embedding circuit breaker for %s half-open, probing the service", s.model)
+	case BreakerClosed:
+		log.Printf("✅ Embedding circuit breaker for %s closed, service recovered", s.model)
+	}
+}
+
+func (s *breakerState) health() BreakerHealth {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	health := BreakerHealth{
+		State:       s.state,
+		Failures:    s.failures,
+		LastError:   s.lastError,
+		LastFailure: s.lastFailure,
+	}
+	if s.state == BreakerOpen {
+		health.RetryAt = s.openedAt.Add(s.settings.OpenTimeout)
+	}
+	return health
+}
@@ -0,0 +1,153 @@
+package embedding
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// failingEmbedder fails while err is set
+type failingEmbedder struct {
+	*HashingEmbedder
+	err   error
+	calls int
+}
+
+func (f *failingEmbedder) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	f.calls++
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.HashingEmbedder.GetEmbedding(ctx, text)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	ctx := context.Background()
+	inner := &failingEmbedder{HashingEmbedder: NewHashingEmbedder("hashing", 0), err: errors.New("timeout")}
+	breaker := NewCircuitBreaker(inner, BreakerSettings{FailureThreshold: 3, OpenTimeout: time.Minute, HalfOpenSuccesses: 2})
+	now := time.Now()
+	breaker.state.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if _, err := breaker.GetEmbedding(ctx, "hello"); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("Expected the service error on call %d, got %v", i, err)
+		}
+	}
+	if health := breaker.Health(); health.State != BreakerOpen || health.Failures != 3 || health.LastError != "timeout" {
+		t.Fatalf("Expected an open breaker after 3 failures, got %+v", health)
+	}
+
+	// Open: requests fail fast without reaching the service
+	_, err := breaker.GetEmbedding(ctx, "hello")
+	var open *CircuitOpenError
+	if !errors.As(err, &open) || !errors.Is(err, ErrCircuitOpen) || !open.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Fatalf("Expected a CircuitOpenError, got %v", err)
+	}
+	if inner.calls != 3 {
+		t.Errorf("Expected 3 calls to the service, got %d", inner.calls)
+	}
+
+	// Half-open: a failed trial opens it again
+	now = now.Add(time.Minute)
+	breaker.GetEmbedding(ctx, "hello")
+	if state := breaker.Health().State; state != BreakerOpen {
+		t.Fatalf("Expected the failed trial to reopen the breaker, got %s", state)
+	}
+
+	// Half-open: enough successful trials close it
+	now = now.Add(time.Minute)
+	inner.err = nil
+	if _, err := breaker.GetEmbedding(ctx, "hello"); err != nil {
+		t.Fatalf("Expected the trial to succeed, got %v", err)
+	}
+	if state := breaker.Health().State; state != BreakerHalfOpen {
+		t.Fatalf("Expected a half-open breaker after one success, got %s", state)
+	}
+	breaker.GetEmbedding(ctx, "hello")
+	if health := breaker.Health(); health.State != BreakerClosed || health.Failures != 0 {
+		t.Fatalf("Expected a closed breaker, got %+v", health)
+	}
+}
+
+func TestCircuitBreakerPerModel(t *testing.T) {
+	ctx := context.Background()
+	inner := &failingEmbedder{HashingEmbedder: NewHashingEmbedder("hashing", 0), err: errors.New("down")}
+	breaker := NewCircuitBreaker(inner, BreakerSettings{FailureThreshold: 1})
+
+	other := breaker.WithModel("other")
+	inner.err = nil
+	if _, err := other.GetEmbedding(ctx, "hello"); err != nil {
+		t.Fatalf("Expected the other model to work, got %v", err)
+	}
+	inner.err = errors.New("down")
+	breaker.GetEmbedding(ctx, "hello")
+	if state := breaker.Health().State; state != BreakerOpen {
+		t.Fatalf("Expected an open breaker, got %s", state)
+	}
+
+	if health := other.(*CircuitBreaker).Health(); health.State != BreakerClosed || health.Failures != 0 {
+		t.Errorf("Expected other models to keep their own breaker, got %+v", health)
+	}
+	if _, err := breaker.WithModel("hashing").GetEmbedding(ctx, "hello"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected the same model to share the open breaker, got %v", err)
+	}
+}
+
+func TestCircuitBreakerCountsServiceFailures(t *testing.T) {
+	tests := []struct {
+		status int
+		opens  bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(`{"error":"model \"test-model\" not found"}`))
+			}))
+			defer server.Close()
+
+			breaker := NewCircuitBreaker(NewOllamaClient(server.URL, "test-model"), BreakerSettings{FailureThreshold: 1})
+			_, err := breaker.GetEmbedding(context.Background(), "hello")
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.StatusCode != tt.status {
+				t.Fatalf("Expected an API error with status %d, got %v", tt.status, err)
+			}
+			if opened := breaker.Health().State == BreakerOpen; opened != tt.opens {
+				t.Errorf("Expected the breaker open = %v, got %+v", tt.opens, breaker.Health())
+			}
+		})
+	}
+}
+
+func TestCircuitBreakerIgnoresCancellation(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release // hang like an overloaded server
+	}))
+	defer server.Close()
+	defer close(release) // runs first, so Close doesn't wait for the handler
+
+	breaker := NewCircuitBreaker(NewOllamaClient(server.URL, "test-model"), BreakerSettings{FailureThreshold: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := breaker.GetEmbedding(ctx, "hello"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the request to be canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to stop with its context, took %v", elapsed)
+	}
+	if health := breaker.Health(); health.State != BreakerClosed || health.Failures != 0 {
+		t.Errorf("Expected cancellation not to count as a failure, got %+v", health)
+	}
+}
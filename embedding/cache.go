@@ -0,0 +1,281 @@
+package embedding
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// CacheStore persists cached embeddings, keyed by model and text hash
+type CacheStore interface {
+	// LoadCachedEmbeddings returns the stored vectors of model for the
+	// given keys; missing keys are left out.
+	LoadCachedEmbeddings(ctx context.Context, model string, keys []string) (map[string][]float64, error)
+	// SaveCachedEmbeddings stores vectors of model by key.
+	SaveCachedEmbeddings(ctx context.Context, model string, entries map[string][]float64) error
+}
+
+// CacheStats counts how embedding lookups were answered
+type CacheStats struct {
+	MemoryHits int64 // answered by the in-memory LRU
+	StoreHits  int64 // answered by the persistent store
+	Misses     int64 // sent to the embedding service
+	Entries    int   // vectors held in memory
+}
+
+// HitRate returns the share of lookups answered from the cache
+func (s CacheStats) HitRate() float64 {
+	total := s.MemoryHits + s.StoreHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.MemoryHits+s.StoreHits) / float64(total)
+}
+
+// CachedEmbedder answers repeated texts from a content-addressed cache: an
+// in-memory LRU in front of a persistent store, both keyed by model and the
+// SHA-256 of the normalized text. Only misses reach the wrapped embedder.
+type CachedEmbedder struct {
+	inner Embedder
+	cache *embeddingCache // shared by the embedders WithModel returns
+}
+
+// NewCachedEmbedder wraps inner with a cache holding up to capacity vectors
+// in memory. store may be nil to cache in memory only.
+func NewCachedEmbedder(inner Embedder, store CacheStore, capacity int) *CachedEmbedder {
+	return &CachedEmbedder{
+		inner: inner,
+		cache: &embeddingCache{
+			capacity: max(capacity, 1),
+			entries:  make(map[string]*list.Element),
+			order:    list.New(),
+			store:    store,
+		},
+	}
+}
+
+func (c *CachedEmbedder) ModelName() string {
+	return c.inner.ModelName()
+}
+
+func (c *CachedEmbedder) WithModel(model string) Embedder {
+	return &CachedEmbedder{inner: c.inner.WithModel(model), cache: c.cache}
+}
+
+// Unwrap returns the wrapped embedder, for requests that must reach the
+// embedding service such as connection tests
+func (c *CachedEmbedder) Unwrap() Embedder {
+	return c.inner
+}
+
+// Forget drops the vectors of every model held in memory for the given
+// keys, e.g. after the texts they were embedded from were deleted
+func (c *CachedEmbedder) Forget(keys []string) {
+	c.cache.remove(keys)
+}
+
+// Stats returns the cache counters shared by every model
+func (c *CachedEmbedder) Stats() CacheStats {
+	return c.cache.stats()
+}
+
+func (c *CachedEmbedder) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	embeddings, err := c.GetEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+// GetEmbeddings looks every text up in memory, then the remaining ones in
+// the store, and embeds what is still missing with a single request
+func (c *CachedEmbedder) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := checkTexts(texts); err != nil {
+		return nil, err
+	}
+
+	model := c.inner.ModelName()
+	embeddings := make([][]float64, len(texts))
+	keys := make([]string, len(texts))
+	missing := make(map[string][]int) // key -> positions still without a vector
+	for i, text := range texts {
+		keys[i] = CacheKey(text)
+		if embedding, ok := c.cache.get(model, keys[i]); ok {
+			embeddings[i] = embedding
+			continue
+		}
+		missing[keys[i]] = append(missing[keys[i]], i)
+	}
+
+	if len(missing) > 0 && c.cache.store != nil {
+		lookup := make([]string, 0, len(missing))
+		for key := range missing {
+			lookup = append(lookup, key)
+		}
+
+		stored, err := c.cache.store.LoadCachedEmbeddings(ctx, model, lookup)
+		if err != nil {
+			log.Printf("Error reading embedding cache: %v", err)
+		}
+		for key, embedding := range stored {
+			c.cache.put(model, key, embedding)
+			c.cache.countStoreHits(len(missing[key]))
+			for _, i := range missing[key] {
+				embeddings[i] = copyVector(embedding)
+			}
+			delete(missing, key)
+		}
+	}
+
+	if len(missing) == 0 {
+		return embeddings, nil
+	}
+
+	// Embed each distinct missing text once
+	var request []string
+	var requestKeys []string
+	for key, positions := range missing {
+		request = append(request, normalizeText(texts[positions[0]]))
+		requestKeys = append(requestKeys, key)
+		c.cache.countMisses(len(positions))
+	}
+
+	fresh, err := c.inner.GetEmbeddings(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string][]float64, len(fresh))
+	for j, key := range requestKeys {
+		entries[key] = fresh[j]
+		c.cache.put(model, key, fresh[j])
+		for _, i := range missing[key] {
+			embeddings[i] = copyVector(fresh[j])
+		}
+	}
+
+	if c.cache.store != nil {
+		if err := c.cache.store.SaveCachedEmbeddings(ctx, model, entries); err != nil {
+			log.Printf("Error saving embedding cache: %v", err)
+		}
+	}
+
+	return embeddings, nil
+}
+
+// CacheKey returns the hex SHA-256 of a text after normalization, which
+// identifies it in the cache
+func CacheKey(text string) string {
+	sum := sha256.Sum256([]byte(normalizeText(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeText collapses whitespace the way stored messages are cleaned,
+// so texts differing only in spacing share a cache entry
+func normalizeText(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+func copyVector(v []float64) []float64 {
+	return append([]float64(nil), v...)
+}
+
+// embeddingCache is an LRU of vectors keyed by model and text hash
+type embeddingCache struct {
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // most recently used first
+	store    CacheStore
+
+	memoryHits, storeHits, misses int64
+	mutex                         sync.Mutex
+}
+
+type cacheEntry struct {
+	key       string
+	embedding []float64
+}
+
+func (c *embeddingCache) get(model, key string) ([]float64, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[model+"\x00"+key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	c.memoryHits++
+	return copyVector(element.Value.(*cacheEntry).embedding), true
+}
+
+func (c *embeddingCache) put(model, key string, embedding []float64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	fullKey := model + "\x00" + key
+	if element, ok := c.entries[fullKey]; ok {
+		element.Value.(*cacheEntry).embedding = copyVector(embedding)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[fullKey] = c.order.PushFront(&cacheEntry{key: fullKey, embedding: copyVector(embedding)})
+	for c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func (c *embeddingCache) remove(keys []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	forget := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		forget[key] = true
+	}
+	for fullKey, element := range c.entries {
+		if _, key, _ := strings.Cut(fullKey, "\x00"); forget[key] {
+			c.order.Remove(element)
+			delete(c.entries, fullKey)
+		}
+	}
+}
+
+func (c *embeddingCache) countStoreHits(n int) {
+	c.mutex.Lock()
+	c.storeHits += int64(n)
+	c.mutex.Unlock()
+}
+
+func (c *embeddingCache) countMisses(n int) {
+	c.mutex.Lock()
+	c.misses += int64(n)
+	c.mutex.Unlock()
+}
+
+func (c *embeddingCache) stats() CacheStats {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return CacheStats{
+		MemoryHits: c.memoryHits,
+		StoreHits:  c.storeHits,
+		Misses:     c.misses,
+		Entries:    c.order.Len(),
+	}
+}
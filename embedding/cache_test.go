@@ -0,0 +1,135 @@
+package embedding
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+// countingEmbedder records the texts it is asked to embed
+type countingEmbedder struct {
+	*HashingEmbedder
+	mutex    sync.Mutex
+	requests [][]string
+}
+
+func (c *countingEmbedder) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	c.mutex.Lock()
+	c.requests = append(c.requests, texts)
+	c.mutex.Unlock()
+	return c.HashingEmbedder.GetEmbeddings(ctx, texts)
+}
+
+func (c *countingEmbedder) WithModel(model string) Embedder {
+	return &countingEmbedder{HashingEmbedder: c.HashingEmbedder.WithModel(model).(*HashingEmbedder)}
+}
+
+// mapStore is an in-memory CacheStore
+type mapStore map[string][]float64
+
+func (s mapStore) LoadCachedEmbeddings(ctx context.Context, model string, keys []string) (map[string][]float64, error) {
+	found := make(map[string][]float64)
+	for _, key := range keys {
+		if embedding, ok := s[model+"/"+key]; ok {
+			found[key] = embedding
+		}
+	}
+	return found, nil
+}
+
+func (s mapStore) SaveCachedEmbeddings(ctx context.Context, model string, entries map[string][]float64) error {
+	for key, embedding := range entries {
+		s[model+"/"+key] = embedding
+	}
+	return nil
+}
+
+func TestCachedEmbedder(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingEmbedder{HashingEmbedder: NewHashingEmbedder("hashing", 0)}
+	store := mapStore{}
+	cached := NewCachedEmbedder(inner, store, 10)
+
+	embeddings, err := cached.GetEmbeddings(ctx, []string{"ok", "thanks", "ok  ", "deploy failed"})
+	if err != nil {
+		t.Fatalf("GetEmbeddings failed: %v", err)
+	}
+	if len(embeddings) != 4 || cosine(embeddings[0], embeddings[2]) < 0.999 {
+		t.Fatal("Expected texts differing only in spacing to share a vector")
+	}
+	if len(inner.requests) != 1 || len(inner.requests[0]) != 3 {
+		t.Fatalf("Expected one request with 3 distinct texts, got %v", inner.requests)
+	}
+	if len(store) != 3 {
+		t.Errorf("Expected 3 stored vectors, got %d", len(store))
+	}
+
+	// Repeated texts are answered from memory
+	if _, err := cached.GetEmbedding(ctx, "thanks"); err != nil {
+		t.Fatalf("GetEmbedding failed: %v", err)
+	}
+	if len(inner.requests) != 1 {
+		t.Errorf("Expected a memory hit, got %d requests", len(inner.requests))
+	}
+
+	// Callers may modify returned vectors without corrupting the cache
+	embeddings[1][0] = 42
+	again, _ := cached.GetEmbedding(ctx, "thanks")
+	if again[0] == 42 {
+		t.Error("Expected the cache to return a copy")
+	}
+
+	stats := cached.Stats()
+	if stats.MemoryHits != 2 || stats.Misses != 4 || stats.Entries != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+
+	// A fresh cache over the same store answers from the store
+	restarted := NewCachedEmbedder(inner, store, 10)
+	if _, err := restarted.GetEmbedding(ctx, "deploy failed"); err != nil {
+		t.Fatalf("GetEmbedding failed: %v", err)
+	}
+	if len(inner.requests) != 1 || restarted.Stats().StoreHits != 1 {
+		t.Errorf("Expected a store hit, got %d requests and %+v", len(inner.requests), restarted.Stats())
+	}
+
+	// Other models don't share entries
+	if _, err := cached.WithModel("other").GetEmbedding(ctx, "thanks"); err != nil {
+		t.Fatalf("GetEmbedding failed: %v", err)
+	}
+	if cached.Stats().Misses != 5 {
+		t.Errorf("Expected a miss for another model, got %+v", cached.Stats())
+	}
+}
+
+func TestCachedEmbedderEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingEmbedder{HashingEmbedder: NewHashingEmbedder("hashing", 0)}
+	cached := NewCachedEmbedder(inner, nil, 2)
+
+	cached.GetEmbedding(ctx, "first")
+	cached.GetEmbedding(ctx, "second")
+	cached.GetEmbedding(ctx, "first") // now the most recently used
+	cached.GetEmbedding(ctx, "third") // evicts second
+
+	cached.GetEmbedding(ctx, "first")
+	if len(inner.requests) != 3 {
+		t.Errorf("Expected first to stay cached, got %d requests", len(inner.requests))
+	}
+	cached.GetEmbedding(ctx, "second")
+	if len(inner.requests) != 4 {
+		t.Errorf("Expected second to be evicted, got %d requests", len(inner.requests))
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	if CacheKey("hello  world\n") != CacheKey("hello world") {
+		t.Error("Expected whitespace to be normalized")
+	}
+	if CacheKey("hello") == CacheKey("Hello") {
+		t.Error("Expected case to be preserved")
+	}
+	if len(CacheKey("hello")) != 64 {
+		t.Errorf("Expected a hex SHA-256, got %q", CacheKey("hello"))
+	}
+}
@@ -0,0 +1,127 @@
+package embedding
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	// ChunkWords is the budget of a chunk, in words as a rough stand-in for
+	// tokens; it keeps chunks well inside the context of small models such
+	// as all-minilm (256 tokens)
+	ChunkWords = 150
+	// ChunkOverlapWords is how many words of trailing sentences a chunk
+	// repeats from the previous one, so a passage cut at a boundary is still
+	// whole in one of them
+	ChunkOverlapWords = 30
+)
+
+// SplitChunks splits a text longer than ChunkWords into overlapping chunks
+// of whole sentences. Sentences longer than ChunkOverlapWords are cut into
+// pieces of that size. Returns nil for texts that fit in a single chunk.
+func SplitChunks(text string) []string {
+	sentences := splitSentences(text)
+
+	total := 0
+	for _, sentence := range sentences {
+		total += len(sentence)
+	}
+	if total <= ChunkWords {
+		return nil
+	}
+
+	var chunks []string
+	var current [][]string
+	words := 0
+	for i := 0; i < len(sentences); {
+		sentence := sentences[i]
+		if words > 0 && words+len(sentence) > ChunkWords {
+			chunks = append(chunks, joinSentences(current))
+			current, words = chunkOverlap(current)
+			continue
+		}
+		current = append(current, sentence)
+		words += len(sentence)
+		i++
+	}
+	return append(chunks, joinSentences(current))
+}
+
+// splitSentences splits text into sentences, as lists of words. A sentence
+// ends with a line or a word ending in '.', '!' or '?'.
+func splitSentences(text string) [][]string {
+	var sentences [][]string
+	for _, line := range strings.Split(text, "\n") {
+		var sentence []string
+		for _, word := range strings.Fields(line) {
+			sentence = append(sentence, word)
+			if strings.HasSuffix(word, ".") || strings.HasSuffix(word, "!") || strings.HasSuffix(word, "?") {
+				sentences = appendSentence(sentences, sentence)
+				sentence = nil
+			}
+		}
+		sentences = appendSentence(sentences, sentence)
+	}
+	return sentences
+}
+
+// appendSentence adds a sentence, cut into pieces of ChunkOverlapWords
+// words if it is longer
+func appendSentence(sentences [][]string, sentence []string) [][]string {
+	for len(sentence) > ChunkOverlapWords {
+		sentences = append(sentences, sentence[:ChunkOverlapWords])
+		sentence = sentence[ChunkOverlapWords:]
+	}
+	if len(sentence) > 0 {
+		sentences = append(sentences, sentence)
+	}
+	return sentences
+}
+
+// chunkOverlap returns the trailing sentences of a chunk that the next
+// chunk starts with, and their number of words. At least one sentence is
+// left out so every chunk adds new text.
+func chunkOverlap(chunk [][]string) ([][]string, int) {
+	start, words := len(chunk), 0
+	for start > 1 && words+len(chunk[start-1]) <= ChunkOverlapWords {
+		start--
+		words += len(chunk[start])
+	}
+	return append([][]string(nil), chunk[start:]...), words
+}
+
+func joinSentences(sentences [][]string) string {
+	parts := make([]string, len(sentences))
+	for i, sentence := range sentences {
+		parts[i] = strings.Join(sentence, " ")
+	}
+	return strings.Join(parts, " ")
+}
+
+// MeanVector averages vectors of the same size into a unit vector, e.g. to
+// stand for a text embedded in chunks
+func MeanVector(vectors [][]float64) []float64 {
+	if len(vectors) == 0 {
+		return nil
+	}
+
+	mean := make([]float64, len(vectors[0]))
+	for _, vector := range vectors {
+		for i := range mean {
+			mean[i] += vector[i]
+		}
+	}
+
+	var norm float64
+	for _, v := range mean {
+		norm += v * v
+	}
+	if norm == 0 {
+		return mean
+	}
+	norm = math.Sqrt(norm)
+	for i := range mean {
+		mean[i] /= norm
+	}
+	return mean
+}
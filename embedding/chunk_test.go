@@ -0,0 +1,64 @@
+package embedding
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestSplitChunks(t *testing.T) {
+	if chunks := SplitChunks("A short message. It fits in one chunk."); chunks != nil {
+		t.Errorf("Expected no chunks for a short text, got %q", chunks)
+	}
+
+	var sentences []string
+	for i := 0; i < 60; i++ {
+		sentences = append(sentences, fmt.Sprintf("Step %d of the runbook restarts service number %d.", i, i))
+	}
+	text := strings.Join(sentences, " ")
+
+	chunks := SplitChunks(text)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected several chunks for %d words, got %d", len(strings.Fields(text)), len(chunks))
+	}
+	for i, chunk := range chunks {
+		if words := len(strings.Fields(chunk)); words > ChunkWords {
+			t.Errorf("Chunk %d has %d words, over the budget of %d", i, words, ChunkWords)
+		}
+		if !strings.HasSuffix(chunk, ".") {
+			t.Errorf("Expected chunk %d to end with a whole sentence, got %q", i, chunk)
+		}
+	}
+
+	// Consecutive chunks share a sentence
+	for i := 1; i < len(chunks); i++ {
+		previous := strings.SplitAfter(chunks[i-1], ".")
+		last := strings.TrimSpace(previous[len(previous)-2])
+		if !strings.Contains(chunks[i], last) {
+			t.Errorf("Expected chunk %d to repeat %q from the previous chunk", i, last)
+		}
+	}
+
+	if !strings.HasPrefix(chunks[0], "Step 0 ") || !strings.HasSuffix(chunks[len(chunks)-1], "service number 59.") {
+		t.Error("Expected the chunks to cover the whole text")
+	}
+
+	// Text without punctuation is cut by words
+	long := strings.Repeat("word ", 400)
+	for i, chunk := range SplitChunks(long) {
+		if words := len(strings.Fields(chunk)); words > ChunkWords {
+			t.Errorf("Chunk %d of unpunctuated text has %d words", i, words)
+		}
+	}
+}
+
+func TestMeanVector(t *testing.T) {
+	mean := MeanVector([][]float64{{1, 0}, {0, 1}})
+	if math.Abs(mean[0]-math.Sqrt(0.5)) > 1e-9 || math.Abs(mean[1]-math.Sqrt(0.5)) > 1e-9 {
+		t.Errorf("Expected a unit vector halfway between the inputs, got %v", mean)
+	}
+	if MeanVector(nil) != nil {
+		t.Error("Expected no vector without inputs")
+	}
+}
@@ -1,120 +0,0 @@
-package embedding
-
-import (
-	"bytes"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"time"
-)
-
-type Client struct {
-	BaseURL    string
-	Model      string
-	HTTPClient *http.Client
-}
-
-type OllamaEmbeddingRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-}
-
-type OllamaEmbeddingResponse struct {
-	Embedding []float64 `json:"embedding"`
-}
-
-type OllamaErrorResponse struct {
-	Error string `json:"error"`
-}
-
-func NewClient(baseURL, model string) *Client {
-	return &Client{
-		BaseURL: baseURL,
-		Model:   model,
-		HTTPClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-	}
-}
-
-func (c *Client) GetEmbedding(text string) ([]float64, error) {
-	if text == "" {
-		return nil, fmt.Errorf("text cannot be empty")
-	}
-
-	// Prepare request
-	reqBody := OllamaEmbeddingRequest{
-		Model:  c.Model,
-		Prompt: text,
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	// Make HTTP request
-	url := fmt.Sprintf("%s/api/embeddings", c.BaseURL)
-	resp, err := c.HTTPClient.Post(url, "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request to %s: %w", url, err)
-	}
-	defer resp.Body.Close()
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %w", err)
-	}
-
-	// Handle error responses
-	if resp.StatusCode != http.StatusOK {
-		var errorResp OllamaErrorResponse
-		if err := json.Unmarshal(body, &errorResp); err == nil && errorResp.Error != "" {
-			return nil, fmt.Errorf("ollama API error (%d): %s", resp.StatusCode, errorResp.Error)
-		}
-		return nil, fmt.Errorf("ollama API error (%d): %s", resp.StatusCode, string(body))
-	}
-
-	// Parse successful response
-	var embeddingResp OllamaEmbeddingResponse
-	if err := json.Unmarshal(body, &embeddingResp); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
-	}
-
-	if len(embeddingResp.Embedding) == 0 {
-		return nil, fmt.Errorf("received empty embedding from API")
-	}
-
-	return embeddingResp.Embedding, nil
-}
-
-func (c *Client) TestConnection() error {
-	// Test with a simple phrase
-	_, err := c.GetEmbedding("test connection")
-	if err != nil {
-		return fmt.Errorf("connection test failed: %w", err)
-	}
-	return nil
-}
-
-func (c *Client) GetModelInfo() (string, error) {
-	url := fmt.Sprintf("%s/api/tags", c.BaseURL)
-	resp, err := c.HTTPClient.Get(url)
-	if err != nil {
-		return "", fmt.Errorf("failed to get model info: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
-	}
-
-	return string(body), nil
-}
@@ -0,0 +1,188 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Fake servers answer every provider's API the same way: each input is
+// embedded as [len(input), len(model)]. The model "missing" fails with an
+// API error and the model "short" drops the last embedding of a batch.
+func fakeEmbedding(model, input string) []float64 {
+	return []float64{float64(len(input)), float64(len(model))}
+}
+
+func fakeBatch(model string, inputs []string) [][]float64 {
+	var embeddings [][]float64
+	for _, input := range inputs {
+		embeddings = append(embeddings, fakeEmbedding(model, input))
+	}
+	if model == "short" {
+		embeddings = embeddings[:len(embeddings)-1]
+	}
+	return embeddings
+}
+
+func fakeOllamaServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model  string   `json:"model"`
+			Prompt string   `json:"prompt"`
+			Input  []string `json:"input"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(OllamaErrorResponse{Error: "model not found"})
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/embeddings":
+			json.NewEncoder(w).Encode(OllamaEmbeddingResponse{Embedding: fakeEmbedding(req.Model, req.Prompt)})
+		case "/api/embed":
+			json.NewEncoder(w).Encode(OllamaBatchEmbeddingResponse{Embeddings: fakeBatch(req.Model, req.Input)})
+		default:
+			t.Errorf("Unexpected path %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func fakeOpenAIServer(t *testing.T, apiKey string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer "+apiKey {
+			t.Errorf("Expected bearer token %q, got %q", apiKey, got)
+		}
+
+		var req OpenAIEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"model not found","type":"invalid_request_error"}}`))
+			return
+		}
+
+		// Answer in reverse order, clients must sort by index
+		var resp OpenAIEmbeddingResponse
+		embeddings := fakeBatch(req.Model, req.Input)
+		for i := len(embeddings) - 1; i >= 0; i-- {
+			resp.Data = append(resp.Data, OpenAIEmbedding{Index: i, Embedding: embeddings[i]})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+}
+
+// TestEmbedderConformance runs the same checks against every provider
+func TestEmbedderConformance(t *testing.T) {
+	ctx := context.Background()
+	providers := []struct {
+		name     string
+		server   func(t *testing.T) *httptest.Server
+		embedder func(url, model string) Embedder
+	}{
+		{
+			name:     ProviderOllama,
+			server:   fakeOllamaServer,
+			embedder: func(url, model string) Embedder { return NewOllamaClient(url, model) },
+		},
+		{
+			name:     ProviderOpenAI,
+			server:   func(t *testing.T) *httptest.Server { return fakeOpenAIServer(t, "secret") },
+			embedder: func(url, model string) Embedder { return NewOpenAIClient(url+"/v1/", model, "secret") },
+		},
+	}
+
+	for _, p := range providers {
+		t.Run(p.name, func(t *testing.T) {
+			server := p.server(t)
+			defer server.Close()
+
+			embedder := p.embedder(server.URL, "model")
+			if embedder.ModelName() != "model" {
+				t.Errorf("Expected model name 'model', got %q", embedder.ModelName())
+			}
+
+			vector, err := embedder.GetEmbedding(ctx, "hello")
+			if err != nil {
+				t.Fatalf("GetEmbedding failed: %v", err)
+			}
+			if len(vector) != 2 || vector[0] != 5 || vector[1] != 5 {
+				t.Errorf("Unexpected embedding %v", vector)
+			}
+
+			batch, err := embedder.GetEmbeddings(ctx, []string{"a", "abc", "ab"})
+			if err != nil {
+				t.Fatalf("GetEmbeddings failed: %v", err)
+			}
+			if len(batch) != 3 || batch[0][0] != 1 || batch[1][0] != 3 || batch[2][0] != 2 {
+				t.Errorf("Expected embeddings in input order, got %v", batch)
+			}
+
+			if empty, err := embedder.GetEmbeddings(ctx, nil); err != nil || empty != nil {
+				t.Errorf("Expected no embeddings for no texts, got %v, %v", empty, err)
+			}
+			if _, err := embedder.GetEmbedding(ctx, ""); err == nil {
+				t.Error("Expected error for empty text")
+			}
+			if _, err := embedder.GetEmbeddings(ctx, []string{"ok", ""}); err == nil {
+				t.Error("Expected error for empty text in batch")
+			}
+
+			// WithModel switches the model without touching the original
+			other := embedder.WithModel("other-model")
+			if vector, _ := other.GetEmbedding(ctx, "hello"); len(vector) != 2 || vector[1] != 11 {
+				t.Errorf("Expected embedding from other-model, got %v", vector)
+			}
+			if embedder.ModelName() != "model" || other.ModelName() != "other-model" {
+				t.Errorf("Unexpected model names %q and %q", embedder.ModelName(), other.ModelName())
+			}
+
+			_, err = embedder.WithModel("missing").GetEmbeddings(ctx, []string{"a"})
+			if err == nil || !strings.Contains(err.Error(), "model not found") {
+				t.Errorf("Expected API error message, got %v", err)
+			}
+
+			if _, err := embedder.WithModel("short").GetEmbeddings(ctx, []string{"a", "b"}); err == nil {
+				t.Error("Expected error for mismatched embedding count")
+			}
+
+			if err := TestConnection(ctx, embedder); err != nil {
+				t.Errorf("TestConnection failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewEmbedder(t *testing.T) {
+	if _, ok := mustNew(t, "").(*OllamaClient); !ok {
+		t.Error("Expected Ollama to be the default provider")
+	}
+	if _, ok := mustNew(t, "OpenAI").(*OpenAIClient); !ok {
+		t.Error("Expected an OpenAI-compatible client")
+	}
+	if _, err := New("bert", "http://localhost", "model", ""); err == nil {
+		t.Error("Expected error for unknown provider")
+	}
+}
+
+func mustNew(t *testing.T, provider string) Embedder {
+	embedder, err := New(provider, "http://localhost", "model", "")
+	if err != nil {
+		t.Fatalf("New(%q) failed: %v", provider, err)
+	}
+	return embedder
+}
@@ -0,0 +1,133 @@
+package embedding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// Embedder turns text into vectors. Implementations must be safe for
+// concurrent use and give up when the context is done.
+type Embedder interface {
+	// GetEmbedding embeds a single text.
+	GetEmbedding(ctx context.Context, text string) ([]float64, error)
+	// GetEmbeddings embeds several texts with a single request, returning
+	// one vector per text in the same order.
+	GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error)
+	// ModelName returns the model vectors are made with.
+	ModelName() string
+	// WithModel returns an embedder for the same service using another model.
+	WithModel(model string) Embedder
+}
+
+// Supported values of EMBEDDING_PROVIDER
+const (
+	ProviderOllama  = "ollama"
+	ProviderOpenAI  = "openai"  // any OpenAI-compatible /v1/embeddings server
+	ProviderHashing = "hashing" // offline feature hashing, see HashingEmbedder
+)
+
+// New returns the embedder of a provider
+func New(provider, baseURL, model, apiKey string) (Embedder, error) {
+	switch strings.ToLower(provider) {
+	case ProviderOllama, "":
+		return NewOllamaClient(baseURL, model), nil
+	case ProviderOpenAI:
+		return NewOpenAIClient(baseURL, model, apiKey), nil
+	case ProviderHashing:
+		return NewHashingEmbedder(model, HashingDimensions), nil
+	}
+	return nil, fmt.Errorf("unknown embedding provider %q, expected %s, %s or %s", provider, ProviderOllama, ProviderOpenAI, ProviderHashing)
+}
+
+// TestConnection checks that an embedder can embed a simple phrase
+func TestConnection(ctx context.Context, e Embedder) error {
+	if _, err := e.GetEmbedding(ctx, "test connection"); err != nil {
+		return fmt.Errorf("connection test failed: %w", err)
+	}
+	return nil
+}
+
+// checkTexts rejects empty texts, which the embedding APIs refuse
+func checkTexts(texts []string) error {
+	for i, text := range texts {
+		if text == "" {
+			return fmt.Errorf("text %d cannot be empty", i)
+		}
+	}
+	return nil
+}
+
+// APIError is returned when the embedding service answers with an error
+// status
+type APIError struct {
+	API        string
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s API error (%d): %s", e.API, e.StatusCode, e.Message)
+}
+
+// postJSON sends request as JSON and decodes a successful response into
+// response. Error responses are reported as an APIError with the message
+// apiError finds in their body, or the raw body if it finds none.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, request, response interface{}, apiName string, apiError func(body []byte) string) error {
+	jsonData, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = header.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		message := apiError(body)
+		if message == "" {
+			message = string(body)
+		}
+		return &APIError{API: apiName, StatusCode: resp.StatusCode, Message: message}
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+	return nil
+}
+
+// checkEmbeddings verifies that a response holds one non-empty vector per
+// text
+func checkEmbeddings(embeddings [][]float64, texts int) error {
+	if len(embeddings) != texts {
+		return fmt.Errorf("received %d embeddings for %d texts", len(embeddings), texts)
+	}
+	for i, embedding := range embeddings {
+		if len(embedding) == 0 {
+			return fmt.Errorf("received empty embedding for text %d", i)
+		}
+	}
+	return nil
+}
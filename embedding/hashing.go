@@ -0,0 +1,114 @@
+package embedding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// HashingDimensions is the vector size of the hashing provider
+const HashingDimensions = 384
+
+// HashingEmbedder embeds text locally without a model: words and their
+// character trigrams are hashed into a fixed number of buckets (feature
+// hashing). Texts sharing words or word fragments get similar vectors, so
+// keyword-like matches work without network access, e.g. in tests and
+// air-gapped deployments. It does not capture meaning like a real model.
+type HashingEmbedder struct {
+	Model      string // label only, vectors don't depend on it
+	Dimensions int
+}
+
+func NewHashingEmbedder(model string, dimensions int) *HashingEmbedder {
+	if dimensions <= 0 {
+		dimensions = HashingDimensions
+	}
+	return &HashingEmbedder{
+		Model:      model,
+		Dimensions: dimensions,
+	}
+}
+
+func (h *HashingEmbedder) ModelName() string {
+	return h.Model
+}
+
+func (h *HashingEmbedder) WithModel(model string) Embedder {
+	clone := *h
+	clone.Model = model
+	return &clone
+}
+
+func (h *HashingEmbedder) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(words) == 0 {
+		// Only punctuation or symbols, hash them as they are
+		words = []string{strings.TrimSpace(text)}
+	}
+
+	vector := make([]float64, h.Dimensions)
+	for _, word := range words {
+		h.addFeature(vector, "w:"+word, 1)
+
+		runes := []rune(" " + word + " ")
+		for i := 0; i+3 <= len(runes); i++ {
+			h.addFeature(vector, "t:"+string(runes[i:i+3]), 0.5)
+		}
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm == 0 {
+		return nil, fmt.Errorf("text has no features to embed")
+	}
+
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] /= norm
+	}
+	return vector, nil
+}
+
+func (h *HashingEmbedder) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := checkTexts(texts); err != nil {
+		return nil, err
+	}
+
+	embeddings := make([][]float64, len(texts))
+	for i, text := range texts {
+		embedding, err := h.GetEmbedding(ctx, text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed text %d: %w", i, err)
+		}
+		embeddings[i] = embedding
+	}
+	return embeddings, nil
+}
+
+// addFeature adds weight to the bucket of a feature, with a sign taken from
+// the hash so collisions tend to cancel out
+func (h *HashingEmbedder) addFeature(vector []float64, feature string, weight float64) {
+	hash := fnv.New64a()
+	hash.Write([]byte(feature))
+	sum := hash.Sum64()
+
+	bucket := int(sum % uint64(len(vector)))
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	vector[bucket] += weight
+}
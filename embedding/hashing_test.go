@@ -0,0 +1,61 @@
+package embedding
+
+import (
+	"context"
+	"math"
+	"testing"
+)
+
+func cosine(a, b []float64) float64 {
+	var dot float64
+	for i := range a {
+		dot += a[i] * b[i]
+	}
+	return dot // vectors are normalized
+}
+
+func TestHashingEmbedder(t *testing.T) {
+	ctx := context.Background()
+	embedder := NewHashingEmbedder("hashing", 0)
+	if embedder.Dimensions != HashingDimensions {
+		t.Errorf("Expected %d dimensions by default, got %d", HashingDimensions, embedder.Dimensions)
+	}
+
+	first, err := embedder.GetEmbedding(ctx, "The deploy to production failed")
+	if err != nil {
+		t.Fatalf("GetEmbedding failed: %v", err)
+	}
+	again, _ := embedder.GetEmbedding(ctx, "the DEPLOY to production failed!")
+	if len(first) != HashingDimensions || math.Abs(cosine(first, again)-1) > 1e-9 {
+		t.Error("Expected identical vectors for texts differing only in case and punctuation")
+	}
+
+	var norm float64
+	for _, v := range first {
+		norm += v * v
+	}
+	if math.Abs(norm-1) > 1e-9 {
+		t.Errorf("Expected a unit vector, got norm %f", norm)
+	}
+
+	related, _ := embedder.GetEmbedding(ctx, "production deployment failing again")
+	unrelated, _ := embedder.GetEmbedding(ctx, "pizza for lunch tomorrow?")
+	if cosine(first, related) <= cosine(first, unrelated) {
+		t.Errorf("Expected overlapping texts to be closer: related %f, unrelated %f", cosine(first, related), cosine(first, unrelated))
+	}
+
+	if symbols, err := embedder.GetEmbedding(ctx, "?!"); err != nil || len(symbols) != HashingDimensions {
+		t.Errorf("Expected punctuation-only text to embed, got %v", err)
+	}
+	if _, err := embedder.GetEmbedding(ctx, ""); err == nil {
+		t.Error("Expected error for empty text")
+	}
+
+	batch, err := embedder.WithModel("other").GetEmbeddings(ctx, []string{"The deploy to production failed", "pizza for lunch tomorrow?"})
+	if err != nil {
+		t.Fatalf("GetEmbeddings failed: %v", err)
+	}
+	if len(batch) != 2 || math.Abs(cosine(batch[0], first)-1) > 1e-9 {
+		t.Error("Expected batch embeddings to match single ones and not depend on the model name")
+	}
+}
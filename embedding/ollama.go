@@ -0,0 +1,135 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// OllamaClient embeds text with an Ollama server
+type OllamaClient struct {
+	BaseURL    string
+	Model      string
+	HTTPClient *http.Client
+}
+
+type OllamaEmbeddingRequest struct {
+	Model  string `json:"model"`
+	Prompt string `json:"prompt"`
+}
+
+type OllamaEmbeddingResponse struct {
+	Embedding []float64 `json:"embedding"`
+}
+
+// OllamaBatchEmbeddingRequest is the body of /api/embed, which embeds
+// several inputs in one call
+type OllamaBatchEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OllamaBatchEmbeddingResponse struct {
+	Embeddings [][]float64 `json:"embeddings"`
+}
+
+type OllamaErrorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewOllamaClient(baseURL, model string) *OllamaClient {
+	return &OllamaClient{
+		BaseURL: baseURL,
+		Model:   model,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (c *OllamaClient) ModelName() string {
+	return c.Model
+}
+
+func (c *OllamaClient) WithModel(model string) Embedder {
+	clone := *c
+	clone.Model = model
+	return &clone
+}
+
+func (c *OllamaClient) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	var embeddingResp OllamaEmbeddingResponse
+	url := fmt.Sprintf("%s/api/embeddings", c.BaseURL)
+	if err := c.post(ctx, url, OllamaEmbeddingRequest{Model: c.Model, Prompt: text}, &embeddingResp); err != nil {
+		return nil, err
+	}
+
+	if len(embeddingResp.Embedding) == 0 {
+		return nil, fmt.Errorf("received empty embedding from API")
+	}
+
+	return embeddingResp.Embedding, nil
+}
+
+// GetEmbeddings embeds several texts with a single /api/embed request
+func (c *OllamaClient) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := checkTexts(texts); err != nil {
+		return nil, err
+	}
+
+	var embeddingResp OllamaBatchEmbeddingResponse
+	url := fmt.Sprintf("%s/api/embed", c.BaseURL)
+	if err := c.post(ctx, url, OllamaBatchEmbeddingRequest{Model: c.Model, Input: texts}, &embeddingResp); err != nil {
+		return nil, err
+	}
+
+	if err := checkEmbeddings(embeddingResp.Embeddings, len(texts)); err != nil {
+		return nil, err
+	}
+	return embeddingResp.Embeddings, nil
+}
+
+func (c *OllamaClient) post(ctx context.Context, url string, request, response interface{}) error {
+	return postJSON(ctx, c.HTTPClient, url, nil, request, response, "ollama", func(body []byte) string {
+		var errorResp OllamaErrorResponse
+		if err := json.Unmarshal(body, &errorResp); err != nil {
+			return ""
+		}
+		return errorResp.Error
+	})
+}
+
+func (c *OllamaClient) GetModelInfo(ctx context.Context) (string, error) {
+	url := fmt.Sprintf("%s/api/tags", c.BaseURL)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get model info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("API returned status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return string(body), nil
+}
@@ -0,0 +1,74 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetEmbeddingsBatch(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/embed" {
+			t.Errorf("Expected /api/embed, got %s", r.URL.Path)
+		}
+
+		var req OllamaBatchEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("Failed to decode request: %v", err)
+		}
+		if req.Model != "test-model" {
+			t.Errorf("Expected model test-model, got %s", req.Model)
+		}
+
+		// Echo the length of each input so the order can be checked
+		var resp OllamaBatchEmbeddingResponse
+		for _, input := range req.Input {
+			resp.Embeddings = append(resp.Embeddings, []float64{float64(len(input)), 1})
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer server.Close()
+
+	client := NewOllamaClient(server.URL, "test-model")
+	embeddings, err := client.GetEmbeddings(ctx, []string{"a", "abc", "ab"})
+	if err != nil {
+		t.Fatalf("GetEmbeddings failed: %v", err)
+	}
+
+	if len(embeddings) != 3 || embeddings[0][0] != 1 || embeddings[1][0] != 3 || embeddings[2][0] != 2 {
+		t.Errorf("Expected embeddings in input order, got %v", embeddings)
+	}
+
+	if _, err := client.GetEmbeddings(ctx, []string{"ok", ""}); err == nil {
+		t.Error("Expected error for empty text")
+	}
+}
+
+func TestGetEmbeddingsErrors(t *testing.T) {
+	ctx := context.Background()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req OllamaBatchEmbeddingRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		if req.Model == "missing" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(OllamaErrorResponse{Error: "model not found"})
+			return
+		}
+
+		// Return fewer embeddings than inputs
+		json.NewEncoder(w).Encode(OllamaBatchEmbeddingResponse{Embeddings: [][]float64{{1}}})
+	}))
+	defer server.Close()
+
+	if _, err := NewOllamaClient(server.URL, "missing").GetEmbeddings(ctx, []string{"a"}); err == nil {
+		t.Error("Expected error for API error response")
+	}
+
+	if _, err := NewOllamaClient(server.URL, "short").GetEmbeddings(ctx, []string{"a", "b"}); err == nil {
+		t.Error("Expected error for mismatched embedding count")
+	}
+}
@@ -0,0 +1,118 @@
+package embedding
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OpenAIClient embeds text with a server implementing OpenAI's
+// /v1/embeddings API, such as llama.cpp server, vLLM or LocalAI
+type OpenAIClient struct {
+	BaseURL    string // without the /v1 suffix
+	Model      string
+	APIKey     string // sent as a bearer token if set
+	HTTPClient *http.Client
+}
+
+type OpenAIEmbeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []OpenAIEmbedding `json:"data"`
+}
+
+type OpenAIEmbedding struct {
+	Index     int       `json:"index"`
+	Embedding []float64 `json:"embedding"`
+}
+
+type OpenAIErrorResponse struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func NewOpenAIClient(baseURL, model, apiKey string) *OpenAIClient {
+	return &OpenAIClient{
+		BaseURL: strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1"),
+		Model:   model,
+		APIKey:  apiKey,
+		HTTPClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (c *OpenAIClient) ModelName() string {
+	return c.Model
+}
+
+func (c *OpenAIClient) WithModel(model string) Embedder {
+	clone := *c
+	clone.Model = model
+	return &clone
+}
+
+func (c *OpenAIClient) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+
+	embeddings, err := c.GetEmbeddings(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (c *OpenAIClient) GetEmbeddings(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+	if err := checkTexts(texts); err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	if c.APIKey != "" {
+		header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+
+	var embeddingResp OpenAIEmbeddingResponse
+	url := fmt.Sprintf("%s/v1/embeddings", c.BaseURL)
+	err := postJSON(ctx, c.HTTPClient, url, header, OpenAIEmbeddingRequest{Model: c.Model, Input: texts}, &embeddingResp, "embeddings", func(body []byte) string {
+		var errorResp OpenAIErrorResponse
+		if err := json.Unmarshal(body, &errorResp); err != nil {
+			return ""
+		}
+		return errorResp.Error.Message
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Results carry their input position and may come back in any order
+	sort.Slice(embeddingResp.Data, func(i, j int) bool {
+		return embeddingResp.Data[i].Index < embeddingResp.Data[j].Index
+	})
+
+	embeddings := make([][]float64, len(embeddingResp.Data))
+	for i, data := range embeddingResp.Data {
+		if data.Index != i {
+			return nil, fmt.Errorf("missing embedding for text %d", i)
+		}
+		embeddings[i] = data.Embedding
+	}
+
+	if err := checkEmbeddings(embeddings, len(texts)); err != nil {
+		return nil, err
+	}
+	return embeddings, nil
+}
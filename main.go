@@ -34,7 +34,8 @@ func main() {
 		log.Fatalf("Failed to initialize bot: %v", err)
 	}
 
-	// Handle graceful shutdown
+	// Handle graceful shutdown: Stop drains in-flight work, then Start
+	// returns and the database is closed
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
@@ -42,13 +43,12 @@ func main() {
 		<-c
 		log.Println("Received shutdown signal")
 		telegramBot.Stop()
-		os.Exit(0)
 	}()
 
 	// Start bot
 	log.Println("Starting Semantic Search Bot...")
 	log.Printf("Embedding model: %s", cfg.EmbeddingModel)
-	log.Printf("Embedding API: %s", cfg.EmbeddingAPIURL)
+	log.Printf("Embedding API: %s (%s)", cfg.EmbeddingAPIURL, cfg.EmbeddingProvider)
 	log.Printf("Max search results: %d", cfg.MaxResults)
 	log.Println("Use /start command to interact with the bot")
 	log.Println("Use /search <query> to perform semantic search!")
@@ -56,4 +56,5 @@ func main() {
 	if err := telegramBot.Start(); err != nil {
 		log.Fatalf("Bot failed: %v", err)
 	}
+	log.Println("Bot stopped")
 }
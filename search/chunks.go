@@ -0,0 +1,146 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"sort"
+)
+
+// passageMatch is a match against part or an earlier version of a message.
+// source and page tell where a chunk came from.
+type passageMatch struct {
+	messageID  int64
+	text       string
+	source     string
+	page       int
+	similarity float64
+}
+
+// chunkMatch scores a chunk as a passage of its message
+func chunkMatch(chunk database.MessageChunk, similarity float64) passageMatch {
+	return passageMatch{messageID: chunk.MessageID, text: chunk.Text, source: chunk.Source, page: chunk.Page, similarity: similarity}
+}
+
+// IndexChunks adds the stored chunks of a message to its chat's chunk index
+func (e *Engine) IndexChunks(chunks []database.MessageChunk) {
+	for _, chunk := range chunks {
+		if err := e.chunkIndex(chunk.ChatID).Add(chunk.ID, chunk.Embedding); err != nil {
+			log.Printf("Error indexing chunk %d of message %d: %v", chunk.ID, chunk.MessageID, err)
+		}
+	}
+}
+
+// chunkIndex returns the chunk index of a chat, creating an empty one if
+// needed
+func (e *Engine) chunkIndex(chatID int64) VectorIndex {
+	return e.indexIn(e.chunkIndexes, chatID)
+}
+
+// rebuildChunkIndex replaces a chat's chunk index with one built from the
+// stored chunk vectors of model
+func (e *Engine) rebuildChunkIndex(ctx context.Context, chatID int64, model string) error {
+	chunks, err := e.db.GetChunksWithEmbeddings(ctx, chatID, model)
+	if err != nil {
+		return fmt.Errorf("failed to load message chunks for chat %d: %w", chatID, err)
+	}
+
+	index := e.newIndex()
+	for _, chunk := range chunks {
+		if err := index.Add(chunk.ID, chunk.Embedding); err != nil {
+			log.Printf("Skipping chunk %d in index for chat %d: %v", chunk.ID, chatID, err)
+		}
+	}
+
+	e.mutex.Lock()
+	e.chunkIndexes[chatID] = index
+	e.mutex.Unlock()
+	return nil
+}
+
+// withChunkMatches merges matches against the chunks of long messages and
+// attached files into neighbors, like nearestMessages does for whole
+// messages: through the chat's chunk index, or by scoring the chunks of the
+// messages the filter selects. The returned map holds the chunk for messages
+// whose best match was one of their chunks.
+func (e *Engine) withChunkMatches(ctx context.Context, neighbors []Neighbor, vector []float64, model string, chatID int64, filter database.MessageFilter, k int) ([]Neighbor, map[int64]passageMatch, error) {
+	var matches []passageMatch
+	if filter.IsEmpty() {
+		index := e.chunkIndex(chatID)
+		if index.Len() == 0 {
+			return neighbors, nil, nil
+		}
+
+		// Chunks of the same message often rank together, ask for extra ones
+		hits := index.Query(vector, k*2)
+		ids := make([]int64, len(hits))
+		for i, hit := range hits {
+			ids[i] = hit.ID
+		}
+		chunks, err := e.db.GetChunksByIDs(ctx, ids)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve message chunks: %w", err)
+		}
+
+		byID := make(map[int64]database.MessageChunk, len(chunks))
+		for _, chunk := range chunks {
+			byID[chunk.ID] = chunk
+		}
+		for _, hit := range hits {
+			chunk, ok := byID[hit.ID]
+			if !ok {
+				// The message was edited or deleted since it was indexed
+				index.Remove(hit.ID)
+				continue
+			}
+			matches = append(matches, chunkMatch(chunk, hit.Similarity))
+		}
+	} else {
+		chunks, err := e.db.FilterChunksWithEmbeddings(ctx, chatID, model, filter)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to retrieve message chunks: %w", err)
+		}
+		for _, chunk := range chunks {
+			matches = append(matches, chunkMatch(chunk, cosineSimilarity(vector, chunk.Embedding)))
+		}
+	}
+
+	merged, passages := mergeMatches(neighbors, matches, k)
+	return merged, passages, nil
+}
+
+// mergeMatches merges passage matches into neighbors, keeping each
+// message's best similarity, and returns the k best along with the passages
+// that beat their message's own vector
+func mergeMatches(neighbors []Neighbor, matches []passageMatch, k int) ([]Neighbor, map[int64]passageMatch) {
+	best := make(map[int64]float64, len(neighbors)+len(matches))
+	for _, n := range neighbors {
+		best[n.ID] = n.Similarity
+	}
+
+	passages := make(map[int64]passageMatch)
+	for _, match := range matches {
+		if current, seen := best[match.messageID]; !seen || match.similarity > current {
+			best[match.messageID] = match.similarity
+			passages[match.messageID] = match
+		}
+	}
+
+	merged := make([]Neighbor, 0, len(best))
+	for id, similarity := range best {
+		merged = append(merged, Neighbor{ID: id, Similarity: similarity})
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		if merged[i].Similarity != merged[j].Similarity {
+			return merged[i].Similarity > merged[j].Similarity
+		}
+		return merged[i].ID > merged[j].ID
+	})
+
+	if len(merged) > k {
+		merged = merged[:k]
+	}
+	return merged, passages
+}
@@ -0,0 +1,26 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"semantic-search-bot/database"
+)
+
+// withEditMatches merges matches against earlier versions of edited
+// messages whose vectors were made with model into neighbors. Each message
+// keeps its best similarity across versions; the returned map holds the
+// earlier version for messages whose best match was a previous version.
+func (e *Engine) withEditMatches(ctx context.Context, neighbors []Neighbor, vector []float64, model string, chatID int64, filter database.MessageFilter, k int) ([]Neighbor, map[int64]passageMatch, error) {
+	edits, err := e.db.FilterEditsWithEmbeddings(ctx, chatID, model, filter)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to retrieve edit history: %w", err)
+	}
+
+	matches := make([]passageMatch, len(edits))
+	for i, edit := range edits {
+		matches[i] = passageMatch{messageID: edit.MessageID, text: edit.Text, similarity: cosineSimilarity(vector, edit.Embedding)}
+	}
+
+	merged, priorVersions := mergeMatches(neighbors, matches, k)
+	return merged, priorVersions, nil
+}
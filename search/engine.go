@@ -1,95 +1,503 @@
 package search
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"math"
 	"semantic-search-bot/database"
 	"semantic-search-bot/embedding"
 	"sort"
 	"strings"
+	"sync"
 )
 
 type Engine struct {
 	db         *database.DB
-	embedding  *embedding.Client
+	embedding  embedding.Embedder
 	maxResults int
+
+	indexes      map[int64]VectorIndex // per chat
+	chunkIndexes map[int64]VectorIndex // chunks of long messages, per chat
+	newIndex     func() VectorIndex
+	mutex        sync.RWMutex
+
+	// windows ranks conversation windows in semantic searches, see
+	// EnableConversationWindows
+	windows       bool
+	windowIndexes map[int64]VectorIndex // per chat
 }
 
 type SearchResult struct {
-	Message    database.Message
-	Similarity float64
-	Rank       int
+	Message      database.Message
+	Similarity   float64 // cosine similarity to the query, 0 if unknown
+	Score        float64 // fused ranking score in hybrid mode
+	KeywordMatch bool    // the message matched the query's keywords
+	PriorVersion string  // text of the earlier version that matched, if any
+	Passage      string  // chunk of a long message or attached file that matched, if any
+	Rank         int
+
+	// PassageSource is database.ChunkFromDocument when Passage comes from an
+	// attached file, PassagePage being its page or 0 for files without pages
+	PassageSource string
+	PassagePage   int
+
+	// Snippet is the conversation window that matched, Message being its
+	// line closest to the query; empty unless windows are enabled
+	Snippet []database.Message
 }
 
-func NewEngine(db *database.DB, embeddingClient *embedding.Client, maxResults int) *Engine {
+func NewEngine(db *database.DB, embeddingClient embedding.Embedder, maxResults int) *Engine {
 	return &Engine{
 		db:         db,
 		embedding:  embeddingClient,
 		maxResults: maxResults,
+		indexes:    make(map[int64]VectorIndex),
+		newIndex:   func() VectorIndex { return NewHNSWIndex() },
+
+		chunkIndexes:  make(map[int64]VectorIndex),
+		windowIndexes: make(map[int64]VectorIndex),
+	}
+}
+
+// BuildIndexes loads every stored embedding into per-chat vector indexes.
+// It is meant to be called once at startup, before messages are indexed.
+func (e *Engine) BuildIndexes(ctx context.Context) error {
+	chatIDs, err := e.db.GetChatIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list chats: %w", err)
+	}
+
+	for _, chatID := range chatIDs {
+		if err := e.RebuildIndex(ctx, chatID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RebuildIndex replaces a chat's vector index with one built from the
+// stored embeddings of its active model, e.g. after switching models
+func (e *Engine) RebuildIndex(ctx context.Context, chatID int64) error {
+	model, err := e.activeModel(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	messages, err := e.db.GetMessagesWithEmbeddings(ctx, chatID, model)
+	if err != nil {
+		return fmt.Errorf("failed to load embeddings for chat %d: %w", chatID, err)
+	}
+
+	index := e.newIndex()
+	for _, msg := range messages {
+		if err := index.Add(msg.ID, msg.Embedding); err != nil {
+			log.Printf("Skipping message %d in index for chat %d: %v", msg.ID, chatID, err)
+		}
+	}
+
+	e.mutex.Lock()
+	e.indexes[chatID] = index
+	e.mutex.Unlock()
+
+	if err := e.rebuildChunkIndex(ctx, chatID, model); err != nil {
+		return err
+	}
+	if e.windows {
+		return e.rebuildWindowIndex(ctx, chatID, model)
+	}
+	return nil
+}
+
+// activeModel returns the embedding model whose vectors serve a chat's
+// searches. Chats without vectors use the configured model.
+func (e *Engine) activeModel(ctx context.Context, chatID int64) (string, error) {
+	state, err := e.db.GetEmbeddingModelState(ctx, chatID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read embedding model of chat %d: %w", chatID, err)
+	}
+	if state.Active == "" {
+		return e.embedding.ModelName(), nil
+	}
+	return state.Active, nil
+}
+
+// embedQuery embeds a query with the chat's active model so it can be
+// compared with the chat's vectors
+func (e *Engine) embedQuery(ctx context.Context, query string, chatID int64) ([]float64, string, error) {
+	model, err := e.activeModel(ctx, chatID)
+	if err != nil {
+		return nil, "", err
+	}
+
+	vector, err := e.embedding.WithModel(model).GetEmbedding(ctx, query)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	return vector, model, nil
+}
+
+// IndexMessage adds a stored message to its chat's vector index
+func (e *Engine) IndexMessage(msg database.Message) error {
+	if len(msg.Embedding) == 0 {
+		return nil
+	}
+	return e.chatIndex(msg.ChatID).Add(msg.ID, msg.Embedding)
+}
+
+// RemoveMessage drops a message from its chat's vector index
+func (e *Engine) RemoveMessage(chatID, messageID int64) {
+	e.chatIndex(chatID).Remove(messageID)
+}
+
+// chatIndex returns the vector index of a chat, creating an empty one if needed
+func (e *Engine) chatIndex(chatID int64) VectorIndex {
+	return e.indexIn(e.indexes, chatID)
+}
+
+// windowIndex returns the conversation window index of a chat, creating an
+// empty one if needed
+func (e *Engine) windowIndex(chatID int64) VectorIndex {
+	return e.indexIn(e.windowIndexes, chatID)
+}
+
+func (e *Engine) indexIn(indexes map[int64]VectorIndex, chatID int64) VectorIndex {
+	e.mutex.RLock()
+	index, exists := indexes[chatID]
+	e.mutex.RUnlock()
+	if exists {
+		return index
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if index, exists = indexes[chatID]; !exists {
+		index = e.newIndex()
+		indexes[chatID] = index
 	}
+	return index
+}
+
+// SearchOptions tunes a single Search call
+type SearchOptions struct {
+	Mode   Mode                   // defaults to ModeSemantic
+	Filter database.MessageFilter // applied in SQL before scoring
+	Limit  int                    // maximum results, defaults to the engine's maxResults
+
+	// IncludeEdits also matches earlier versions of edited messages
+	IncludeEdits bool
 }
 
-func (e *Engine) Search(query string, chatID int64) ([]SearchResult, error) {
-	if strings.TrimSpace(query) == "" {
+// Search ranks the messages of a chat against query. With an empty query
+// and a non-empty filter it returns the newest messages matching the filter.
+func (e *Engine) Search(ctx context.Context, query string, chatID int64, opts SearchOptions) ([]SearchResult, error) {
+	if strings.TrimSpace(query) == "" && opts.Filter.IsEmpty() {
 		return nil, fmt.Errorf("search query cannot be empty")
 	}
 
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = e.maxResults
+	}
+
+	var results []SearchResult
+	var err error
+	switch {
+	case strings.TrimSpace(query) == "":
+		results, err = e.filterSearch(ctx, chatID, opts.Filter, limit)
+	case opts.Mode == ModeKeyword:
+		results, err = e.keywordSearch(ctx, query, chatID, opts.Filter, limit)
+	case opts.Mode == ModeHybrid:
+		results, err = e.hybridSearch(ctx, query, chatID, opts, limit)
+	case e.usesWindows(chatID, opts):
+		results, err = e.windowSearch(ctx, query, chatID, limit)
+	default:
+		results, err = e.semanticSearch(ctx, query, chatID, opts, limit)
+	}
+	if errors.Is(err, embedding.ErrCircuitOpen) {
+		// The embedding service is down, keywords still work without it
+		log.Printf("Embedding service unavailable, falling back to keyword search: %v", err)
+		results, err = e.keywordSearch(ctx, query, chatID, opts.Filter, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Limit results and add ranking
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	for i := range results {
+		results[i].Rank = i + 1
+	}
+
+	return results, nil
+}
+
+// setPassage fills in the earlier version or, failing that, the chunk that
+// matched the result's message
+func (r *SearchResult) setPassage(priorVersions, passages map[int64]passageMatch) {
+	if prior, ok := priorVersions[r.Message.ID]; ok {
+		r.PriorVersion = prior.text
+		return
+	}
+	if passage, ok := passages[r.Message.ID]; ok {
+		r.Passage, r.PassageSource, r.PassagePage = passage.text, passage.source, passage.page
+	}
+}
+
+// usesWindows reports whether a semantic search ranks conversation windows.
+// Filters and edit history apply to single messages, so searches using them
+// rank messages, as do chats without windows yet.
+func (e *Engine) usesWindows(chatID int64, opts SearchOptions) bool {
+	return e.windows && opts.Filter.IsEmpty() && !opts.IncludeEdits && e.windowIndex(chatID).Len() > 0
+}
+
+func (e *Engine) semanticSearch(ctx context.Context, query string, chatID int64, opts SearchOptions, limit int) ([]SearchResult, error) {
 	// Generate embedding for the search query
-	queryEmbedding, err := e.embedding.GetEmbedding(query)
+	queryEmbedding, model, err := e.embedQuery(ctx, query, chatID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
+		return nil, err
 	}
 
-	// Get all messages with embeddings from the chat
-	messages, err := e.db.GetMessagesWithEmbeddings(chatID)
+	neighbors, err := e.nearestMessages(ctx, queryEmbedding, model, chatID, opts.Filter, limit)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+		return nil, err
 	}
 
-	if len(messages) == 0 {
-		return []SearchResult{}, nil
+	neighbors, passages, err := e.withChunkMatches(ctx, neighbors, queryEmbedding, model, chatID, opts.Filter, limit)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate similarities and create results
-	var results []SearchResult
+	var priorVersions map[int64]passageMatch
+	if opts.IncludeEdits {
+		neighbors, priorVersions, err = e.withEditMatches(ctx, neighbors, queryEmbedding, model, chatID, opts.Filter, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	results, err := e.resolveNeighbors(ctx, neighbors, 0.1, 0) // Filter out very low similarities
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range results {
+		results[i].setPassage(priorVersions, passages)
+	}
+	return results, nil
+}
+
+// nearestMessages finds the k messages most similar to vector, which was
+// made with model. Unfiltered queries go through the chat's vector index;
+// filtered ones score only the rows the filter selects in SQL.
+func (e *Engine) nearestMessages(ctx context.Context, vector []float64, model string, chatID int64, filter database.MessageFilter, k int) ([]Neighbor, error) {
+	if filter.IsEmpty() {
+		return e.chatIndex(chatID).Query(vector, k), nil
+	}
+
+	messages, err := e.db.FilterMessagesWithEmbeddings(ctx, chatID, model, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	neighbors := make([]Neighbor, 0, len(messages))
 	for _, msg := range messages {
-		if len(msg.Embedding) == 0 {
-			continue // Skip messages without embeddings
+		neighbors = append(neighbors, Neighbor{ID: msg.ID, Similarity: cosineSimilarity(vector, msg.Embedding)})
+	}
+
+	sort.Slice(neighbors, func(i, j int) bool {
+		return neighbors[i].Similarity > neighbors[j].Similarity
+	})
+
+	if len(neighbors) > k {
+		neighbors = neighbors[:k]
+	}
+	return neighbors, nil
+}
+
+func (e *Engine) keywordSearch(ctx context.Context, query string, chatID int64, filter database.MessageFilter, limit int) ([]SearchResult, error) {
+	matches, err := e.db.KeywordSearch(ctx, chatID, query, filter, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run keyword search: %w", err)
+	}
+
+	ids := make([]int64, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+
+	messages, err := e.loadMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, id := range ids {
+		if msg, ok := messages[id]; ok {
+			results = append(results, SearchResult{Message: msg, KeywordMatch: true})
 		}
+	}
 
-		similarity := cosineSimilarity(queryEmbedding, msg.Embedding)
-		if similarity > 0.1 { // Filter out very low similarities
-			results = append(results, SearchResult{
-				Message:    msg,
-				Similarity: similarity,
-			})
+	return results, nil
+}
+
+// hybridSearch fuses the semantic and keyword rankings with reciprocal rank
+// fusion, so exact identifiers surface even when their embeddings are vague
+func (e *Engine) hybridSearch(ctx context.Context, query string, chatID int64, opts SearchOptions, limit int) ([]SearchResult, error) {
+	queryEmbedding, model, err := e.embedQuery(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := max(limit, hybridCandidates)
+	neighbors, err := e.nearestMessages(ctx, queryEmbedding, model, chatID, opts.Filter, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	neighbors, passages, err := e.withChunkMatches(ctx, neighbors, queryEmbedding, model, chatID, opts.Filter, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var priorVersions map[int64]passageMatch
+	if opts.IncludeEdits {
+		neighbors, priorVersions, err = e.withEditMatches(ctx, neighbors, queryEmbedding, model, chatID, opts.Filter, candidates)
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	// Sort by similarity (highest first)
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
-	})
+	var semanticRanking []int64
+	similarities := make(map[int64]float64, len(neighbors))
+	for _, n := range neighbors {
+		if n.Similarity > 0.1 {
+			semanticRanking = append(semanticRanking, n.ID)
+			similarities[n.ID] = n.Similarity
+		}
+	}
 
-	// Limit results and add ranking
-	if len(results) > e.maxResults {
-		results = results[:e.maxResults]
+	matches, err := e.db.KeywordSearch(ctx, chatID, query, opts.Filter, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to run keyword search: %w", err)
 	}
 
-	for i := range results {
-		results[i].Rank = i + 1
+	keywordRanking := make([]int64, len(matches))
+	keywordMatched := make(map[int64]bool, len(matches))
+	for i, match := range matches {
+		keywordRanking[i] = match.ID
+		keywordMatched[match.ID] = true
+	}
+
+	fused := reciprocalRankFusion(semanticRanking, keywordRanking)
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+
+	ids := make([]int64, len(fused))
+	for i, f := range fused {
+		ids[i] = f.id
+	}
+
+	messages, err := e.loadMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, f := range fused {
+		msg, ok := messages[f.id]
+		if !ok {
+			continue
+		}
+		similarity, ok := similarities[f.id]
+		if !ok {
+			similarity = cosineSimilarity(queryEmbedding, msg.Embedding)
+		}
+		result := SearchResult{
+			Message:      msg,
+			Similarity:   similarity,
+			Score:        f.score,
+			KeywordMatch: keywordMatched[f.id],
+		}
+		result.setPassage(priorVersions, passages)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+// filterSearch lists the newest messages matching a filter, for queries
+// made of operators only
+func (e *Engine) filterSearch(ctx context.Context, chatID int64, filter database.MessageFilter, limit int) ([]SearchResult, error) {
+	messages, err := e.db.FilterRecentMessages(ctx, chatID, filter, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	results := make([]SearchResult, len(messages))
+	for i, msg := range messages {
+		results[i] = SearchResult{Message: msg}
+	}
+	return results, nil
+}
+
+// resolveNeighbors loads the messages behind index results, keeping the
+// index order and dropping results below minSimilarity or matching skipID
+func (e *Engine) resolveNeighbors(ctx context.Context, neighbors []Neighbor, minSimilarity float64, skipID int64) ([]SearchResult, error) {
+	var ids []int64
+	for _, n := range neighbors {
+		if n.ID != skipID && n.Similarity > minSimilarity {
+			ids = append(ids, n.ID)
+		}
+	}
+
+	messages, err := e.loadMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	for _, n := range neighbors {
+		msg, ok := messages[n.ID]
+		if !ok || n.ID == skipID || n.Similarity <= minSimilarity {
+			continue // Skip filtered results and rows deleted since indexing
+		}
+		results = append(results, SearchResult{
+			Message:    msg,
+			Similarity: n.Similarity,
+		})
 	}
 
 	return results, nil
 }
 
-func (e *Engine) SearchStats(chatID int64) (int, int, error) {
-	totalMessages, err := e.db.GetStats(chatID)
+// loadMessages fetches messages by ID, keyed by ID
+func (e *Engine) loadMessages(ctx context.Context, ids []int64) (map[int64]database.Message, error) {
+	messages, err := e.db.GetMessagesByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+	}
+
+	byID := make(map[int64]database.Message, len(messages))
+	for _, msg := range messages {
+		byID[msg.ID] = msg
+	}
+	return byID, nil
+}
+
+func (e *Engine) SearchStats(ctx context.Context, chatID int64) (int, int, error) {
+	totalMessages, err := e.db.GetStats(ctx, chatID)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	messagesWithEmbeddings, err := e.db.GetStatsWithEmbeddings(chatID)
+	messagesWithEmbeddings, err := e.db.GetStatsWithEmbeddings(ctx, chatID)
 	if err != nil {
 		return totalMessages, 0, err
 	}
@@ -118,9 +526,9 @@ func cosineSimilarity(a, b []float64) float64 {
 }
 
 // GetSimilarMessages finds messages similar to a given message
-func (e *Engine) GetSimilarMessages(messageID int64, chatID int64) ([]SearchResult, error) {
+func (e *Engine) GetSimilarMessages(ctx context.Context, messageID int64, chatID int64) ([]SearchResult, error) {
 	// Get the source message
-	sourceMessages, err := e.db.GetMessagesByIDs([]int64{messageID})
+	sourceMessages, err := e.db.GetMessagesByIDs(ctx, []int64{messageID})
 	if err != nil || len(sourceMessages) == 0 {
 		return nil, fmt.Errorf("source message not found")
 	}
@@ -130,34 +538,24 @@ func (e *Engine) GetSimilarMessages(messageID int64, chatID int64) ([]SearchResu
 		return nil, fmt.Errorf("source message has no embedding")
 	}
 
-	// Get all other messages with embeddings
-	messages, err := e.db.GetMessagesWithEmbeddings(chatID)
+	model, err := e.activeModel(ctx, chatID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve messages: %w", err)
+		return nil, err
+	}
+	if sourceMsg.EmbeddingModel != model {
+		return nil, fmt.Errorf("source message was embedded with %s, not %s", sourceMsg.EmbeddingModel, model)
 	}
 
-	var results []SearchResult
-	for _, msg := range messages {
-		if msg.ID == messageID || len(msg.Embedding) == 0 {
-			continue // Skip the source message and messages without embeddings
-		}
+	// Ask for one extra neighbour since the source message matches itself
+	maxSimilar := 3
+	neighbors := e.chatIndex(chatID).Query(sourceMsg.Embedding, maxSimilar+1)
 
-		similarity := cosineSimilarity(sourceMsg.Embedding, msg.Embedding)
-		if similarity > 0.3 { // Higher threshold for similar messages
-			results = append(results, SearchResult{
-				Message:    msg,
-				Similarity: similarity,
-			})
-		}
+	results, err := e.resolveNeighbors(ctx, neighbors, 0.3, messageID) // Higher threshold for similar messages
+	if err != nil {
+		return nil, err
 	}
 
-	// Sort by similarity
-	sort.Slice(results, func(i, j int) bool {
-		return results[i].Similarity > results[j].Similarity
-	})
-
 	// Limit results
-	maxSimilar := 3
 	if len(results) > maxSimilar {
 		results = results[:maxSimilar]
 	}
@@ -146,3 +146,48 @@ func TestSearchRelevance(t *testing.T) {
 		t.Errorf("Different content should have lower similarity than same content")
 	}
 }
+
+func TestReciprocalRankFusion(t *testing.T) {
+	semantic := []int64{1, 2, 3}
+	keyword := []int64{3, 4}
+
+	fused := reciprocalRankFusion(semantic, keyword)
+	if len(fused) != 4 {
+		t.Fatalf("Expected 4 fused results, got %d", len(fused))
+	}
+
+	// 3 appears in both lists so it must outrank everything else
+	if fused[0].id != 3 {
+		t.Errorf("Expected message 3 first, got %d", fused[0].id)
+	}
+
+	expected := 1/float64(rrfK+3) + 1/float64(rrfK+1)
+	if math.Abs(fused[0].score-expected) > 1e-9 {
+		t.Errorf("Expected fused score %f, got %f", expected, fused[0].score)
+	}
+
+	// Equal scores keep the order of the first ranking
+	if fused[1].id != 1 || fused[2].id != 2 || fused[3].id != 4 {
+		t.Errorf("Unexpected fused order: %+v", fused)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	tests := map[string]Mode{
+		"":         ModeSemantic,
+		"semantic": ModeSemantic,
+		"Hybrid":   ModeHybrid,
+		"keyword":  ModeKeyword,
+	}
+
+	for input, expected := range tests {
+		mode, err := ParseMode(input)
+		if err != nil || mode != expected {
+			t.Errorf("ParseMode(%q) = %q, %v; want %q", input, mode, err, expected)
+		}
+	}
+
+	if _, err := ParseMode("fuzzy"); err == nil {
+		t.Error("Expected error for unknown mode")
+	}
+}
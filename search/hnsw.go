@@ -0,0 +1,450 @@
+package search
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"sync"
+)
+
+// HNSW parameters tuned for sentence embeddings (384 dims for all-minilm)
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEfSearch       = 64
+)
+
+// HNSWIndex is an in-memory Hierarchical Navigable Small World graph using
+// cosine similarity. Vectors are normalized on insert so that similarity is
+// a plain dot product.
+type HNSWIndex struct {
+	mutex sync.RWMutex
+
+	m              int // max neighbours per node on upper layers
+	mMax0          int // max neighbours per node on layer 0
+	efConstruction int
+	efSearch       int
+	levelMult      float64
+
+	nodes    map[int64]*hnswNode
+	entryID  int64
+	maxLevel int
+	dim      int
+	rng      *rand.Rand
+}
+
+type hnswNode struct {
+	id        int64
+	vector    []float64
+	neighbors [][]int64 // neighbours per layer, index 0 is the bottom layer
+}
+
+// NewHNSWIndex creates an empty index with default parameters
+func NewHNSWIndex() *HNSWIndex {
+	return &HNSWIndex{
+		m:              defaultHNSWM,
+		mMax0:          defaultHNSWM * 2,
+		efConstruction: defaultHNSWEfConstruction,
+		efSearch:       defaultHNSWEfSearch,
+		levelMult:      1 / math.Log(float64(defaultHNSWM)),
+		nodes:          make(map[int64]*hnswNode),
+		maxLevel:       -1,
+		rng:            rand.New(rand.NewSource(42)),
+	}
+}
+
+func (h *HNSWIndex) Len() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.nodes)
+}
+
+func (h *HNSWIndex) Add(id int64, vector []float64) error {
+	if len(vector) == 0 {
+		return fmt.Errorf("vector cannot be empty")
+	}
+
+	normalized := normalize(vector)
+	if normalized == nil {
+		return fmt.Errorf("vector has zero norm")
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	_, exists := h.nodes[id]
+	replacesOnlyNode := exists && len(h.nodes) == 1
+	if h.dim != 0 && len(vector) != h.dim && !replacesOnlyNode {
+		return fmt.Errorf("vector has %d dimensions, index expects %d", len(vector), h.dim)
+	}
+
+	if exists {
+		h.remove(id)
+	}
+
+	if len(h.nodes) == 0 {
+		h.dim = len(vector)
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{
+		id:        id,
+		vector:    normalized,
+		neighbors: make([][]int64, level+1),
+	}
+	h.nodes[id] = node
+
+	// First node becomes the entry point
+	if h.maxLevel < 0 {
+		h.entryID = id
+		h.maxLevel = level
+		return nil
+	}
+
+	// Greedy descent through the layers above the new node's level
+	entry := []candidate{{id: h.entryID, similarity: h.similarity(normalized, h.entryID)}}
+	for l := h.maxLevel; l > level; l-- {
+		entry = h.searchLayer(normalized, entry, 1, l)
+	}
+
+	// Connect the node on every layer it lives on
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(normalized, entry, h.efConstruction, l)
+		selected := h.selectNeighbors(candidates, h.maxNeighbors(l))
+		node.neighbors[l] = make([]int64, 0, len(selected))
+		for _, c := range selected {
+			node.neighbors[l] = append(node.neighbors[l], c.id)
+			h.link(c.id, id, l)
+		}
+		entry = candidates
+	}
+
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entryID = id
+	}
+
+	return nil
+}
+
+func (h *HNSWIndex) Remove(id int64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.remove(id)
+}
+
+func (h *HNSWIndex) Query(vector []float64, k int) []Neighbor {
+	if k <= 0 {
+		return nil
+	}
+
+	normalized := normalize(vector)
+	if normalized == nil {
+		return nil
+	}
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if h.maxLevel < 0 || len(vector) != h.dim {
+		return nil
+	}
+
+	entry := []candidate{{id: h.entryID, similarity: h.similarity(normalized, h.entryID)}}
+	for l := h.maxLevel; l > 0; l-- {
+		entry = h.searchLayer(normalized, entry, 1, l)
+	}
+
+	found := h.searchLayer(normalized, entry, max(h.efSearch, k), 0)
+	if len(found) > k {
+		found = found[:k]
+	}
+
+	results := make([]Neighbor, len(found))
+	for i, c := range found {
+		results[i] = Neighbor{ID: c.id, Similarity: c.similarity}
+	}
+	return results
+}
+
+// remove unlinks a node and repairs the neighbourhoods it leaves behind.
+// Callers must hold the write lock.
+func (h *HNSWIndex) remove(id int64) {
+	node, exists := h.nodes[id]
+	if !exists {
+		return
+	}
+	delete(h.nodes, id)
+
+	for l, neighbors := range node.neighbors {
+		for _, neighborID := range neighbors {
+			neighbor, ok := h.nodes[neighborID]
+			if !ok || l >= len(neighbor.neighbors) {
+				continue
+			}
+
+			// Offer the removed node's other neighbours as replacements
+			var candidates []candidate
+			for _, existing := range neighbor.neighbors[l] {
+				if existing != id {
+					if _, ok := h.nodes[existing]; ok {
+						candidates = append(candidates, candidate{existing, h.similarity(neighbor.vector, existing)})
+					}
+				}
+			}
+			for _, replacement := range neighbors {
+				if replacement != neighborID && replacement != id && !containsID(neighbor.neighbors[l], replacement) {
+					if _, ok := h.nodes[replacement]; ok {
+						candidates = append(candidates, candidate{replacement, h.similarity(neighbor.vector, replacement)})
+					}
+				}
+			}
+
+			sortCandidates(candidates)
+			selected := h.selectNeighbors(candidates, h.maxNeighbors(l))
+			neighbor.neighbors[l] = neighbor.neighbors[l][:0]
+			for _, c := range selected {
+				neighbor.neighbors[l] = append(neighbor.neighbors[l], c.id)
+			}
+		}
+	}
+
+	if len(h.nodes) == 0 {
+		h.maxLevel = -1
+		h.dim = 0
+		return
+	}
+
+	// Pick a new entry point from the highest remaining layer
+	if h.entryID == id {
+		h.maxLevel = -1
+		for nodeID, n := range h.nodes {
+			if len(n.neighbors)-1 > h.maxLevel {
+				h.maxLevel = len(n.neighbors) - 1
+				h.entryID = nodeID
+			}
+		}
+	}
+}
+
+// link adds a directed edge from -> to on the given layer, pruning the
+// neighbour list of from if it grows beyond the layer's limit
+func (h *HNSWIndex) link(from, to int64, level int) {
+	node := h.nodes[from]
+	if node == nil || level >= len(node.neighbors) {
+		return
+	}
+
+	node.neighbors[level] = append(node.neighbors[level], to)
+	limit := h.maxNeighbors(level)
+	if len(node.neighbors[level]) <= limit {
+		return
+	}
+
+	candidates := make([]candidate, 0, len(node.neighbors[level]))
+	for _, neighborID := range node.neighbors[level] {
+		if _, ok := h.nodes[neighborID]; ok {
+			candidates = append(candidates, candidate{neighborID, h.similarity(node.vector, neighborID)})
+		}
+	}
+	sortCandidates(candidates)
+
+	selected := h.selectNeighbors(candidates, limit)
+	node.neighbors[level] = node.neighbors[level][:0]
+	for _, c := range selected {
+		node.neighbors[level] = append(node.neighbors[level], c.id)
+	}
+}
+
+// searchLayer runs a best-first search on one layer and returns up to ef
+// candidates sorted by similarity (highest first)
+func (h *HNSWIndex) searchLayer(query []float64, entry []candidate, ef int, level int) []candidate {
+	visited := make(map[int64]bool, ef*4)
+	toVisit := &maxCandidateHeap{}
+	found := &minCandidateHeap{}
+
+	for _, c := range entry {
+		if _, ok := h.nodes[c.id]; !ok || visited[c.id] {
+			continue
+		}
+		visited[c.id] = true
+		heap.Push(toVisit, c)
+		heap.Push(found, c)
+		if found.Len() > ef {
+			heap.Pop(found)
+		}
+	}
+
+	for toVisit.Len() > 0 {
+		current := heap.Pop(toVisit).(candidate)
+		if found.Len() >= ef && current.similarity < (*found)[0].similarity {
+			break
+		}
+
+		node := h.nodes[current.id]
+		if node == nil || level >= len(node.neighbors) {
+			continue
+		}
+
+		for _, neighborID := range node.neighbors[level] {
+			if visited[neighborID] {
+				continue
+			}
+			visited[neighborID] = true
+
+			if _, ok := h.nodes[neighborID]; !ok {
+				continue // Dangling edge left behind by a removal
+			}
+
+			similarity := h.similarity(query, neighborID)
+			if found.Len() < ef || similarity > (*found)[0].similarity {
+				c := candidate{neighborID, similarity}
+				heap.Push(toVisit, c)
+				heap.Push(found, c)
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+
+	results := make([]candidate, found.Len())
+	for i := len(results) - 1; i >= 0; i-- {
+		results[i] = heap.Pop(found).(candidate)
+	}
+	return results
+}
+
+// selectNeighbors applies the HNSW diversity heuristic: a candidate is kept
+// only if it is closer to the base node than to any already selected
+// neighbour. Candidates must be sorted by similarity (highest first).
+func (h *HNSWIndex) selectNeighbors(candidates []candidate, limit int) []candidate {
+	if len(candidates) <= limit {
+		return candidates
+	}
+
+	selected := make([]candidate, 0, limit)
+	var skipped []candidate
+	for _, c := range candidates {
+		if len(selected) >= limit {
+			break
+		}
+
+		keep := true
+		for _, s := range selected {
+			if h.similarity(h.nodes[c.id].vector, s.id) > c.similarity {
+				keep = false
+				break
+			}
+		}
+
+		if keep {
+			selected = append(selected, c)
+		} else {
+			skipped = append(skipped, c)
+		}
+	}
+
+	// Fill up with the closest pruned candidates to keep the graph connected
+	for _, c := range skipped {
+		if len(selected) >= limit {
+			break
+		}
+		selected = append(selected, c)
+	}
+
+	return selected
+}
+
+func (h *HNSWIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return h.mMax0
+	}
+	return h.m
+}
+
+func (h *HNSWIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *HNSWIndex) similarity(query []float64, id int64) float64 {
+	return dotProduct(query, h.nodes[id].vector)
+}
+
+func dotProduct(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// normalize returns a unit-length copy of v, or nil for a zero vector
+func normalize(v []float64) []float64 {
+	var norm float64
+	for _, x := range v {
+		norm += x * x
+	}
+	if norm == 0 {
+		return nil
+	}
+
+	norm = math.Sqrt(norm)
+	normalized := make([]float64, len(v))
+	for i, x := range v {
+		normalized[i] = x / norm
+	}
+	return normalized
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, existing := range ids {
+		if existing == id {
+			return true
+		}
+	}
+	return false
+}
+
+type candidate struct {
+	id         int64
+	similarity float64
+}
+
+func sortCandidates(candidates []candidate) {
+	// Insertion sort: neighbour lists are short
+	for i := 1; i < len(candidates); i++ {
+		for j := i; j > 0 && candidates[j].similarity > candidates[j-1].similarity; j-- {
+			candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+		}
+	}
+}
+
+// minCandidateHeap keeps the least similar candidate on top
+type minCandidateHeap []candidate
+
+func (h minCandidateHeap) Len() int            { return len(h) }
+func (h minCandidateHeap) Less(i, j int) bool  { return h[i].similarity < h[j].similarity }
+func (h minCandidateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minCandidateHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minCandidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxCandidateHeap keeps the most similar candidate on top
+type maxCandidateHeap []candidate
+
+func (h maxCandidateHeap) Len() int            { return len(h) }
+func (h maxCandidateHeap) Less(i, j int) bool  { return h[i].similarity > h[j].similarity }
+func (h maxCandidateHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxCandidateHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxCandidateHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
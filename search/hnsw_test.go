@@ -0,0 +1,147 @@
+package search
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func randomVectors(n, dim int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float64, n)
+	for i := range vectors {
+		vectors[i] = make([]float64, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float64()*2 - 1
+		}
+	}
+	return vectors
+}
+
+func bruteForceTopK(vectors [][]float64, query []float64, k int) []int64 {
+	type scored struct {
+		id    int64
+		score float64
+	}
+	var all []scored
+	for i, v := range vectors {
+		all = append(all, scored{int64(i), cosineSimilarity(query, v)})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].score > all[j].score })
+
+	ids := make([]int64, 0, k)
+	for _, s := range all[:k] {
+		ids = append(ids, s.id)
+	}
+	return ids
+}
+
+func TestHNSWRecall(t *testing.T) {
+	vectors := randomVectors(2000, 32, 1)
+	index := NewHNSWIndex()
+	for i, v := range vectors {
+		if err := index.Add(int64(i), v); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+
+	if index.Len() != len(vectors) {
+		t.Fatalf("Expected %d vectors, got %d", len(vectors), index.Len())
+	}
+
+	k := 10
+	queries := randomVectors(50, 32, 2)
+	hits, total := 0, 0
+	for _, q := range queries {
+		expected := bruteForceTopK(vectors, q, k)
+		got := make(map[int64]bool)
+		for _, n := range index.Query(q, k) {
+			got[n.ID] = true
+		}
+		for _, id := range expected {
+			if got[id] {
+				hits++
+			}
+			total++
+		}
+	}
+
+	recall := float64(hits) / float64(total)
+	if recall < 0.9 {
+		t.Errorf("Expected recall >= 0.9, got %.2f", recall)
+	}
+}
+
+func TestHNSWQueryOrderAndSimilarity(t *testing.T) {
+	index := NewHNSWIndex()
+	index.Add(1, []float64{1, 0, 0})
+	index.Add(2, []float64{0.9, 0.1, 0})
+	index.Add(3, []float64{0, 1, 0})
+
+	results := index.Query([]float64{1, 0, 0}, 3)
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	if results[0].ID != 1 || results[1].ID != 2 || results[2].ID != 3 {
+		t.Errorf("Unexpected result order: %+v", results)
+	}
+	if results[0].Similarity < 0.9999 {
+		t.Errorf("Expected exact match similarity ~1.0, got %f", results[0].Similarity)
+	}
+}
+
+func TestHNSWRemoveAndReplace(t *testing.T) {
+	vectors := randomVectors(500, 16, 3)
+	index := NewHNSWIndex()
+	for i, v := range vectors {
+		index.Add(int64(i), v)
+	}
+
+	// Remove every other vector, including whichever node is the entry point
+	for i := 0; i < len(vectors); i += 2 {
+		index.Remove(int64(i))
+	}
+
+	if index.Len() != len(vectors)/2 {
+		t.Fatalf("Expected %d vectors after removal, got %d", len(vectors)/2, index.Len())
+	}
+
+	for i := 1; i < len(vectors); i += 2 {
+		results := index.Query(vectors[i], 1)
+		if len(results) != 1 || results[0].ID != int64(i) {
+			t.Fatalf("Expected vector %d to find itself, got %+v", i, results)
+		}
+	}
+
+	for _, n := range index.Query(vectors[0], 20) {
+		if n.ID%2 == 0 {
+			t.Errorf("Removed vector %d returned by query", n.ID)
+		}
+	}
+
+	// Replacing a vector moves it to the new position
+	index.Add(1, vectors[2])
+	results := index.Query(vectors[2], 1)
+	if len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("Expected replaced vector to match its new value, got %+v", results)
+	}
+}
+
+func TestHNSWDimensionMismatch(t *testing.T) {
+	index := NewHNSWIndex()
+	if err := index.Add(1, []float64{1, 2, 3}); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	if err := index.Add(2, []float64{1, 2}); err == nil {
+		t.Error("Expected error for mismatched dimensions")
+	}
+
+	if results := index.Query([]float64{1, 2}, 1); len(results) != 0 {
+		t.Errorf("Expected no results for mismatched query, got %+v", results)
+	}
+
+	if err := index.Add(3, []float64{0, 0, 0}); err == nil {
+		t.Error("Expected error for zero vector")
+	}
+}
@@ -0,0 +1,69 @@
+package search
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Mode selects how Search ranks messages
+type Mode string
+
+const (
+	ModeSemantic Mode = "semantic" // cosine similarity of embeddings
+	ModeKeyword  Mode = "keyword"  // full-text (BM25) matches only
+	ModeHybrid   Mode = "hybrid"   // reciprocal rank fusion of both
+)
+
+// rrfK dampens the weight of top ranks in reciprocal rank fusion; 60 is the
+// value from the original RRF paper and works well without tuning
+const rrfK = 60
+
+// hybridCandidates is how many results each ranking contributes to fusion
+const hybridCandidates = 50
+
+// ParseMode converts a user supplied mode name into a Mode
+func ParseMode(s string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(s))) {
+	case "", ModeSemantic:
+		return ModeSemantic, nil
+	case ModeKeyword:
+		return ModeKeyword, nil
+	case ModeHybrid:
+		return ModeHybrid, nil
+	default:
+		return "", fmt.Errorf("unknown search mode %q (use semantic, keyword or hybrid)", s)
+	}
+}
+
+type fusedResult struct {
+	id    int64
+	score float64
+}
+
+// reciprocalRankFusion merges ranked ID lists by summing 1/(rrfK + rank)
+// for every list an ID appears in, highest fused score first
+func reciprocalRankFusion(rankings ...[]int64) []fusedResult {
+	scores := make(map[int64]float64)
+	var order []int64
+	for _, ranking := range rankings {
+		for rank, id := range ranking {
+			if _, seen := scores[id]; !seen {
+				order = append(order, id)
+			}
+			scores[id] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	fused := make([]fusedResult, len(order))
+	for i, id := range order {
+		fused[i] = fusedResult{id: id, score: scores[id]}
+	}
+
+	// Stable sort keeps earlier rankings first on ties
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].score > fused[j].score
+	})
+
+	return fused
+}
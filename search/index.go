@@ -0,0 +1,20 @@
+package search
+
+// VectorIndex is a nearest-neighbour index over message embeddings.
+// Implementations must be safe for concurrent use.
+type VectorIndex interface {
+	// Add inserts a vector under the given ID, replacing any existing entry.
+	Add(id int64, vector []float64) error
+	// Remove deletes the vector stored under the given ID, if any.
+	Remove(id int64)
+	// Query returns up to k entries closest to vector, most similar first.
+	Query(vector []float64, k int) []Neighbor
+	// Len returns the number of vectors in the index.
+	Len() int
+}
+
+// Neighbor is a single VectorIndex query result
+type Neighbor struct {
+	ID         int64
+	Similarity float64
+}
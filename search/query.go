@@ -0,0 +1,150 @@
+package search
+
+import (
+	"fmt"
+	"semantic-search-bot/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Query is a parsed search query: the free text used for semantic and
+// keyword matching plus the filters given as operators
+type Query struct {
+	Text   string
+	Filter database.MessageFilter
+}
+
+// ParseQuery extracts filter operators from a raw query:
+//
+//	from:@user       messages by or forwarded from a user (repeat for several)
+//	after:DATE       messages on or after DATE
+//	before:DATE      messages before DATE
+//	on:DATE          messages on DATE
+//	has:link         messages containing a URL
+//	has:photo        photos, likewise has:video, has:doc, has:poll, has:audio,
+//	                 has:voice and has:media (photos, videos and GIFs)
+//
+// DATE is YYYY-MM-DD, "today", "yesterday" or a relative age such as 7d or
+// 2w. Dates are interpreted in now's location. Everything that is not an
+// operator is kept as the query text.
+func ParseQuery(raw string, now time.Time) (Query, error) {
+	var q Query
+	var text []string
+
+	for _, field := range strings.Fields(raw) {
+		name, value, found := strings.Cut(field, ":")
+		if !found || value == "" {
+			text = append(text, field)
+			continue
+		}
+
+		switch strings.ToLower(name) {
+		case "from":
+			username := strings.TrimPrefix(value, "@")
+			if username == "" {
+				return q, fmt.Errorf("from: needs a username, e.g. from:@alice")
+			}
+			q.Filter.Usernames = append(q.Filter.Usernames, username)
+		case "after":
+			day, err := parseDate(value, now)
+			if err != nil {
+				return q, fmt.Errorf("after: %w", err)
+			}
+			q.Filter.After = laterOf(q.Filter.After, day)
+		case "before":
+			day, err := parseDate(value, now)
+			if err != nil {
+				return q, fmt.Errorf("before: %w", err)
+			}
+			q.Filter.Before = earlierOf(q.Filter.Before, day)
+		case "on":
+			day, err := parseDate(value, now)
+			if err != nil {
+				return q, fmt.Errorf("on: %w", err)
+			}
+			q.Filter.After = laterOf(q.Filter.After, day)
+			q.Filter.Before = earlierOf(q.Filter.Before, day.AddDate(0, 0, 1))
+		case "has":
+			value = strings.ToLower(value)
+			switch {
+			case value == "link" || value == "links" || value == "url":
+				q.Filter.HasLink = true
+			case contentTypes[value] != nil:
+				q.Filter.ContentTypes = append(q.Filter.ContentTypes, contentTypes[value]...)
+			default:
+				return q, fmt.Errorf("unknown has: value %q (supported: link, photo, video, doc, poll, audio, voice, media)", value)
+			}
+		default:
+			// Not an operator, e.g. a URL or a "key:value" identifier
+			text = append(text, field)
+		}
+	}
+
+	if !q.Filter.After.IsZero() && !q.Filter.Before.IsZero() && !q.Filter.After.Before(q.Filter.Before) {
+		return q, fmt.Errorf("the date range is empty")
+	}
+
+	q.Text = strings.Join(text, " ")
+	return q, nil
+}
+
+// contentTypes maps has: values to the content types they match
+var contentTypes = map[string][]string{
+	"photo":    {database.ContentPhoto},
+	"photos":   {database.ContentPhoto},
+	"video":    {database.ContentVideo},
+	"videos":   {database.ContentVideo},
+	"doc":      {database.ContentDocument},
+	"docs":     {database.ContentDocument},
+	"document": {database.ContentDocument},
+	"file":     {database.ContentDocument},
+	"poll":     {database.ContentPoll},
+	"audio":    {database.ContentAudio},
+	"voice":    {database.ContentVoice},
+	"media":    {database.ContentPhoto, database.ContentVideo, database.ContentAnimation},
+}
+
+// parseDate returns the start of the day described by value
+func parseDate(value string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	switch strings.ToLower(value) {
+	case "today":
+		return today, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), nil
+	}
+
+	// Relative ages: 3d, 2w
+	if len(value) > 1 {
+		if n, err := strconv.Atoi(value[:len(value)-1]); err == nil && n >= 0 {
+			switch strings.ToLower(value[len(value)-1:]) {
+			case "d":
+				return today.AddDate(0, 0, -n), nil
+			case "w":
+				return today.AddDate(0, 0, -7*n), nil
+			}
+		}
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", value, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q (use YYYY-MM-DD, today, yesterday, 7d or 2w)", value)
+	}
+	return day, nil
+}
+
+func laterOf(current, t time.Time) time.Time {
+	if current.IsZero() || t.After(current) {
+		return t
+	}
+	return current
+}
+
+func earlierOf(current, t time.Time) time.Time {
+	if current.IsZero() || t.Before(current) {
+		return t
+	}
+	return current
+}
@@ -0,0 +1,102 @@
+package search
+
+import (
+	"semantic-search-bot/database"
+	"testing"
+	"time"
+)
+
+func TestParseQuery(t *testing.T) {
+	now := time.Date(2026, 3, 15, 14, 30, 0, 0, time.UTC)
+
+	q, err := ParseQuery("from:@Alice deploy after:2026-01-01 before:2026-02-01 has:link rollback", now)
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+
+	if q.Text != "deploy rollback" {
+		t.Errorf("Expected text 'deploy rollback', got '%s'", q.Text)
+	}
+	if len(q.Filter.Usernames) != 1 || q.Filter.Usernames[0] != "Alice" {
+		t.Errorf("Expected username Alice, got %v", q.Filter.Usernames)
+	}
+	if !q.Filter.After.Equal(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected after: %v", q.Filter.After)
+	}
+	if !q.Filter.Before.Equal(time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected before: %v", q.Filter.Before)
+	}
+	if !q.Filter.HasLink {
+		t.Error("Expected has:link to be set")
+	}
+}
+
+func TestParseQueryDates(t *testing.T) {
+	now := time.Date(2026, 3, 15, 14, 30, 0, 0, time.UTC)
+	today := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		raw    string
+		after  time.Time
+		before time.Time
+	}{
+		{"on:yesterday", today.AddDate(0, 0, -1), today},
+		{"on:2026-03-01", time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 2, 0, 0, 0, 0, time.UTC)},
+		{"after:7d", today.AddDate(0, 0, -7), time.Time{}},
+		{"after:2w before:today", today.AddDate(0, 0, -14), today},
+		{"after:2026-03-01 on:2026-03-10", time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC), time.Date(2026, 3, 11, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		q, err := ParseQuery(tt.raw, now)
+		if err != nil {
+			t.Errorf("ParseQuery(%q) failed: %v", tt.raw, err)
+			continue
+		}
+		if !q.Filter.After.Equal(tt.after) || !q.Filter.Before.Equal(tt.before) {
+			t.Errorf("ParseQuery(%q) = [%v, %v), want [%v, %v)", tt.raw, q.Filter.After, q.Filter.Before, tt.after, tt.before)
+		}
+		if q.Text != "" {
+			t.Errorf("ParseQuery(%q) left text %q", tt.raw, q.Text)
+		}
+	}
+}
+
+func TestParseQueryKeepsNonOperators(t *testing.T) {
+	q, err := ParseQuery("https://example.com error:E42 from: ratio 3:2", time.Now())
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if q.Text != "https://example.com error:E42 from: ratio 3:2" {
+		t.Errorf("Expected non-operators to be kept, got '%s'", q.Text)
+	}
+	if !q.Filter.IsEmpty() {
+		t.Errorf("Expected empty filter, got %+v", q.Filter)
+	}
+}
+
+func TestParseQueryContentTypes(t *testing.T) {
+	q, err := ParseQuery("has:photo sunset has:DOC", time.Now())
+	if err != nil {
+		t.Fatalf("ParseQuery failed: %v", err)
+	}
+	if q.Text != "sunset" {
+		t.Errorf("Expected text 'sunset', got '%s'", q.Text)
+	}
+	if len(q.Filter.ContentTypes) != 2 || q.Filter.ContentTypes[0] != database.ContentPhoto || q.Filter.ContentTypes[1] != database.ContentDocument {
+		t.Errorf("Expected photos and documents, got %v", q.Filter.ContentTypes)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, raw := range []string{
+		"before:soon",
+		"has:attachment",
+		"after:2026-02-01 before:2026-01-01",
+		"from:@",
+	} {
+		if _, err := ParseQuery(raw, time.Now()); err == nil {
+			t.Errorf("Expected error for %q", raw)
+		}
+	}
+}
@@ -0,0 +1,424 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"semantic-search-bot/database"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// conversationGap ends a conversation when nobody wrote for this long,
+	// unless the next message replies to one inside it
+	conversationGap = 10 * time.Minute
+	// windowSize is how many messages a conversation window holds
+	windowSize = 6
+	// windowStride is how far apart consecutive windows start, so that they
+	// overlap and each message is seen with some context on both sides
+	windowStride = 3
+	// windowLineLength caps the text of each message in a window
+	windowLineLength = 300
+	// windowBatchSize is how many windows are embedded per request
+	windowBatchSize = 16
+	// windowMessageLimit bounds how many new messages one pass groups
+	windowMessageLimit = 2000
+)
+
+// SplitConversations groups messages, oldest first, into conversations. A
+// conversation ends when the next message comes more than conversationGap
+// after the previous one and doesn't reply to a message of the conversation.
+func SplitConversations(messages []database.Message) [][]database.Message {
+	var conversations [][]database.Message
+	var current []database.Message
+	members := make(map[int]bool) // Telegram IDs in the current conversation
+
+	for _, msg := range messages {
+		if len(current) > 0 {
+			gap := msg.Timestamp.Sub(current[len(current)-1].Timestamp)
+			if gap > conversationGap && !members[msg.ReplyToMessageID] {
+				conversations = append(conversations, current)
+				current = nil
+				members = make(map[int]bool)
+			}
+		}
+
+		current = append(current, msg)
+		if msg.TelegramMessageID != 0 {
+			members[msg.TelegramMessageID] = true
+		}
+	}
+
+	if len(current) > 0 {
+		conversations = append(conversations, current)
+	}
+	return conversations
+}
+
+// BuildWindows slides overlapping windows of windowSize messages over a
+// conversation. When a message replies to one outside its window, the
+// parent becomes the window's first line; parents are looked up in the
+// conversation and then in parents, keyed by Telegram message ID.
+func BuildWindows(conversation []database.Message, parents map[int]database.Message) []database.ConversationWindow {
+	if len(conversation) == 0 {
+		return nil
+	}
+
+	byTelegramID := make(map[int]database.Message, len(conversation))
+	for _, msg := range conversation {
+		if msg.TelegramMessageID != 0 {
+			byTelegramID[msg.TelegramMessageID] = msg
+		}
+	}
+
+	first, last := conversation[0].ID, conversation[len(conversation)-1].ID
+	var windows []database.ConversationWindow
+	for start := 0; ; start += windowStride {
+		end := min(start+windowSize, len(conversation))
+		lines := conversation[start:end]
+
+		if parent, ok := replyParent(lines, byTelegramID, parents); ok {
+			lines = append([]database.Message{parent}, lines...)
+		}
+
+		window := database.ConversationWindow{
+			ChatID:         conversation[0].ChatID,
+			SegmentFirstID: first,
+			SegmentLastID:  last,
+		}
+		text := make([]string, len(lines))
+		for i, msg := range lines {
+			window.MessageIDs = append(window.MessageIDs, msg.ID)
+			text[i] = windowLine(msg)
+		}
+		window.Text = strings.Join(text, "\n")
+		windows = append(windows, window)
+
+		if end == len(conversation) {
+			return windows
+		}
+	}
+}
+
+// replyParent returns the first message replied to from within lines that
+// is not one of them
+func replyParent(lines []database.Message, byTelegramID, parents map[int]database.Message) (database.Message, bool) {
+	inWindow := make(map[int]bool, len(lines))
+	for _, msg := range lines {
+		inWindow[msg.TelegramMessageID] = true
+	}
+
+	for _, msg := range lines {
+		if msg.ReplyToMessageID == 0 || inWindow[msg.ReplyToMessageID] {
+			continue
+		}
+		if parent, ok := byTelegramID[msg.ReplyToMessageID]; ok {
+			return parent, true
+		}
+		if parent, ok := parents[msg.ReplyToMessageID]; ok {
+			return parent, true
+		}
+	}
+	return database.Message{}, false
+}
+
+// windowLine renders a message as a line of a window's text
+func windowLine(msg database.Message) string {
+	name := msg.Username
+	if name == "" {
+		name = "someone"
+	}
+
+	text := msg.Text
+	if len(text) > windowLineLength {
+		cut := windowLineLength
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		text = text[:cut] + "..."
+	}
+	return name + ": " + text
+}
+
+// EnableConversationWindows makes semantic searches rank conversation
+// windows instead of single messages, in chats that have windows
+func (e *Engine) EnableConversationWindows() {
+	e.windows = true
+}
+
+// IndexConversations brings a chat's conversation windows up to date: it
+// windows stale conversations again, groups new messages into windows, and
+// embeds windows that have no vector from the chat's active model. The
+// conversation still going on at now is windowed too, and windowed again
+// on later passes as it grows.
+func (e *Engine) IndexConversations(ctx context.Context, chatID int64, now time.Time) error {
+	stale, err := e.db.StaleConversations(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	for _, span := range stale {
+		messages, err := e.db.GetMessagesInRange(ctx, chatID, span.FirstID, span.LastID)
+		if err != nil {
+			return err
+		}
+		// Progress is left alone, the span may be the ongoing conversation
+		if err := e.saveWindows(ctx, span, 0, SplitConversations(messages)); err != nil {
+			return err
+		}
+	}
+
+	messages, err := e.db.UnwindowedMessages(ctx, chatID, windowMessageLimit)
+	if err != nil {
+		return err
+	}
+	if len(messages) > 0 {
+		if err := e.windowNewMessages(ctx, chatID, messages, now); err != nil {
+			return err
+		}
+	}
+
+	return e.embedWindows(ctx, chatID)
+}
+
+// windowNewMessages windows messages stored since the last pass. Only
+// conversations that are over move the chat's progress forward.
+func (e *Engine) windowNewMessages(ctx context.Context, chatID int64, messages []database.Message, now time.Time) error {
+	conversations := SplitConversations(messages)
+
+	// The last conversation may go on, or continue past the loaded
+	// messages unless it is all of them
+	closed := len(conversations) - 1
+	last := conversations[closed]
+	truncated := len(messages) == windowMessageLimit && closed > 0
+	if now.Sub(last[len(last)-1].Timestamp) > conversationGap && !truncated {
+		closed++
+	}
+
+	var through int64
+	if closed > 0 {
+		previous := conversations[closed-1]
+		through = previous[len(previous)-1].ID
+	}
+
+	if closed < len(conversations) {
+		// Skip the pass if the ongoing conversation hasn't grown
+		current := database.Conversation{ChatID: chatID, FirstID: last[0].ID, LastID: last[len(last)-1].ID}
+		unchanged, err := e.db.HasConversationWindows(ctx, current)
+		if err != nil {
+			return err
+		}
+		if unchanged && closed == 0 {
+			return nil
+		}
+	}
+
+	span := database.Conversation{ChatID: chatID, FirstID: messages[0].ID, LastID: messages[len(messages)-1].ID}
+	return e.saveWindows(ctx, span, through, conversations)
+}
+
+// saveWindows builds the windows of conversations and stores them in place
+// of the windows of span
+func (e *Engine) saveWindows(ctx context.Context, span database.Conversation, through int64, conversations [][]database.Message) error {
+	parents, err := e.replyParents(ctx, span.ChatID, conversations)
+	if err != nil {
+		return err
+	}
+
+	var windows []database.ConversationWindow
+	for _, conversation := range conversations {
+		windows = append(windows, BuildWindows(conversation, parents)...)
+	}
+
+	removed, err := e.db.SaveConversationWindows(ctx, span, through, windows)
+	if err != nil {
+		return err
+	}
+
+	index := e.windowIndex(span.ChatID)
+	for _, id := range removed {
+		index.Remove(id)
+	}
+	return nil
+}
+
+// replyParents loads the messages replied to from conversations that are
+// not part of them, by Telegram message ID
+func (e *Engine) replyParents(ctx context.Context, chatID int64, conversations [][]database.Message) (map[int]database.Message, error) {
+	members := make(map[int]bool)
+	for _, conversation := range conversations {
+		for _, msg := range conversation {
+			members[msg.TelegramMessageID] = true
+		}
+	}
+
+	var missing []int
+	for _, conversation := range conversations {
+		for _, msg := range conversation {
+			if msg.ReplyToMessageID != 0 && !members[msg.ReplyToMessageID] {
+				missing = append(missing, msg.ReplyToMessageID)
+				members[msg.ReplyToMessageID] = true
+			}
+		}
+	}
+
+	messages, err := e.db.GetMessagesByTelegramIDs(ctx, chatID, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int]database.Message, len(messages))
+	for _, msg := range messages {
+		parents[msg.TelegramMessageID] = msg
+	}
+	return parents, nil
+}
+
+// embedWindows embeds the chat's windows that have no vector from its
+// active model and adds them to its window index
+func (e *Engine) embedWindows(ctx context.Context, chatID int64) error {
+	model, err := e.activeModel(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	embedder := e.embedding.WithModel(model)
+
+	for {
+		windows, err := e.db.WindowsToEmbed(ctx, chatID, model, windowBatchSize)
+		if err != nil {
+			return err
+		}
+		if len(windows) == 0 {
+			return nil
+		}
+
+		texts := make([]string, len(windows))
+		for i, window := range windows {
+			texts[i] = window.Text
+		}
+
+		vectors, err := embedder.GetEmbeddings(ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to embed conversation windows: %w", err)
+		}
+
+		for i, window := range windows {
+			if err := e.db.SaveWindowEmbedding(ctx, window.ID, vectors[i], model); err != nil {
+				return err
+			}
+			if err := e.windowIndex(chatID).Add(window.ID, vectors[i]); err != nil {
+				log.Printf("Error indexing window %d: %v", window.ID, err)
+			}
+		}
+	}
+}
+
+// rebuildWindowIndex replaces a chat's window index with one built from the
+// stored window vectors of model
+func (e *Engine) rebuildWindowIndex(ctx context.Context, chatID int64, model string) error {
+	windows, err := e.db.GetWindowsWithEmbeddings(ctx, chatID, model)
+	if err != nil {
+		return fmt.Errorf("failed to load conversation windows for chat %d: %w", chatID, err)
+	}
+
+	index := e.newIndex()
+	for _, window := range windows {
+		if err := index.Add(window.ID, window.Embedding); err != nil {
+			log.Printf("Skipping window %d in index for chat %d: %v", window.ID, chatID, err)
+		}
+	}
+
+	e.mutex.Lock()
+	e.windowIndexes[chatID] = index
+	e.mutex.Unlock()
+	return nil
+}
+
+// windowSearch ranks the conversation windows of a chat and returns one
+// result per window, pointing at the window's message closest to the query
+func (e *Engine) windowSearch(ctx context.Context, query string, chatID int64, limit int) ([]SearchResult, error) {
+	queryEmbedding, model, err := e.embedQuery(ctx, query, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Overlapping windows often share their best line, ask for extra ones
+	index := e.windowIndex(chatID)
+	neighbors := index.Query(queryEmbedding, limit*2)
+
+	ids := make([]int64, len(neighbors))
+	for i, n := range neighbors {
+		ids[i] = n.ID
+	}
+	windows, err := e.db.GetWindowsByIDs(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve conversation windows: %w", err)
+	}
+
+	byID := make(map[int64]database.ConversationWindow, len(windows))
+	var messageIDs []int64
+	for _, window := range windows {
+		byID[window.ID] = window
+		messageIDs = append(messageIDs, window.MessageIDs...)
+	}
+
+	messages, err := e.loadMessages(ctx, messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []SearchResult{}
+	seen := make(map[int64]bool)
+	for _, n := range neighbors {
+		window, ok := byID[n.ID]
+		if !ok {
+			// Replaced since it was indexed
+			index.Remove(n.ID)
+			continue
+		}
+		if n.Similarity <= 0.1 {
+			continue
+		}
+
+		var snippet []database.Message
+		for _, id := range window.MessageIDs {
+			if msg, ok := messages[id]; ok {
+				snippet = append(snippet, msg)
+			}
+		}
+		if len(snippet) == 0 {
+			continue
+		}
+
+		best := bestLine(queryEmbedding, model, snippet)
+		if seen[best.ID] {
+			continue
+		}
+		seen[best.ID] = true
+
+		results = append(results, SearchResult{
+			Message:    best,
+			Similarity: n.Similarity,
+			Snippet:    snippet,
+		})
+	}
+
+	return results, nil
+}
+
+// bestLine returns the message of a snippet whose own vector is closest to
+// the query, or the first one if none has a vector from model
+func bestLine(vector []float64, model string, snippet []database.Message) database.Message {
+	best := snippet[0]
+	bestSimilarity := -2.0
+	for _, msg := range snippet {
+		if msg.EmbeddingModel != model || len(msg.Embedding) == 0 {
+			continue
+		}
+		if similarity := cosineSimilarity(vector, msg.Embedding); similarity > bestSimilarity {
+			best, bestSimilarity = msg, similarity
+		}
+	}
+	return best
+}
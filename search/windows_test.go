@@ -0,0 +1,66 @@
+package search
+
+import (
+	"semantic-search-bot/database"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitConversations(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	messages := []database.Message{
+		{ID: 1, TelegramMessageID: 10, Timestamp: start},
+		{ID: 2, TelegramMessageID: 11, Timestamp: start.Add(2 * time.Minute)},
+		// A reply keeps the conversation going after a long pause
+		{ID: 3, TelegramMessageID: 12, ReplyToMessageID: 10, Timestamp: start.Add(time.Hour)},
+		// A new topic after another pause starts a new one
+		{ID: 4, TelegramMessageID: 13, Timestamp: start.Add(3 * time.Hour)},
+	}
+
+	conversations := SplitConversations(messages)
+	if len(conversations) != 2 {
+		t.Fatalf("Expected 2 conversations, got %d", len(conversations))
+	}
+	if len(conversations[0]) != 3 || conversations[1][0].ID != 4 {
+		t.Errorf("Expected messages 1-3 and 4, got %+v", conversations)
+	}
+}
+
+func TestBuildWindows(t *testing.T) {
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	var conversation []database.Message
+	for i := 0; i < 8; i++ {
+		conversation = append(conversation, database.Message{
+			ID:                int64(i + 1),
+			ChatID:            -100,
+			TelegramMessageID: i + 100,
+			Username:          "alice",
+			Text:              "line " + string(rune('a'+i)),
+			Timestamp:         start.Add(time.Duration(i) * time.Minute),
+		})
+	}
+	// The last message answers a question asked before the conversation
+	conversation[7].ReplyToMessageID = 50
+	parents := map[int]database.Message{50: {ID: 99, TelegramMessageID: 50, Username: "bob", Text: "does tuesday work?"}}
+
+	windows := BuildWindows(conversation, parents)
+	if len(windows) != 2 {
+		t.Fatalf("Expected 2 overlapping windows, got %d", len(windows))
+	}
+
+	if got := windows[0].MessageIDs; len(got) != windowSize || got[0] != 1 {
+		t.Errorf("Expected the first window to hold messages 1-6, got %v", got)
+	}
+	if windows[0].SegmentFirstID != 1 || windows[0].SegmentLastID != 8 {
+		t.Errorf("Expected the window to cover conversation 1-8, got %d-%d", windows[0].SegmentFirstID, windows[0].SegmentLastID)
+	}
+
+	second := windows[1]
+	if second.MessageIDs[0] != 99 || second.MessageIDs[1] != 4 || second.MessageIDs[len(second.MessageIDs)-1] != 8 {
+		t.Errorf("Expected the reply parent followed by messages 4-8, got %v", second.MessageIDs)
+	}
+	if !strings.HasPrefix(second.Text, "bob: does tuesday work?\nalice: line d") {
+		t.Errorf("Unexpected window text:\n%s", second.Text)
+	}
+}